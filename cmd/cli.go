@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"audio-scraper/internal/config"
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/services"
+)
+
+// Exit codes of the command-line tools.
+const (
+	exitFailed      = 1
+	exitUsage       = 2
+	exitInterrupted = 130
+)
+
+// newFlagSet returns the flags of a command with the -config flag every
+// command shares. args names the positional arguments in the usage line.
+func newFlagSet(command string, args string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: audio-scraper %s [flags] %s\n\nFlags:\n", command, args)
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	return flags, configPath
+}
+
+// loadCLIConfig loads the config for a command-line tool, printing every
+// problem to stderr. library also requires the settings of the music
+// library, which only the commands that touch it need.
+func loadCLIConfig(path string, library bool) (*config.Config, bool) {
+	cfg, err := config.Load(path)
+	if library {
+		err = errors.Join(err, cfg.ValidateLibrary())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		return nil, false
+	}
+	return cfg, true
+}
+
+// cliLogger keeps the logs of the command-line tools out of their output
+// unless verbose is set, in which case they go to stderr.
+func cliLogger(verbose bool) ports.Logger {
+	if verbose {
+		return logger.New(os.Stderr, slog.LevelDebug)
+	}
+	return logger.New(io.Discard, slog.LevelError)
+}
+
+func searchLimits(cfg *config.Config) services.SearchLimits {
+	return services.SearchLimits{
+		Tracks:    cfg.Search.Tracks,
+		Albums:    cfg.Search.Albums,
+		Artists:   cfg.Search.Artists,
+		Playlists: cfg.Search.Playlists,
+	}
+}
+
+// retryPolicies returns the retry policy of each job stage.
+func retryPolicies(cfg *config.Config) services.RetryPolicies {
+	retry := cfg.Workers.Retry
+	policy := func(stage config.StageRetry) services.RetryPolicy {
+		p := services.RetryPolicy{Attempts: retry.Attempts, Backoff: retry.Backoff, MaxBackoff: retry.MaxBackoff}
+		if stage.Attempts > 0 {
+			p.Attempts = stage.Attempts
+		}
+		if stage.Backoff > 0 {
+			p.Backoff = stage.Backoff
+		}
+		return p
+	}
+	return services.RetryPolicies{
+		constants.JobStateSearching:   policy(retry.Search),
+		constants.JobStateDownloading: policy(retry.Download),
+		constants.JobStateTagging:     policy(retry.Tag),
+	}
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "audio-scraper: "+format+"\n", args...)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/config"
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/providers"
+	"audio-scraper/internal/services"
+)
+
+// get downloads everything behind the given Spotify links with the same
+// worker pool the server uses and waits for it to finish. Its jobs are kept
+// in a temporary journal, so it can run next to the server and interrupted
+// downloads are not resumed.
+func get(args []string) int {
+	flags, configPath := newFlagSet("get", "<spotify-url>...")
+	format := flags.String("format", "", "output format: mp3, opus, m4a, flac or ogg (defaults to the configured one)")
+	force := flags.Bool("force", false, "download tracks the library already has")
+	groups := flags.String("album-groups", "", "comma-separated album groups to download for artists: album, single, compilation, appears_on")
+	verbose := flags.Bool("verbose", false, "log to stderr")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	type entity struct {
+		entityType constants.SpotifyEntityType
+		id         spotify.ID
+	}
+	var entities []entity
+	for _, u := range flags.Args() {
+		entityType, id, err := services.ParseSpotifyURL(u)
+		if err != nil {
+			fail("%v", err)
+			return exitUsage
+		}
+		entities = append(entities, entity{entityType: entityType, id: id})
+	}
+	var albumGroups []constants.AlbumGroup
+	for _, group := range config.SplitList(*groups) {
+		albumGroups = append(albumGroups, constants.AlbumGroup(group))
+	}
+	if _, err := services.AlbumTypesFromGroups(albumGroups); err != nil {
+		fail("%v", err)
+		return exitUsage
+	}
+
+	cfg, ok := loadCLIConfig(*configPath, true)
+	if !ok {
+		return exitFailed
+	}
+	if err := cfg.CheckDirectories(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		return exitFailed
+	}
+	audioFormat := cfg.Library.AudioFormat
+	if *format != "" {
+		audioFormat = constants.AudioFormat(*format)
+		if !audioFormat.Valid() {
+			fail("unsupported format %q", *format)
+			return exitUsage
+		}
+	}
+	log := cliLogger(*verbose)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sp, err := providers.NewSpotifyProvider(cfg.Spotify.ClientID, cfg.Spotify.ClientSecret)
+	if err != nil {
+		fail("failed to initialize Spotify provider: %v", err)
+		return exitFailed
+	}
+	fs, err := providers.NewFSProvider(cfg.Library.MusicHome, cfg.Library.PathTemplate)
+	if err != nil {
+		fail("failed to initialize filesystem provider: %v", err)
+		return exitFailed
+	}
+	library := providers.NewLibraryProvider(cfg.Library.MusicHome)
+	if _, err := library.Scan(logger.Into(ctx, log)); err != nil {
+		fail("%v", err)
+		return exitFailed
+	}
+	// Claims go to the real DATA_HOME so a mirror in a running serve never
+	// deletes what this run downloads.
+	claims, err := providers.NewClaimProvider(log, cfg.Library.DataHome)
+	if err != nil {
+		fail("failed to initialize track claims: %v", err)
+		return exitFailed
+	}
+	dataHome, err := os.MkdirTemp("", "audio-scraper-get-")
+	if err != nil {
+		fail("failed to create job journal: %v", err)
+		return exitFailed
+	}
+	defer os.RemoveAll(dataHome)
+	jobs, err := providers.NewJobStoreProvider(log, dataHome)
+	if err != nil {
+		fail("failed to initialize job store: %v", err)
+		return exitFailed
+	}
+	defer jobs.Close()
+
+	events := services.NewEventBus(log)
+	updates, unsubscribe := events.Subscribe()
+	defer unsubscribe()
+	q := services.NewDownloadWorkerPool(cfg.Workers.Size, retryPolicies(cfg), &services.Deps{
+		Log:     log,
+		YT:      providers.NewYTProvider(providers.NewYTMusicSource(), cfg.YouTube.MatchThreshold),
+		FS:      fs,
+		Jobs:    jobs,
+		Library: library,
+		Events:  events,
+	})
+
+	requestID := uuid.New().String()
+	batch := services.NewEnqueuer(&services.EnqueuerDeps{Spotify: sp, FS: fs, Queue: q, Library: library, Claims: claims}).NewBatch(services.EnqueueOptions{
+		RequestID:   requestID,
+		Format:      audioFormat,
+		Force:       *force,
+		AlbumGroups: albumGroups,
+	})
+	var result services.QueueResult
+	for _, e := range entities {
+		log := log.With("request_id", requestID, "type", e.entityType, "id", e.id)
+		result.Merge(batch.Queue(logger.Into(ctx, log), e.entityType, e.id))
+	}
+	if result.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d tracks or links could not be looked up or queued\n", result.Failed)
+	}
+
+	display := newProgressDisplay(os.Stderr, jobs)
+	display.wait(ctx, result.JobIDs, updates)
+
+	// Once interrupted, jobs still running are stopped straight away.
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	if ctx.Err() != nil {
+		cancel()
+	}
+	q.Shutdown(shutdownCtx)
+	cancel()
+
+	fmt.Fprintf(os.Stderr, "%d downloaded, %d already in library, %d failed\n",
+		display.finished[constants.JobStateDone], result.Skipped, display.failed()+result.Failed)
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case display.failed() > 0 || result.Failed > 0:
+		return exitFailed
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/providers"
+)
+
+// libraryCommand runs the library subcommands. Only scan exists so far.
+func libraryCommand(args []string) int {
+	if len(args) == 0 || args[0] != "scan" {
+		fmt.Fprint(os.Stderr, "Usage: audio-scraper library scan [flags]\n")
+		return exitUsage
+	}
+
+	flags, configPath := newFlagSet("library scan", "")
+	verbose := flags.Bool("verbose", false, "log to stderr")
+	flags.Parse(args[1:])
+	cfg, ok := loadCLIConfig(*configPath, true)
+	if !ok {
+		return exitFailed
+	}
+	log := cliLogger(*verbose)
+
+	stats, err := providers.NewLibraryProvider(cfg.Library.MusicHome).Scan(logger.Into(context.Background(), log))
+	if err != nil {
+		fail("%v", err)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stdout, "%s: %d audio files, %d with a Spotify track ID, %d with an ISRC, %d unreadable\n",
+		cfg.Library.MusicHome, stats.Files, stats.TrackIDs, stats.ISRCs, stats.Unreadable)
+	return 0
+}
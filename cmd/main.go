@@ -2,71 +2,46 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 	"os"
-	"strconv"
-	"time"
-
-	"github.com/gorilla/mux"
-
-	"audio-scraper/internal/api"
-	"audio-scraper/internal/constants"
-	"audio-scraper/internal/logger"
-	"audio-scraper/internal/providers"
-	"audio-scraper/internal/services"
+	"strings"
 )
 
-func main() {
-	log := logger.NewLogger()
-	log.Debug("init starting")
-	port := os.Getenv("API_PORT")
-	if port == "" {
-		port = "8080"
-	}
-	log.Info("started server", "host", "0.0.0.0", "port", port)
+const usage = `Usage: audio-scraper [command] [flags] [arguments]
 
-	sp, err := providers.NewSpotifyProvider(os.Getenv("SPOTIFY_CLIENT_ID"), os.Getenv("SPOTIFY_CLIENT_SECRET"))
-	if err != nil {
-		log.Error("failed to initialize Spotify provider", "err", err)
-		return
-	}
-	st := providers.NewStoreProvider(log)
-	yt := providers.NewYTProvider()
-	fs, err := providers.NewFSProvider(os.Getenv("MUSIC_HOME"))
-	if err != nil {
-		log.Error("failed to initialize filesystem provider", "err", err)
-		return
-	}
+Commands:
+  serve                 run the HTTP API (the default)
+  search <query>        search Spotify and list what can be downloaded
+  get <spotify-url>...  download tracks, albums, artists or playlists and wait for them
+  retag [path]...       rewrite the tags of library files from Spotify
+  library scan          index the library and report what was found
 
-	poolSizeEnv := os.Getenv("WORKER_SIZE")
-	poolSize, err := strconv.Atoi(poolSizeEnv)
-	if err != nil || poolSize <= 0 {
-		poolSize = constants.DownloadWorkerPoolSize
-	}
-	q := services.NewDownloadWorkerPool(poolSize, &services.Deps{
-		Log: log,
-		YT:  yt,
-		FS:  fs,
-	})
-	h := api.NewHandlers(&api.Deps{
-		Log:     log,
-		Spotify: sp,
-		Store:   st,
-		Queue:   q,
-	})
-	router := mux.NewRouter()
-	router.HandleFunc("/", h.HealthHandler).Methods("GET")
-	router.HandleFunc("/search", h.Search).Methods("GET")
-	router.HandleFunc("/download", h.Download).Methods("POST")
+Run "audio-scraper <command> -h" for the flags of a command.
+`
 
-	server := &http.Server{
-		Handler:      router,
-		Addr:         fmt.Sprintf("0.0.0.0:%s", port),
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+func main() {
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Error("server failed", "err", err)
+	var code int
+	switch command {
+	case "serve":
+		code = serve(args)
+	case "search":
+		code = search(args)
+	case "get":
+		code = get(args)
+	case "retag":
+		code = retag(args)
+	case "library":
+		code = libraryCommand(args)
+	case "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		code = 2
 	}
+	os.Exit(code)
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// storePollInterval is how often the job store is checked in case the display
+// missed an event, which the event bus drops for slow subscribers.
+const storePollInterval = time.Second
+
+// progressDisplay follows a set of jobs to completion, printing a line for
+// every job that finishes. On a terminal it also keeps a status line with the
+// download progress of the job that last reported any.
+type progressDisplay struct {
+	out  io.Writer
+	tty  bool
+	jobs ports.JobStoreProvider
+
+	total    int
+	pending  map[string]bool
+	finished map[constants.JobState]int
+	// current is the job shown on the status line.
+	current  string
+	progress float64
+}
+
+func newProgressDisplay(out *os.File, jobs ports.JobStoreProvider) *progressDisplay {
+	info, err := out.Stat()
+	return &progressDisplay{
+		out:      out,
+		tty:      err == nil && info.Mode()&os.ModeCharDevice != 0,
+		jobs:     jobs,
+		pending:  make(map[string]bool),
+		finished: make(map[constants.JobState]int),
+	}
+}
+
+// wait returns once every job in jobIDs has finished or ctx is done.
+func (p *progressDisplay) wait(ctx context.Context, jobIDs []string, events <-chan models.JobEvent) {
+	p.total = len(jobIDs)
+	for _, id := range jobIDs {
+		p.pending[id] = true
+	}
+	p.poll()
+
+	ticker := time.NewTicker(storePollInterval)
+	defer ticker.Stop()
+	for len(p.pending) > 0 {
+		select {
+		case <-ctx.Done():
+			p.clearStatus()
+			return
+		case <-ticker.C:
+			p.poll()
+		case event := <-events:
+			if !p.pending[event.JobID] {
+				continue
+			}
+			if event.State.Terminal() {
+				p.poll()
+				continue
+			}
+			p.current = event.JobID
+			p.progress = event.Progress
+			if event.Type == constants.JobEventTypeState {
+				p.progress = 0
+			}
+			p.drawStatus(event.State)
+		}
+	}
+	p.clearStatus()
+}
+
+// poll reads the state of every pending job from the store.
+func (p *progressDisplay) poll() {
+	for id := range p.pending {
+		status, ok := p.jobs.Get(id)
+		if !ok || !status.State.Terminal() {
+			continue
+		}
+		delete(p.pending, id)
+		p.finished[status.State]++
+
+		p.clearStatus()
+		switch status.State {
+		case constants.JobStateDone:
+			fmt.Fprintf(p.out, "done       %s\n", jobTitle(status.Job))
+		case constants.JobStateFailed:
+			fmt.Fprintf(p.out, "failed     %s: %s\n", jobTitle(status.Job), status.Error)
+		default:
+			fmt.Fprintf(p.out, "%-10s %s\n", status.State, jobTitle(status.Job))
+		}
+	}
+}
+
+func (p *progressDisplay) drawStatus(state constants.JobState) {
+	if !p.tty {
+		return
+	}
+	status, ok := p.jobs.Get(p.current)
+	if !ok {
+		return
+	}
+	line := fmt.Sprintf("[%d/%d] %s %s", p.total-len(p.pending), p.total, state, jobTitle(status.Job))
+	if p.progress > 0 {
+		line += fmt.Sprintf(" %.0f%%", p.progress)
+	}
+	fmt.Fprintf(p.out, "\r\033[K%s", line)
+}
+
+func (p *progressDisplay) clearStatus() {
+	if p.tty {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+// failed counts the jobs that did not finish successfully.
+func (p *progressDisplay) failed() int {
+	return p.finished[constants.JobStateFailed] + p.finished[constants.JobStateCancelled]
+}
+
+func jobTitle(job models.DownloadJob) string {
+	return job.Artist + " - " + job.Track
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/providers"
+	"audio-scraper/internal/services"
+)
+
+// retag rewrites the tags of existing files from Spotify, finding each track
+// by the Spotify track ID or, failing that, the ISRC already in its tags.
+// Files are left where they are.
+func retag(args []string) int {
+	flags, configPath := newFlagSet("retag", "[file or directory]...")
+	verbose := flags.Bool("verbose", false, "log to stderr")
+	flags.Parse(args)
+	cfg, ok := loadCLIConfig(*configPath, true)
+	if !ok {
+		return exitFailed
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{cfg.Library.MusicHome}
+	}
+	log := cliLogger(*verbose)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sp, err := providers.NewSpotifyProvider(cfg.Spotify.ClientID, cfg.Spotify.ClientSecret)
+	if err != nil {
+		fail("failed to initialize Spotify provider: %v", err)
+		return exitFailed
+	}
+	fsProvider, err := providers.NewFSProvider(cfg.Library.MusicHome, cfg.Library.PathTemplate)
+	if err != nil {
+		fail("failed to initialize filesystem provider: %v", err)
+		return exitFailed
+	}
+	r := &retagger{
+		sp:    sp,
+		fs:    fsProvider,
+		batch: services.NewEnqueuer(&services.EnqueuerDeps{Spotify: sp}).NewBatch(services.EnqueueOptions{}),
+	}
+
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				// An unreadable entry is reported and the rest of the tree
+				// is still retagged.
+				log.Warn("skipping unreadable entry", "path", path, "err", err)
+				fmt.Fprintf(os.Stdout, "failed     %s: %v\n", path, err)
+				r.failed++
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				// Hidden directories hold staging files and service data.
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if format := audioFormatOf(path); format != "" {
+				r.retagFile(logger.Into(ctx, log.With("path", path)), path, format)
+			}
+			return nil
+		})
+		if errors.Is(err, context.Canceled) {
+			break
+		}
+		if err != nil {
+			fail("%v", err)
+			r.failed++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d retagged, %d without a Spotify ID or ISRC, %d failed\n", r.retagged, r.unidentified, r.failed)
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case r.failed > 0:
+		return exitFailed
+	}
+	return 0
+}
+
+type retagger struct {
+	sp    ports.SpotifyProvider
+	fs    ports.FSProvider
+	batch *services.Batch
+
+	retagged, unidentified, failed int
+}
+
+func (r *retagger) retagFile(ctx context.Context, path string, format constants.AudioFormat) {
+	trackID, isrc, err := r.fs.ReadTrackIDs(ctx, path)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "failed     %s: %v\n", path, err)
+		r.failed++
+		return
+	}
+	if trackID == "" && isrc != "" {
+		trackID, err = r.trackByISRC(ctx, isrc)
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "failed     %s: %v\n", path, err)
+			r.failed++
+			return
+		}
+	}
+	if trackID == "" {
+		fmt.Fprintf(os.Stdout, "unknown    %s\n", path)
+		r.unidentified++
+		return
+	}
+
+	track, err := r.sp.GetTrack(ctx, spotify.ID(trackID))
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "failed     %s: fetch track %s: %v\n", path, trackID, err)
+		r.failed++
+		return
+	}
+	job := r.batch.Job(ctx, track)
+	job.Format = format
+	if err := r.fs.TagFile(ctx, path, &job); err != nil {
+		fmt.Fprintf(os.Stdout, "failed     %s: %v\n", path, err)
+		r.failed++
+		return
+	}
+	fmt.Fprintf(os.Stdout, "retagged   %s\n", path)
+	r.retagged++
+}
+
+// trackByISRC returns the ID of the first Spotify track with isrc, or "" if
+// there is none.
+func (r *retagger) trackByISRC(ctx context.Context, isrc string) (string, error) {
+	results, err := r.sp.Search(ctx, "isrc:"+isrc, spotify.SearchTypeTrack, spotify.Limit(1))
+	if err != nil {
+		return "", fmt.Errorf("look up ISRC %s: %w", isrc, err)
+	}
+	if results.Tracks == nil || len(results.Tracks.Tracks) == 0 {
+		return "", nil
+	}
+	return results.Tracks.Tracks[0].ID.String(), nil
+}
+
+// audioFormatOf returns the format of a file the service can tag, or "" for
+// any other file.
+func audioFormatOf(path string) constants.AudioFormat {
+	format := constants.AudioFormat(strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")))
+	if format == "" || !format.Valid() {
+		return ""
+	}
+	return format
+}
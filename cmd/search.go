@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/providers"
+	"audio-scraper/internal/services"
+)
+
+// search prints the choices a search offers, each with the Spotify URI that
+// get accepts.
+func search(args []string) int {
+	flags, configPath := newFlagSet("search", "<query>")
+	verbose := flags.Bool("verbose", false, "log to stderr")
+	flags.Parse(args)
+	query := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if query == "" {
+		flags.Usage()
+		return exitUsage
+	}
+	cfg, ok := loadCLIConfig(*configPath, false)
+	if !ok {
+		return exitFailed
+	}
+	log := cliLogger(*verbose)
+
+	sp, err := providers.NewSpotifyProvider(cfg.Spotify.ClientID, cfg.Spotify.ClientSecret)
+	if err != nil {
+		fail("failed to initialize Spotify provider: %v", err)
+		return exitFailed
+	}
+	choices, err := services.Search(logger.Into(context.Background(), log.With("query", query)), sp, query, searchLimits(cfg))
+	if err != nil {
+		fail("%v", err)
+		return exitFailed
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tRESULT\tURI")
+	for _, choice := range choices {
+		// The type column replaces the "Track: " style prefix of the label.
+		label := choice.Label
+		if _, rest, ok := strings.Cut(label, ": "); ok {
+			label = rest
+		}
+		fmt.Fprintf(w, "%s\t%s\tspotify:%s:%s\n", choice.Type, label, choice.Type, choice.ID)
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+
+	"audio-scraper/internal/api"
+	"audio-scraper/internal/config"
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/metrics"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/providers"
+	"audio-scraper/internal/services"
+)
+
+// serve runs the HTTP API until SIGINT or SIGTERM.
+func serve(args []string) int {
+	flags, configPath := newFlagSet("serve", "")
+	printConfig := flags.Bool("print-config", false, "print the effective config and exit")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	err = errors.Join(err, cfg.ValidateLibrary(), cfg.ValidateServe())
+	if *printConfig {
+		out, _ := yaml.Marshal(cfg.Redacted())
+		os.Stdout.Write(out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+			return exitFailed
+		}
+		return 0
+	}
+
+	if err == nil {
+		err = cfg.CheckDirectories()
+	}
+	log := logger.NewLogger()
+	log.Debug("init starting")
+	if err != nil {
+		for _, problem := range strings.Split(err.Error(), "\n") {
+			log.Error("invalid config", "err", problem)
+		}
+		return exitFailed
+	}
+	log.Info("started server", "host", "0.0.0.0", "port", cfg.Server.Port)
+
+	sp, err := providers.NewSpotifyProvider(cfg.Spotify.ClientID, cfg.Spotify.ClientSecret)
+	if err != nil {
+		log.Error("failed to initialize Spotify provider", "err", err)
+		return exitFailed
+	}
+	st := providers.NewStoreProvider(log, cfg.Search.ChoiceTTL)
+	yt := providers.NewYTProvider(providers.NewYTMusicSource(), cfg.YouTube.MatchThreshold)
+	fs, err := providers.NewFSProvider(cfg.Library.MusicHome, cfg.Library.PathTemplate)
+	if err != nil {
+		log.Error("failed to initialize filesystem provider", "err", err)
+		return exitFailed
+	}
+	if err := fs.CleanStaging(logger.Into(context.Background(), log)); err != nil {
+		log.Error("failed to clean staging directory", "err", err)
+		return exitFailed
+	}
+	library := providers.NewLibraryProvider(cfg.Library.MusicHome)
+	if _, err := library.Scan(logger.Into(context.Background(), log)); err != nil {
+		log.Error("failed to scan library", "err", err)
+		return exitFailed
+	}
+	jobs, err := providers.NewJobStoreProvider(log, cfg.Library.DataHome)
+	if err != nil {
+		log.Error("failed to initialize job store", "err", err)
+		return exitFailed
+	}
+
+	events := services.NewEventBus(log)
+	requests := services.NewRequestTracker(events)
+	q := services.NewDownloadWorkerPool(cfg.Workers.Size, retryPolicies(cfg), &services.Deps{
+		Log:     log,
+		YT:      yt,
+		FS:      fs,
+		Jobs:    jobs,
+		Library: library,
+		Events:  events,
+	})
+	auth := api.NewAuthenticator(log, cfg.Auth.APIKeys)
+	if !auth.Enabled() {
+		log.Warn("authentication disabled, the API is open to anyone who can reach it")
+	}
+
+	var webhooks *services.WebhookNotifier
+	if targets := cfg.Webhooks.URLs; len(targets) > 0 {
+		webhooks = services.NewWebhookNotifier(targets, services.DefaultWebhookRetryPolicy, &services.WebhookDeps{
+			Log:      log,
+			Webhooks: providers.NewWebhookProvider(cfg.Webhooks.Secret),
+			Jobs:     jobs,
+			Events:   events,
+			Requests: requests,
+		})
+		log.Info("webhooks enabled", "targets", len(targets))
+	}
+	watchlist, err := providers.NewWatchlistProvider(log, cfg.Library.DataHome)
+	if err != nil {
+		log.Error("failed to initialize watchlist", "err", err)
+		return exitFailed
+	}
+	// A nil *WebhookNotifier would make a non-nil interface.
+	var releaseNotifier ports.ReleaseNotifier
+	if webhooks != nil {
+		releaseNotifier = webhooks
+	}
+	claims, err := providers.NewClaimProvider(log, cfg.Library.DataHome)
+	if err != nil {
+		log.Error("failed to initialize track claims", "err", err)
+		return exitFailed
+	}
+	enqueuer := services.NewEnqueuer(&services.EnqueuerDeps{Spotify: sp, FS: fs, Queue: q, Library: library, Claims: claims, Jobs: jobs})
+	watcher := services.NewWatcher(cfg.Watchlist.Interval, &services.WatcherDeps{
+		Log:       log,
+		Spotify:   sp,
+		Watchlist: watchlist,
+		Enqueuer:  enqueuer,
+		Requests:  requests,
+		Notifier:  releaseNotifier,
+		Format:    cfg.Library.AudioFormat,
+	})
+	if cfg.Watchlist.Interval > 0 {
+		log.Info("watchlist checks scheduled", "interval", cfg.Watchlist.Interval, "artists", len(watchlist.List()))
+	}
+	mirrors, err := providers.NewMirrorProvider(log, cfg.Library.DataHome)
+	if err != nil {
+		log.Error("failed to initialize playlist mirrors", "err", err)
+		return exitFailed
+	}
+	mirror := services.NewPlaylistMirror(cfg.Mirrors.Interval, &services.MirrorDeps{
+		Log:      log,
+		Spotify:  sp,
+		FS:       fs,
+		Jobs:     jobs,
+		Library:  library,
+		Mirrors:  mirrors,
+		Claims:   claims,
+		Enqueuer: enqueuer,
+		Requests: requests,
+		Format:   cfg.Library.AudioFormat,
+	})
+	if cfg.Mirrors.Interval > 0 {
+		log.Info("playlist syncs scheduled", "interval", cfg.Mirrors.Interval, "playlists", len(mirrors.List()))
+	}
+	h := api.NewHandlers(&api.Deps{
+		Log:          log,
+		Spotify:      sp,
+		FS:           fs,
+		Store:        st,
+		Jobs:         jobs,
+		Queue:        q,
+		Library:      library,
+		Events:       events,
+		Watchlist:    watchlist,
+		Watcher:      watcher,
+		Claims:       claims,
+		Mirrors:      mirrors,
+		Mirror:       mirror,
+		Requests:     requests,
+		Format:       cfg.Library.AudioFormat,
+		SearchLimits: searchLimits(cfg),
+	})
+	router := mux.NewRouter()
+	router.Use(api.RequestIDMiddleware, api.MetricsMiddleware)
+	router.HandleFunc("/", h.HealthHandler).Methods("GET")
+	router.Handle("/search", auth.Require(constants.ScopeSearch, h.Search)).Methods("GET")
+	router.Handle("/download", auth.Require(constants.ScopeDownload, h.Download)).Methods("POST")
+	router.Handle("/download/url", auth.Require(constants.ScopeDownload, h.DownloadURL)).Methods("POST")
+	router.Handle("/requests/{request_id}", auth.Require(constants.ScopeDownload, h.GetRequest)).Methods("GET")
+	router.Handle("/jobs/{request_id}", auth.Require(constants.ScopeDownload, h.ListJobs)).Methods("GET")
+	router.Handle("/jobs/{request_id}", auth.Require(constants.ScopeDownload, h.CancelRequest)).Methods("DELETE")
+	router.Handle("/jobs/{request_id}/{job_id}", auth.Require(constants.ScopeDownload, h.GetJob)).Methods("GET")
+	router.Handle("/jobs/{request_id}/{job_id}", auth.Require(constants.ScopeDownload, h.CancelJob)).Methods("DELETE")
+	router.Handle("/events", auth.RequireStream(constants.ScopeDownload, h.Events)).Methods("GET")
+	router.Handle("/watchlist", auth.Require(constants.ScopeDownload, h.ListWatchlist)).Methods("GET")
+	router.Handle("/watchlist", auth.Require(constants.ScopeDownload, h.WatchArtist)).Methods("POST")
+	router.Handle("/watchlist/{artist_id}", auth.Require(constants.ScopeDownload, h.GetWatchedArtist)).Methods("GET")
+	router.Handle("/watchlist/{artist_id}", auth.Require(constants.ScopeDownload, h.UpdateWatchedArtist)).Methods("PATCH")
+	router.Handle("/watchlist/{artist_id}", auth.Require(constants.ScopeDownload, h.UnwatchArtist)).Methods("DELETE")
+	router.Handle("/watchlist/{artist_id}/check", auth.Require(constants.ScopeDownload, h.CheckWatchedArtist)).Methods("POST")
+	router.Handle("/mirrors", auth.Require(constants.ScopeDownload, h.ListMirrors)).Methods("GET")
+	router.Handle("/mirrors", auth.Require(constants.ScopeDownload, h.MirrorPlaylist)).Methods("POST")
+	router.Handle("/mirrors/{playlist_id}", auth.Require(constants.ScopeDownload, h.GetMirror)).Methods("GET")
+	router.Handle("/mirrors/{playlist_id}", auth.Require(constants.ScopeDownload, h.UpdateMirror)).Methods("PATCH")
+	router.Handle("/mirrors/{playlist_id}", auth.Require(constants.ScopeDownload, h.Unmirror)).Methods("DELETE")
+	router.Handle("/mirrors/{playlist_id}/sync", auth.Require(constants.ScopeDownload, h.SyncMirror)).Methods("POST")
+	router.Handle("/deadletters", auth.Require(constants.ScopeAdmin, h.ListDeadLetters)).Methods("GET")
+	router.Handle("/deadletters/{job_id}/requeue", auth.Require(constants.ScopeAdmin, h.RequeueDeadLetter)).Methods("POST")
+	router.Handle("/metrics", auth.Require(constants.ScopeAdmin, metrics.Handler().ServeHTTP)).Methods("GET")
+
+	server := &http.Server{
+		Handler:      router,
+		Addr:         fmt.Sprintf("0.0.0.0:%s", cfg.Server.Port),
+		WriteTimeout: cfg.Server.WriteTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+	}
+
+	server.RegisterOnShutdown(h.CloseStreams)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	code := 0
+	select {
+	case err := <-serverErr:
+		log.Error("server failed", "err", err)
+		code = exitFailed
+	case <-ctx.Done():
+		log.Info("received shutdown signal")
+	}
+	stop()
+
+	grace := cfg.Server.ShutdownGracePeriod
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	log.Info("shutting down", "grace_period", grace)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Warn("http server did not shut down cleanly", "err", err)
+	}
+	// The watcher and the mirrors queue through the request tracker, so they
+	// stop first.
+	if err := watcher.Shutdown(shutdownCtx); err != nil {
+		log.Warn("watchlist check interrupted", "err", err)
+	}
+	if err := mirror.Shutdown(shutdownCtx); err != nil {
+		log.Warn("playlist sync interrupted", "err", err)
+	}
+	if err := requests.Shutdown(shutdownCtx); err != nil {
+		log.Warn("download requests only partly queued", "err", err)
+	}
+	if err := q.Shutdown(shutdownCtx); err != nil {
+		log.Warn("download queue interrupted before all jobs finished", "err", err)
+	}
+	if webhooks != nil {
+		if err := webhooks.Shutdown(shutdownCtx); err != nil {
+			log.Warn("pending webhook deliveries abandoned", "err", err)
+		}
+	}
+	st.Shutdown()
+	if err := jobs.Close(); err != nil {
+		log.Error("failed to close job store", "err", err)
+	}
+	log.Info("shutdown complete")
+	return code
+}
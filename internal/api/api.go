@@ -2,35 +2,99 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/zmb3/spotify/v2"
 
 	"audio-scraper/internal/constants"
 	"audio-scraper/internal/logger"
 	"audio-scraper/internal/models"
 	"audio-scraper/internal/ports"
+	"audio-scraper/internal/services"
 )
 
 type Deps struct {
 	Log     ports.Logger
 	Spotify ports.SpotifyProvider
+	FS      ports.FSProvider
 	Store   ports.StoreProvider
+	Jobs    ports.JobStoreProvider
 	Queue   ports.DownloadQueue
+	Library ports.LibraryProvider
+	Events  ports.EventBus
+	// Watchlist and Watcher serve the watchlist endpoints.
+	Watchlist ports.WatchlistProvider
+	Watcher   *services.Watcher
+	// Claims records which tracks each download request uses.
+	Claims ports.ClaimProvider
+	// Mirrors and Mirror serve the mirror endpoints.
+	Mirrors ports.MirrorProvider
+	Mirror  *services.PlaylistMirror
+	// Requests queues download requests in the background.
+	Requests *services.RequestTracker
+	// Format is the output format used when a request does not pick one.
+	Format       constants.AudioFormat
+	SearchLimits services.SearchLimits
 }
 
 type Handlers struct {
 	log     ports.Logger
 	spotify ports.SpotifyProvider
+	fs      ports.FSProvider
 	store   ports.StoreProvider
+	jobs    ports.JobStoreProvider
 	queue   ports.DownloadQueue
+	library ports.LibraryProvider
+	events  ports.EventBus
+	format  constants.AudioFormat
+	limits  services.SearchLimits
+
+	watchlist ports.WatchlistProvider
+	watcher   *services.Watcher
+	mirrors   ports.MirrorProvider
+	mirror    *services.PlaylistMirror
+	enqueuer  *services.Enqueuer
+	requests  *services.RequestTracker
+
+	// closing ends open event streams when the server shuts down.
+	closing     chan struct{}
+	closingOnce sync.Once
 }
 
 func NewHandlers(deps *Deps) *Handlers {
-	return &Handlers{log: deps.Log, spotify: deps.Spotify, store: deps.Store, queue: deps.Queue}
+	return &Handlers{
+		log:       deps.Log,
+		spotify:   deps.Spotify,
+		fs:        deps.FS,
+		store:     deps.Store,
+		jobs:      deps.Jobs,
+		queue:     deps.Queue,
+		library:   deps.Library,
+		events:    deps.Events,
+		format:    deps.Format,
+		limits:    deps.SearchLimits,
+		watchlist: deps.Watchlist,
+		watcher:   deps.Watcher,
+		mirrors:   deps.Mirrors,
+		mirror:    deps.Mirror,
+		enqueuer: services.NewEnqueuer(&services.EnqueuerDeps{
+			Spotify: deps.Spotify,
+			FS:      deps.FS,
+			Queue:   deps.Queue,
+			Library: deps.Library,
+			Claims:  deps.Claims,
+		}),
+		requests: deps.Requests,
+		closing:  make(chan struct{}),
+	}
 }
 
 func (h *Handlers) HealthHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,7 +115,7 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 	}
 	queries := strings.Split(searchQuery, ",")
 
-	var allChoices []models.Choice
+	allChoices := []models.Choice{}
 	for _, query := range queries {
 		query = strings.TrimSpace(query)
 		if query == "" {
@@ -59,34 +123,27 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 		}
 
 		log := log.With("query", query)
-		results, err := h.spotify.Search(logger.Into(ctx, log), query, spotify.SearchTypeArtist|spotify.SearchTypeAlbum|spotify.SearchTypeTrack)
-		if err != nil {
-			log.Error("spotify search failed", "err", err)
-			http.Error(w, "spotify search failed", http.StatusInternalServerError)
-			return
-		}
-
-		choices, err := processSearchData(results, log)
+		choices, err := services.Search(logger.Into(ctx, log), h.spotify, query, h.limits)
 		if err != nil {
-			log.Error("processing search data failed", "err", err)
-			http.Error(w, "processing search data failed", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		allChoices = append(allChoices, choices...)
 	}
 
-	h.store.Set(requestID, allChoices)
-
-	var labels []string
-	for _, choice := range allChoices {
-		labels = append(labels, choice.Label)
+	labels := []string{}
+	for i := range allChoices {
+		allChoices[i].Index = i
+		labels = append(labels, allChoices[i].Label)
 	}
+	h.store.Set(requestID, allChoices)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(models.SearchResponse{
 		RequestID: requestID,
 		Choices:   labels,
+		Results:   allChoices,
 	})
 }
 
@@ -100,6 +157,17 @@ func (h *Handlers) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log = log.With("request_id", req.RequestID)
+	if _, err := services.AlbumTypesFromGroups(req.AlbumGroups); err != nil {
+		log.Warn("invalid album groups", "groups", req.AlbumGroups)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := h.requestFormat(req.Format)
+	if err != nil {
+		log.Warn("invalid audio format", "format", req.Format)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	data, found := h.store.Get(req.RequestID)
 	if !found {
@@ -108,31 +176,256 @@ func (h *Handlers) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Info("download request received", "selections", req.Choices)
-	for _, choice := range req.Choices {
-		c := data.FindByLabel(choice)
-		if c == nil {
-			log.Warn("choice not found in stored data", "choice", choice)
-			http.Error(w, "Choice not found: "+choice, http.StatusBadRequest)
+	log.Info("download request received", "choices", req.Choices, "indexes", req.Indexes, "ids", req.IDs)
+	selected, err := selectChoices(data, req)
+	if err != nil {
+		log.Warn("selection not found in stored data", "err", err)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	batch := h.enqueuer.NewBatch(services.EnqueueOptions{
+		RequestID:   req.RequestID,
+		Format:      format,
+		Force:       req.Force,
+		AlbumGroups: req.AlbumGroups,
+	})
+	progress := h.requests.Go(logger.Into(context.Background(), log), req.RequestID, func(ctx context.Context, record func(services.QueueResult)) {
+		for _, c := range selected {
+			log := logger.From(ctx).With("type", c.Type, "id", c.ID)
+			log.Info("processing choice")
+			record(batch.Queue(logger.Into(ctx, log), c.Type, spotify.ID(c.ID)))
+		}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(progress)
+}
+
+func (h *Handlers) DownloadURL(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	log := h.log.With("handler", "DownloadURL", "request_id", requestID)
+
+	var req models.DownloadURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid download request", "err", err)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	urls := req.URLs
+	if req.URL != "" {
+		urls = append([]string{req.URL}, urls...)
+	}
+	if len(urls) == 0 {
+		log.Warn("download request without URLs")
+		http.Error(w, "Invalid request: no URLs provided", http.StatusBadRequest)
+		return
+	}
+	if _, err := services.AlbumTypesFromGroups(req.AlbumGroups); err != nil {
+		log.Warn("invalid album groups", "groups", req.AlbumGroups)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := h.requestFormat(req.Format)
+	if err != nil {
+		log.Warn("invalid audio format", "format", req.Format)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Resolve every link before queueing anything so a typo does not leave
+	// a half-queued request behind.
+	type entity struct {
+		entityType constants.SpotifyEntityType
+		id         spotify.ID
+	}
+	entities := make([]entity, 0, len(urls))
+	for _, u := range urls {
+		entityType, id, err := services.ParseSpotifyURL(u)
+		if err != nil {
+			log.Warn("invalid spotify URL", "url", u, "err", err)
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		log := log.With("type", c.Type, "id", c.ID)
-		log.Info("processing choice")
+		entities = append(entities, entity{entityType: entityType, id: id})
+	}
 
-		deps := addToQueueDeps{
-			log: log,
-			sp:  h.spotify,
-			q:   h.queue,
+	log.Info("download by URL request received", "urls", urls)
+	batch := h.enqueuer.NewBatch(services.EnqueueOptions{
+		RequestID:   requestID,
+		Format:      format,
+		Force:       req.Force,
+		AlbumGroups: req.AlbumGroups,
+	})
+	progress := h.requests.Go(logger.Into(context.Background(), log), requestID, func(ctx context.Context, record func(services.QueueResult)) {
+		for _, e := range entities {
+			log := logger.From(ctx).With("type", e.entityType, "id", e.id)
+			record(batch.Queue(logger.Into(ctx, log), e.entityType, e.id))
 		}
-		switch c.Type {
-		case constants.SpotifyEntityTypeTrack:
-			addTrackToQueue(deps, req.RequestID, spotify.ID(c.ID))
-		case constants.SpotifyEntityTypeAlbum:
-			addAlbumToQueue(deps, req.RequestID, spotify.ID(c.ID))
-		case constants.SpotifyEntityTypeArtist:
-			addArtistToQueue(deps, req.RequestID, spotify.ID(c.ID))
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(progress)
+}
+
+func (h *Handlers) ListJobs(w http.ResponseWriter, r *http.Request) {
+	requestID := mux.Vars(r)["request_id"]
+	log := h.log.With("handler", "ListJobs", "request_id", requestID)
+
+	statuses := h.jobs.ListByRequest(requestID)
+	if len(statuses) == 0 {
+		// A request still being queued may not have any jobs yet.
+		if _, found := h.requests.Get(requestID); !found {
+			log.Warn("no jobs found for request ID")
+			http.Error(w, "Request ID not found", http.StatusNotFound)
+			return
 		}
+		statuses = []models.JobStatus{}
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (h *Handlers) GetRequest(w http.ResponseWriter, r *http.Request) {
+	requestID := mux.Vars(r)["request_id"]
+	log := h.log.With("handler", "GetRequest", "request_id", requestID)
+
+	progress, found := h.requests.Get(requestID)
+	if !found {
+		log.Warn("request not tracked")
+		http.Error(w, "Request ID not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+func (h *Handlers) GetJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	log := h.log.With("handler", "GetJob", "request_id", vars["request_id"], "job_id", vars["job_id"])
+
+	status, found := h.jobs.Get(vars["job_id"])
+	if !found || status.Job.RequestID != vars["request_id"] {
+		log.Warn("job not found")
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (h *Handlers) CancelRequest(w http.ResponseWriter, r *http.Request) {
+	requestID := mux.Vars(r)["request_id"]
+	log := h.log.With("handler", "CancelRequest", "request_id", requestID)
+
+	// Stop queueing first so no job is added after the cancellation.
+	h.requests.Stop(requestID)
+	cancelled, err := h.queue.CancelRequest(r.Context(), requestID)
+	if _, tracked := h.requests.Get(requestID); tracked && errors.Is(err, ports.ErrJobNotFound) {
+		cancelled, err = []string{}, nil
+	}
+	switch {
+	case errors.Is(err, ports.ErrJobNotFound):
+		log.Warn("no jobs found for request ID")
+		http.Error(w, "Request ID not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Error("failed to cancel request", "err", err, "cancelled", len(cancelled))
+		http.Error(w, "failed to cancel request", http.StatusInternalServerError)
+		return
+	}
+	log.Info("cancelled request", "cancelled", len(cancelled))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.CancelResponse{
+		RequestID: requestID,
+		Cancelled: cancelled,
+	})
+}
+
+func (h *Handlers) CancelJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	log := h.log.With("handler", "CancelJob", "request_id", vars["request_id"], "job_id", vars["job_id"])
+
+	status, found := h.jobs.Get(vars["job_id"])
+	if !found || status.Job.RequestID != vars["request_id"] {
+		log.Warn("job not found")
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	err := h.queue.Cancel(r.Context(), vars["job_id"])
+	switch {
+	case errors.Is(err, ports.ErrJobNotFound):
+		log.Warn("job not found")
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ports.ErrJobNotCancellable):
+		log.Warn("job has already finished")
+		http.Error(w, "Job has already finished", http.StatusConflict)
+		return
+	case err != nil:
+		log.Error("failed to cancel job", "err", err)
+		http.Error(w, "failed to cancel job", http.StatusInternalServerError)
+		return
+	}
+
+	status, _ = h.jobs.Get(vars["job_id"])
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (h *Handlers) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With("handler", "ListDeadLetters")
+
+	statuses := h.jobs.ListByState(constants.JobStateFailed)
+	log.Info("listing dead-lettered jobs", "count", len(statuses))
+	if statuses == nil {
+		statuses = []models.JobStatus{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (h *Handlers) RequeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["job_id"]
+	log := h.log.With("handler", "RequeueDeadLetter", "job_id", jobID)
+
+	err := h.queue.Requeue(r.Context(), jobID)
+	switch {
+	case errors.Is(err, ports.ErrJobNotFound):
+		log.Warn("job not found")
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ports.ErrJobNotRequeueable):
+		log.Warn("job is not dead-lettered")
+		http.Error(w, "Job is not in the dead-letter list", http.StatusConflict)
+		return
+	case err != nil:
+		log.Error("failed to requeue job", "err", err)
+		http.Error(w, "failed to requeue job", http.StatusInternalServerError)
+		return
+	}
+
+	status, _ := h.jobs.Get(jobID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+// requestFormat resolves the output format of a download request, falling
+// back to the configured default.
+func (h *Handlers) requestFormat(format constants.AudioFormat) (constants.AudioFormat, error) {
+	if !format.Valid() {
+		return "", fmt.Errorf("unsupported format %q", format)
+	}
+	if format == "" {
+		return h.format, nil
+	}
+	return format, nil
 }
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/providers"
+)
+
+// quietLogger discards everything, keeping test output readable.
+func quietLogger() ports.Logger {
+	return logger.New(io.Discard, slog.LevelError+1)
+}
+
+func TestDeadLettersListFailedJobs(t *testing.T) {
+	jobs, err := providers.NewJobStoreProvider(quietLogger(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jobs.Close()
+	for _, id := range []string{"failed", "done", "queued"} {
+		if _, err := jobs.Create(models.DownloadJob{ID: id, RequestID: "req"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := jobs.SetState("failed", constants.JobStateFailed, "downloading: connection reset (after 3 attempts)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.SetState("done", constants.JobStateDone, ""); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandlers(&Deps{Log: quietLogger(), Jobs: jobs})
+
+	rec := httptest.NewRecorder()
+	h.ListDeadLetters(rec, httptest.NewRequest("GET", "/deadletters", nil))
+	var deadLetters []models.JobStatus
+	if err := json.NewDecoder(rec.Body).Decode(&deadLetters); err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].Job.ID != "failed" || deadLetters[0].Error == "" {
+		t.Errorf("GET /deadletters = %+v, want the failed job with its error", deadLetters)
+	}
+}
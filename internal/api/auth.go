@@ -0,0 +1,143 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Authenticator checks API keys and their scopes. With no keys configured,
+// which the config only allows when auth is disabled, it lets every request
+// through.
+type Authenticator struct {
+	log  ports.Logger
+	keys []hashedKey
+}
+
+type hashedKey struct {
+	name   string
+	digest [sha256.Size]byte
+	scopes []constants.Scope
+}
+
+func NewAuthenticator(l ports.Logger, keys []models.APIKey) *Authenticator {
+	a := &Authenticator{log: l.With("component", "Authenticator")}
+	for _, key := range keys {
+		a.keys = append(a.keys, hashedKey{
+			name:   key.Name,
+			digest: sha256.Sum256([]byte(key.Key)),
+			scopes: key.Scopes,
+		})
+	}
+	return a
+}
+
+// Enabled reports whether any API keys are configured.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Require wraps next so it only runs for requests carrying a key with scope.
+// Keys are read from "Authorization: Bearer <key>" or the X-API-Key header.
+func (a *Authenticator) Require(scope constants.Scope, next http.HandlerFunc) http.Handler {
+	return a.require(scope, next, false)
+}
+
+// RequireStream is Require for event streams, which also take the key from
+// the api_key query parameter for clients like EventSource that cannot set
+// headers. Keys in URLs end up in proxy and browser logs, so no other route
+// accepts them.
+func (a *Authenticator) RequireStream(scope constants.Scope, next http.HandlerFunc) http.Handler {
+	return a.require(scope, next, true)
+}
+
+func (a *Authenticator) require(scope constants.Scope, next http.HandlerFunc, fromQuery bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next(w, r)
+			return
+		}
+
+		log := a.log.With(
+			"http_request_id", w.Header().Get(requestIDHeader),
+			"method", r.Method,
+			"route", routeOf(r),
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr,
+			"scope", scope,
+		)
+		presented := apiKeyFrom(r, fromQuery)
+		if presented == "" {
+			log.Warn("request without api key")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="audio-scraper"`)
+			http.Error(w, "missing API key", http.StatusUnauthorized)
+			return
+		}
+		key := a.lookup(presented)
+		if key == nil {
+			log.Warn("request with unknown api key")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="audio-scraper", error="invalid_token"`)
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		log = log.With("key", key.name)
+		if !slices.Contains(key.scopes, scope) && !slices.Contains(key.scopes, constants.ScopeAdmin) {
+			log.Warn("api key lacks scope")
+			http.Error(w, "API key lacks the "+string(scope)+" scope", http.StatusForbidden)
+			return
+		}
+
+		log.Debug("authenticated request")
+		next(w, r)
+	})
+}
+
+func (a *Authenticator) lookup(presented string) *hashedKey {
+	digest := sha256.Sum256([]byte(presented))
+	var found *hashedKey
+	// Compare against every key so timing does not reveal which one matched.
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(digest[:], a.keys[i].digest[:]) == 1 {
+			found = &a.keys[i]
+		}
+	}
+	return found
+}
+
+func apiKeyFrom(r *http.Request, fromQuery bool) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if fromQuery {
+		return r.URL.Query().Get("api_key")
+	}
+	return ""
+}
+
+// RequestIDMiddleware tags every response with an X-Request-ID, reusing the
+// caller's if it sent one, so failures can be matched to log lines.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/metrics"
+	"audio-scraper/internal/models"
+)
+
+// authRouter routes a few endpoints the way serve does, each answering 200
+// once past the Authenticator, along with the real /metrics.
+func authRouter(auth *Authenticator) *mux.Router {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	h := &Handlers{log: quietLogger()}
+	router := mux.NewRouter()
+	router.Use(MetricsMiddleware)
+	router.HandleFunc("/", h.HealthHandler).Methods("GET")
+	router.Handle("/search", auth.Require(constants.ScopeSearch, ok)).Methods("GET")
+	router.Handle("/download", auth.Require(constants.ScopeDownload, ok)).Methods("POST")
+	router.Handle("/events", auth.RequireStream(constants.ScopeDownload, ok)).Methods("GET")
+	router.Handle("/deadletters", auth.Require(constants.ScopeAdmin, ok)).Methods("GET")
+	router.Handle("/metrics", auth.Require(constants.ScopeAdmin, metrics.Handler().ServeHTTP)).Methods("GET")
+	return router
+}
+
+func TestAuthenticatorChecksKeysAndScopes(t *testing.T) {
+	auth := NewAuthenticator(quietLogger(), []models.APIKey{
+		{Name: "phone", Key: "search-key", Scopes: []constants.Scope{constants.ScopeSearch}},
+		{Name: "server", Key: "download-key", Scopes: []constants.Scope{constants.ScopeSearch, constants.ScopeDownload}},
+		{Name: "ops", Key: "admin-key", Scopes: []constants.Scope{constants.ScopeAdmin}},
+	})
+	router := authRouter(auth)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		header  string
+		value   string
+		want    int
+		wantErr string
+	}{
+		{name: "open health", method: "GET", target: "/", want: http.StatusOK},
+		{name: "missing key", method: "GET", target: "/search?q=x", want: http.StatusUnauthorized},
+		{name: "wrong key", method: "GET", target: "/search?q=x", header: "X-API-Key", value: "nope", want: http.StatusUnauthorized, wantErr: `error="invalid_token"`},
+		{name: "bearer key", method: "GET", target: "/search?q=x", header: "Authorization", value: "Bearer search-key", want: http.StatusOK},
+		{name: "header key", method: "POST", target: "/download", header: "X-API-Key", value: "download-key", want: http.StatusOK},
+		{name: "insufficient scope", method: "POST", target: "/download", header: "X-API-Key", value: "search-key", want: http.StatusForbidden},
+		{name: "admin-only route", method: "GET", target: "/deadletters", header: "X-API-Key", value: "download-key", want: http.StatusForbidden},
+		{name: "admin route", method: "GET", target: "/deadletters", header: "X-API-Key", value: "admin-key", want: http.StatusOK},
+		{name: "metrics without a key", method: "GET", target: "/metrics", want: http.StatusUnauthorized},
+		{name: "metrics for a download key", method: "GET", target: "/metrics", header: "X-API-Key", value: "download-key", want: http.StatusForbidden},
+		{name: "metrics for an admin key", method: "GET", target: "/metrics", header: "X-API-Key", value: "admin-key", want: http.StatusOK},
+		{name: "admin grants every scope", method: "POST", target: "/download", header: "X-API-Key", value: "admin-key", want: http.StatusOK},
+		{name: "query key on stream", method: "GET", target: "/events?api_key=download-key", want: http.StatusOK},
+		{name: "query key elsewhere", method: "GET", target: "/search?q=x&api_key=search-key", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+			if tt.wantErr != "" && !strings.Contains(rec.Header().Get("WWW-Authenticate"), tt.wantErr) {
+				t.Errorf("WWW-Authenticate = %q, want %s", rec.Header().Get("WWW-Authenticate"), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorWithoutKeysLetsEverythingThrough(t *testing.T) {
+	router := authRouter(NewAuthenticator(quietLogger(), nil))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/deadletters", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /deadletters with auth disabled = %d, want 200", rec.Code)
+	}
+}
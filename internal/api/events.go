@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+)
+
+// heartbeatInterval keeps idle event streams from being closed by proxies.
+const heartbeatInterval = 15 * time.Second
+
+// Events streams job events as Server-Sent Events, optionally limited to one
+// request. A request's stream opens with the current state of each of its
+// jobs.
+func (h *Handlers) Events(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestID := r.URL.Query().Get("request_id")
+	log := h.log.With("handler", "Events", "request_id", requestID)
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout would otherwise end the stream.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn("failed to clear write deadline", "err", err)
+	}
+
+	events, unsubscribe := h.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if requestID != "" {
+		for _, status := range h.jobs.ListByRequest(requestID) {
+			writeEvent(w, models.JobEvent{
+				Type:      constants.JobEventTypeState,
+				JobID:     status.Job.ID,
+				RequestID: status.Job.RequestID,
+				State:     status.State,
+				Error:     status.Error,
+				Time:      status.UpdatedAt,
+			})
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Error("event stream not supported", "err", err)
+		return
+	}
+	log.Info("event stream opened")
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("event stream closed")
+			return
+		case <-h.closing:
+			log.Info("closing event stream for shutdown")
+			return
+		case <-heartbeat.C:
+			io.WriteString(w, ": keepalive\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if requestID != "" && event.RequestID != requestID {
+				continue
+			}
+			writeEvent(w, event)
+		}
+		if err := rc.Flush(); err != nil {
+			log.Info("event stream closed", "err", err)
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event models.JobEvent) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+// CloseStreams ends every open event stream, which would otherwise hold up a
+// graceful server shutdown.
+func (h *Handlers) CloseStreams() {
+	h.closingOnce.Do(func() { close(h.closing) })
+}
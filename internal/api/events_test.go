@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/providers"
+	"audio-scraper/internal/services"
+)
+
+// readEvent reads the next event off a Server-Sent Events stream.
+func readEvent(t *testing.T, stream *bufio.Reader) (string, models.JobEvent) {
+	t.Helper()
+	var name string
+	var event models.JobEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, event
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestEventsStreamsARequestsJobs(t *testing.T) {
+	jobs, err := providers.NewJobStoreProvider(quietLogger(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jobs.Close()
+	if _, err := jobs.Create(models.DownloadJob{ID: "a", RequestID: "req"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Create(models.DownloadJob{ID: "other", RequestID: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	events := services.NewEventBus(quietLogger())
+	h := NewHandlers(&Deps{Log: quietLogger(), Jobs: jobs, Events: events})
+	server := httptest.NewServer(http.HandlerFunc(h.Events))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?request_id=req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	stream := bufio.NewReader(resp.Body)
+
+	// The stream opens with the current state of the request's jobs.
+	name, event := readEvent(t, stream)
+	if name != string(constants.JobEventTypeState) || event.JobID != "a" || event.State != constants.JobStateQueued {
+		t.Fatalf("first event = %s %+v, want job a queued", name, event)
+	}
+
+	// Events of other requests are left out.
+	events.Publish(models.JobEvent{Type: constants.JobEventTypeState, JobID: "other", RequestID: "other", State: constants.JobStateSearching})
+	events.Publish(models.JobEvent{Type: constants.JobEventTypeProgress, JobID: "a", RequestID: "req", State: constants.JobStateDownloading, Progress: 42})
+	name, event = readEvent(t, stream)
+	if name != string(constants.JobEventTypeProgress) || event.JobID != "a" || event.Progress != 42 {
+		t.Fatalf("next event = %s %+v, want the progress of job a", name, event)
+	}
+
+	// Shutting down ends the stream.
+	h.CloseStreams()
+	if rest, err := io.ReadAll(stream); err != nil || len(rest) != 0 {
+		t.Errorf("stream after CloseStreams = %q, %v, want it ended", rest, err)
+	}
+}
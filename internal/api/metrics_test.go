@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/providers"
+	"audio-scraper/internal/services"
+)
+
+func TestMetricsServeJobAndHTTPCollectors(t *testing.T) {
+	jobs, err := providers.NewJobStoreProvider(quietLogger(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jobs.Close()
+	// Without workers the jobs stay queued until cancelled.
+	pool := services.NewDownloadWorkerPool(0, nil, &services.Deps{Log: quietLogger(), Jobs: jobs, Events: services.NewEventBus(quietLogger())})
+	defer pool.Shutdown(context.Background())
+	for _, id := range []string{"a", "b"} {
+		if err := pool.Enqueue(context.Background(), models.DownloadJob{ID: id, RequestID: "req"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pool.Cancel(context.Background(), "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	router := authRouter(NewAuthenticator(quietLogger(), []models.APIKey{
+		{Name: "ops", Key: "admin-key", Scopes: []constants.Scope{constants.ScopeAdmin}},
+	}))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/deadletters", nil))
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	// Counters are process-wide, so only their series are looked for.
+	for _, want := range []string{
+		"audio_scraper_queue_depth 1",
+		"audio_scraper_active_workers 0",
+		`audio_scraper_job_outcomes_total{error_class="",stage="queued",state="cancelled"} `,
+		`audio_scraper_http_request_duration_seconds_count{code="401",method="GET",route="/deadletters"} `,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("GET /metrics is missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/services"
+)
+
+func (h *Handlers) ListMirrors(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With("handler", "ListMirrors")
+
+	mirrors := h.mirrors.List()
+	log.Info("listing mirrored playlists", "count", len(mirrors))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mirrors)
+}
+
+func (h *Handlers) MirrorPlaylist(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With("handler", "MirrorPlaylist")
+
+	var req models.MirrorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid mirror request", "err", err)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	playlistID, err := services.ParsePlaylistID(req.Playlist)
+	if err != nil {
+		log.Warn("invalid playlist", "playlist", req.Playlist, "err", err)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log = log.With("playlist_id", playlistID)
+	if !req.Format.Valid() {
+		log.Warn("invalid audio format", "format", req.Format)
+		http.Error(w, fmt.Sprintf("Invalid request: unsupported format %q", req.Format), http.StatusBadRequest)
+		return
+	}
+
+	// The first sync runs in the background, so it outlives the request.
+	response, err := h.mirror.Mirror(logger.Into(context.Background(), log), playlistID, req.Format, req.PruneRemoved, req.DeleteRemoved)
+	switch {
+	case errors.Is(err, ports.ErrPlaylistAlreadyMirrored):
+		log.Warn("playlist is already mirrored")
+		http.Error(w, "Playlist is already mirrored", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handlers) GetMirror(w http.ResponseWriter, r *http.Request) {
+	playlistID := mux.Vars(r)["playlist_id"]
+	log := h.log.With("handler", "GetMirror", "playlist_id", playlistID)
+
+	mirror, found := h.mirrors.Get(playlistID)
+	if !found {
+		log.Warn("playlist is not mirrored")
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mirror)
+}
+
+func (h *Handlers) UpdateMirror(w http.ResponseWriter, r *http.Request) {
+	playlistID := mux.Vars(r)["playlist_id"]
+	log := h.log.With("handler", "UpdateMirror", "playlist_id", playlistID)
+
+	var req models.MirrorUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid mirror update request", "err", err)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Format != nil && !req.Format.Valid() {
+		log.Warn("invalid audio format", "format", *req.Format)
+		http.Error(w, fmt.Sprintf("Invalid request: unsupported format %q", *req.Format), http.StatusBadRequest)
+		return
+	}
+
+	mirror, err := h.mirror.Update(playlistID, req)
+	switch {
+	case errors.Is(err, ports.ErrPlaylistNotMirrored):
+		log.Warn("playlist is not mirrored")
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("updated mirrored playlist", "format", mirror.Format, "prune_removed", mirror.PruneRemoved, "delete_removed", mirror.DeleteRemoved)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mirror)
+}
+
+func (h *Handlers) Unmirror(w http.ResponseWriter, r *http.Request) {
+	playlistID := mux.Vars(r)["playlist_id"]
+	log := h.log.With("handler", "Unmirror", "playlist_id", playlistID)
+
+	err := h.mirror.Unmirror(playlistID)
+	switch {
+	case errors.Is(err, ports.ErrPlaylistNotMirrored):
+		log.Warn("playlist is not mirrored")
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("stopped mirroring playlist")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) SyncMirror(w http.ResponseWriter, r *http.Request) {
+	playlistID := mux.Vars(r)["playlist_id"]
+	log := h.log.With("handler", "SyncMirror", "playlist_id", playlistID)
+
+	progress, err := h.mirror.Sync(logger.Into(context.Background(), log), spotify.ID(playlistID))
+	switch {
+	case errors.Is(err, ports.ErrPlaylistNotMirrored):
+		log.Warn("playlist is not mirrored")
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(progress)
+}
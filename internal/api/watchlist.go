@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/services"
+)
+
+func (h *Handlers) ListWatchlist(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With("handler", "ListWatchlist")
+
+	artists := h.watchlist.List()
+	log.Info("listing watched artists", "count", len(artists))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artists)
+}
+
+func (h *Handlers) WatchArtist(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With("handler", "WatchArtist")
+
+	var req models.WatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid watch request", "err", err)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	artistID, err := services.ParseArtistID(req.Artist)
+	if err != nil {
+		log.Warn("invalid artist", "artist", req.Artist, "err", err)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log = log.With("artist_id", artistID)
+	if _, err := services.AlbumTypesFromGroups(req.AlbumGroups); err != nil {
+		log.Warn("invalid album groups", "groups", req.AlbumGroups)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.Format.Valid() {
+		log.Warn("invalid audio format", "format", req.Format)
+		http.Error(w, fmt.Sprintf("Invalid request: unsupported format %q", req.Format), http.StatusBadRequest)
+		return
+	}
+
+	// A backfill queues jobs in the background, so it runs to completion
+	// even if the client goes away.
+	response, err := h.watcher.Watch(logger.Into(context.Background(), log), artistID, req.AlbumGroups, req.Format, req.Backfill)
+	switch {
+	case errors.Is(err, ports.ErrArtistAlreadyWatched):
+		log.Warn("artist is already watched")
+		http.Error(w, "Artist is already on the watchlist", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusCreated
+	if response.Backfill != nil {
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handlers) GetWatchedArtist(w http.ResponseWriter, r *http.Request) {
+	artistID := mux.Vars(r)["artist_id"]
+	log := h.log.With("handler", "GetWatchedArtist", "artist_id", artistID)
+
+	artist, found := h.watchlist.Get(artistID)
+	if !found {
+		log.Warn("artist is not watched")
+		http.Error(w, "Artist not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artist)
+}
+
+func (h *Handlers) UpdateWatchedArtist(w http.ResponseWriter, r *http.Request) {
+	artistID := mux.Vars(r)["artist_id"]
+	log := h.log.With("handler", "UpdateWatchedArtist", "artist_id", artistID)
+
+	var req models.WatchUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid watch update request", "err", err)
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.AlbumGroups != nil {
+		if _, err := services.AlbumTypesFromGroups(*req.AlbumGroups); err != nil {
+			log.Warn("invalid album groups", "groups", *req.AlbumGroups)
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Format != nil && !req.Format.Valid() {
+		log.Warn("invalid audio format", "format", *req.Format)
+		http.Error(w, fmt.Sprintf("Invalid request: unsupported format %q", *req.Format), http.StatusBadRequest)
+		return
+	}
+
+	artist, err := h.watcher.Update(artistID, req)
+	switch {
+	case errors.Is(err, ports.ErrArtistNotWatched):
+		log.Warn("artist is not watched")
+		http.Error(w, "Artist not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("updated watched artist", "groups", artist.AlbumGroups, "format", artist.Format)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artist)
+}
+
+func (h *Handlers) UnwatchArtist(w http.ResponseWriter, r *http.Request) {
+	artistID := mux.Vars(r)["artist_id"]
+	log := h.log.With("handler", "UnwatchArtist", "artist_id", artistID)
+
+	err := h.watcher.Unwatch(artistID)
+	switch {
+	case errors.Is(err, ports.ErrArtistNotWatched):
+		log.Warn("artist is not watched")
+		http.Error(w, "Artist not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("removed artist from watchlist")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) CheckWatchedArtist(w http.ResponseWriter, r *http.Request) {
+	artistID := mux.Vars(r)["artist_id"]
+	log := h.log.With("handler", "CheckWatchedArtist", "artist_id", artistID)
+
+	response, err := h.watcher.Check(logger.Into(context.Background(), log), spotify.ID(artistID))
+	switch {
+	case errors.Is(err, ports.ErrArtistNotWatched):
+		log.Warn("artist is not watched")
+		http.Error(w, "Artist not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
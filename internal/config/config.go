@@ -0,0 +1,498 @@
+// Package config loads the service configuration from an optional YAML file
+// and the environment, which takes precedence over the file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+)
+
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Spotify   Spotify   `yaml:"spotify"`
+	Library   Library   `yaml:"library"`
+	Search    Search    `yaml:"search"`
+	YouTube   YouTube   `yaml:"youtube"`
+	Workers   Workers   `yaml:"workers"`
+	Auth      Auth      `yaml:"auth"`
+	Webhooks  Webhooks  `yaml:"webhooks"`
+	Watchlist Watchlist `yaml:"watchlist"`
+	Mirrors   Mirrors   `yaml:"mirrors"`
+}
+
+type Server struct {
+	Port                string        `yaml:"port"`
+	ReadTimeout         time.Duration `yaml:"read_timeout"`
+	WriteTimeout        time.Duration `yaml:"write_timeout"`
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period"`
+}
+
+type Spotify struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+}
+
+type Library struct {
+	MusicHome    string                `yaml:"music_home"`
+	DataHome     string                `yaml:"data_home"`
+	PathTemplate string                `yaml:"path_template"`
+	AudioFormat  constants.AudioFormat `yaml:"audio_format"`
+}
+
+// Search holds how many results of each kind a search returns and how long
+// they can be downloaded from. Kinds with fewer results leave their share to
+// tracks.
+type Search struct {
+	Tracks    int           `yaml:"tracks"`
+	Albums    int           `yaml:"albums"`
+	Artists   int           `yaml:"artists"`
+	Playlists int           `yaml:"playlists"`
+	ChoiceTTL time.Duration `yaml:"choice_ttl"`
+}
+
+type YouTube struct {
+	MatchThreshold float64 `yaml:"match_threshold"`
+}
+
+type Workers struct {
+	Size  int   `yaml:"size"`
+	Retry Retry `yaml:"retry"`
+}
+
+// Retry is the retry policy of every job stage. A stage setting left at zero
+// falls back to the shared one.
+type Retry struct {
+	Attempts   int           `yaml:"attempts"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	Search     StageRetry    `yaml:"search"`
+	Download   StageRetry    `yaml:"download"`
+	Tag        StageRetry    `yaml:"tag"`
+}
+
+type StageRetry struct {
+	Attempts int           `yaml:"attempts,omitempty"`
+	Backoff  time.Duration `yaml:"backoff,omitempty"`
+}
+
+// Auth holds the API keys. The server refuses to start without any unless
+// Disabled is set, which opens the API to anyone who can reach it.
+type Auth struct {
+	APIKeys  []models.APIKey `yaml:"api_keys"`
+	Disabled bool            `yaml:"disabled,omitempty"`
+}
+
+type Webhooks struct {
+	URLs   []string `yaml:"urls"`
+	Secret string   `yaml:"secret"`
+}
+
+// Watchlist holds how often watched artists are checked for new releases.
+// Zero turns the scheduled checks off.
+type Watchlist struct {
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Mirrors holds how often mirrored playlists are synced. Zero turns the
+// scheduled syncs off.
+type Mirrors struct {
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Default returns the settings used for anything the file and the
+// environment leave out.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:                "8080",
+			ReadTimeout:         15 * time.Second,
+			WriteTimeout:        15 * time.Second,
+			ShutdownGracePeriod: 30 * time.Second,
+		},
+		Library: Library{
+			PathTemplate: constants.DefaultPathTemplate,
+			AudioFormat:  constants.AudioFormatMP3,
+		},
+		Search: Search{
+			Tracks:    10,
+			Albums:    5,
+			Artists:   3,
+			Playlists: 2,
+			ChoiceTTL: 10 * time.Minute,
+		},
+		YouTube: YouTube{MatchThreshold: constants.DefaultMatchThreshold},
+		Workers: Workers{
+			Size: constants.DownloadWorkerPoolSize,
+			Retry: Retry{
+				Attempts:   constants.DefaultRetryAttempts,
+				Backoff:    constants.DefaultRetryBackoff,
+				MaxBackoff: constants.DefaultRetryMaxBackoff,
+			},
+		},
+		Watchlist: Watchlist{Interval: 6 * time.Hour},
+		Mirrors:   Mirrors{Interval: time.Hour},
+	}
+}
+
+// Load reads the YAML file at path, if any, applies environment overrides and
+// validates the result. The config is returned even when it is invalid so it
+// can still be printed.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+	envErr := cfg.applyEnv()
+	if cfg.Library.DataHome == "" && cfg.Library.MusicHome != "" {
+		cfg.Library.DataHome = filepath.Join(cfg.Library.MusicHome, ".audio-scraper")
+	}
+	return cfg, errors.Join(envErr, cfg.Validate())
+}
+
+// applyEnv overrides the file with the environment variables the service has
+// always read.
+func (c *Config) applyEnv() error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	num := func(key string, dst *int) {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	dur := func(key string, dst *time.Duration) {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration such as 30s or 2m", key, v))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str("API_PORT", &c.Server.Port)
+	dur("SHUTDOWN_GRACE_PERIOD", &c.Server.ShutdownGracePeriod)
+	str("SPOTIFY_CLIENT_ID", &c.Spotify.ClientID)
+	str("SPOTIFY_CLIENT_SECRET", &c.Spotify.ClientSecret)
+	str("MUSIC_HOME", &c.Library.MusicHome)
+	str("DATA_HOME", &c.Library.DataHome)
+	str("PATH_TEMPLATE", &c.Library.PathTemplate)
+	if v := os.Getenv("AUDIO_FORMAT"); v != "" {
+		c.Library.AudioFormat = constants.AudioFormat(v)
+	}
+	if v := os.Getenv("YT_MATCH_THRESHOLD"); v != "" {
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("YT_MATCH_THRESHOLD: %q is not a number", v))
+		} else {
+			c.YouTube.MatchThreshold = threshold
+		}
+	}
+	num("WORKER_SIZE", &c.Workers.Size)
+	num("RETRY_ATTEMPTS", &c.Workers.Retry.Attempts)
+	dur("RETRY_BACKOFF", &c.Workers.Retry.Backoff)
+	for stage, retry := range map[string]*StageRetry{
+		"SEARCH":   &c.Workers.Retry.Search,
+		"DOWNLOAD": &c.Workers.Retry.Download,
+		"TAG":      &c.Workers.Retry.Tag,
+	} {
+		num("RETRY_"+stage+"_ATTEMPTS", &retry.Attempts)
+		dur("RETRY_"+stage+"_BACKOFF", &retry.Backoff)
+	}
+	if v := os.Getenv("API_KEYS"); v != "" {
+		keys, err := ParseAPIKeys(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("API_KEYS: %w", err))
+		} else {
+			c.Auth.APIKeys = keys
+		}
+	}
+	if v := os.Getenv("AUTH_DISABLED"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("AUTH_DISABLED: %q is not true or false", v))
+		} else {
+			c.Auth.Disabled = disabled
+		}
+	}
+	if v := os.Getenv("WEBHOOK_URLS"); v != "" {
+		c.Webhooks.URLs = SplitList(v)
+	}
+	str("WEBHOOK_SECRET", &c.Webhooks.Secret)
+	dur("WATCHLIST_INTERVAL", &c.Watchlist.Interval)
+	dur("MIRROR_INTERVAL", &c.Mirrors.Interval)
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting that would keep the service from starting,
+// naming each by its key in the config file.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		fail("server.port", "%q is not a valid port", c.Server.Port)
+	}
+	if c.Server.ReadTimeout < 0 {
+		fail("server.read_timeout", "must not be negative")
+	}
+	if c.Server.WriteTimeout < 0 {
+		fail("server.write_timeout", "must not be negative")
+	}
+	if c.Server.ShutdownGracePeriod < 0 {
+		fail("server.shutdown_grace_period", "must not be negative")
+	}
+
+	if c.Spotify.ClientID == "" {
+		fail("spotify.client_id", "missing, set it or SPOTIFY_CLIENT_ID")
+	}
+	if c.Spotify.ClientSecret == "" {
+		fail("spotify.client_secret", "missing, set it or SPOTIFY_CLIENT_SECRET")
+	}
+
+	if !c.Library.AudioFormat.Valid() {
+		fail("library.audio_format", "unsupported format %q, want mp3, opus, m4a, flac or ogg", c.Library.AudioFormat)
+	}
+
+	for _, count := range []struct {
+		key   string
+		value int
+	}{
+		{"search.tracks", c.Search.Tracks},
+		{"search.albums", c.Search.Albums},
+		{"search.artists", c.Search.Artists},
+		{"search.playlists", c.Search.Playlists},
+	} {
+		if count.value < 0 {
+			fail(count.key, "must not be negative")
+		}
+	}
+	if c.Search.ChoiceTTL <= 0 {
+		fail("search.choice_ttl", "must be positive")
+	}
+
+	if c.YouTube.MatchThreshold <= 0 || c.YouTube.MatchThreshold > 1 {
+		fail("youtube.match_threshold", "%v is outside (0, 1]", c.YouTube.MatchThreshold)
+	}
+
+	if c.Workers.Size <= 0 {
+		fail("workers.size", "must be at least 1")
+	}
+	retry := c.Workers.Retry
+	if retry.Attempts <= 0 {
+		fail("workers.retry.attempts", "must be at least 1")
+	}
+	if retry.Backoff <= 0 {
+		fail("workers.retry.backoff", "must be positive")
+	}
+	if retry.MaxBackoff < 0 {
+		fail("workers.retry.max_backoff", "must not be negative")
+	}
+	for _, stage := range []struct {
+		name  string
+		retry StageRetry
+	}{
+		{"search", retry.Search},
+		{"download", retry.Download},
+		{"tag", retry.Tag},
+	} {
+		if stage.retry.Attempts < 0 {
+			fail("workers.retry."+stage.name+".attempts", "must not be negative")
+		}
+		if stage.retry.Backoff < 0 {
+			fail("workers.retry."+stage.name+".backoff", "must not be negative")
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, key := range c.Auth.APIKeys {
+		field := fmt.Sprintf("auth.api_keys[%d]", i)
+		if key.Name == "" {
+			fail(field+".name", "missing")
+		} else if names[key.Name] {
+			fail(field+".name", "duplicate name %q", key.Name)
+		}
+		names[key.Name] = true
+		if key.Key == "" {
+			fail(field+".key", "missing")
+		}
+		if len(key.Scopes) == 0 {
+			fail(field+".scopes", "missing, want search, download or admin")
+		}
+		for _, scope := range key.Scopes {
+			if !scope.Valid() {
+				fail(field+".scopes", "unknown scope %q", scope)
+			}
+		}
+	}
+
+	for i, target := range c.Webhooks.URLs {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail(fmt.Sprintf("webhooks.urls[%d]", i), "%q is not an http(s) URL", target)
+		}
+	}
+	if len(c.Webhooks.URLs) > 0 && c.Webhooks.Secret == "" {
+		fail("webhooks.secret", "missing, deliveries to webhooks.urls must be signed")
+	}
+
+	if c.Watchlist.Interval < 0 {
+		fail("watchlist.interval", "must not be negative")
+	}
+	if c.Mirrors.Interval < 0 {
+		fail("mirrors.interval", "must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateLibrary reports the settings the commands that read or write the
+// music library need on top of those Validate reports. search only talks to
+// Spotify, so it does not need them.
+func (c *Config) ValidateLibrary() error {
+	if c.Library.MusicHome == "" {
+		return errors.New("library.music_home: missing, set it or MUSIC_HOME")
+	}
+	return nil
+}
+
+// ValidateServe reports the settings that would keep the HTTP server from
+// starting on top of those Validate and ValidateLibrary report. The
+// command-line tools do not serve the API, so they do not need it.
+func (c *Config) ValidateServe() error {
+	var errs []error
+	fail := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	switch {
+	case len(c.Auth.APIKeys) == 0 && !c.Auth.Disabled:
+		fail("auth.api_keys", "missing, set API_KEYS or, to leave the API open to anyone who can reach it, auth.disabled or AUTH_DISABLED=true")
+	case len(c.Auth.APIKeys) > 0 && c.Auth.Disabled:
+		fail("auth.disabled", "set together with auth.api_keys, remove one of them")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the config with credentials masked, for printing.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	mask := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return "<redacted>"
+	}
+	redacted.Spotify.ClientSecret = mask(c.Spotify.ClientSecret)
+	redacted.Webhooks.Secret = mask(c.Webhooks.Secret)
+	redacted.Auth.APIKeys = make([]models.APIKey, len(c.Auth.APIKeys))
+	for i, key := range c.Auth.APIKeys {
+		key.Key = mask(key.Key)
+		redacted.Auth.APIKeys[i] = key
+	}
+	return &redacted
+}
+
+// CheckDirectories creates MUSIC_HOME and DATA_HOME if needed and checks that
+// files can be created in them. Unlike Validate it changes the filesystem, so
+// it is only run by commands about to write there.
+func (c *Config) CheckDirectories() error {
+	var errs []error
+	for _, dir := range []struct{ key, path string }{
+		{"library.music_home", c.Library.MusicHome},
+		{"library.data_home", c.Library.DataHome},
+	} {
+		if dir.path == "" {
+			continue
+		}
+		if err := checkWritable(dir.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s is not writable: %v", dir.key, dir.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkWritable creates dir if needed and checks that files can be created
+// in it.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// ParseAPIKeys reads keys in the API_KEYS format: comma-separated
+// name:key:scopes entries, where scopes are separated by "|", e.g.
+// "phone:3f9c...:search|download,ops:9a1b...:admin".
+func ParseAPIKeys(value string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid API key entry %q, want name:key:scopes", parts[0])
+		}
+		key := models.APIKey{Name: parts[0], Key: parts[1]}
+		for _, scope := range strings.Split(parts[2], "|") {
+			scope := constants.Scope(strings.TrimSpace(scope))
+			if !scope.Valid() {
+				return nil, fmt.Errorf("API key %q: unknown scope %s", key.Name, scope)
+			}
+			key.Scopes = append(key.Scopes, scope)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// SplitList splits a comma-separated setting, dropping empty entries.
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+)
+
+func TestValidateServeRequiresKeysOrOptOut(t *testing.T) {
+	key := models.APIKey{Name: "phone", Key: "k", Scopes: []constants.Scope{constants.ScopeSearch}}
+	tests := []struct {
+		name     string
+		keys     []models.APIKey
+		disabled bool
+		wantKey  string
+	}{
+		{name: "no keys", wantKey: "auth.api_keys"},
+		{name: "keys", keys: []models.APIKey{key}},
+		{name: "disabled", disabled: true},
+		{name: "keys and disabled", keys: []models.APIKey{key}, disabled: true, wantKey: "auth.disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Auth = Auth{APIKeys: tt.keys, Disabled: tt.disabled}
+			err := cfg.ValidateServe()
+			switch {
+			case tt.wantKey == "" && err != nil:
+				t.Fatalf("ValidateServe: %v", err)
+			case tt.wantKey != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantKey+":")):
+				t.Fatalf("ValidateServe = %v, want a problem with %s", err, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestAuthDisabledFromEnv(t *testing.T) {
+	t.Setenv("AUTH_DISABLED", "true")
+	cfg := Default()
+	if err := cfg.applyEnv(); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if !cfg.Auth.Disabled {
+		t.Fatal("AUTH_DISABLED=true did not disable auth")
+	}
+
+	t.Setenv("AUTH_DISABLED", "maybe")
+	if err := Default().applyEnv(); err == nil || !strings.Contains(err.Error(), "AUTH_DISABLED") {
+		t.Fatalf("applyEnv = %v, want an AUTH_DISABLED problem", err)
+	}
+}
+
+func TestValidateLeavesFilesystemAlone(t *testing.T) {
+	musicHome := filepath.Join(t.TempDir(), "music")
+	cfg := Default()
+	cfg.Spotify = Spotify{ClientID: "id", ClientSecret: "secret"}
+	cfg.Library.MusicHome = musicHome
+	cfg.Library.DataHome = filepath.Join(musicHome, ".audio-scraper")
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if _, err := os.Stat(musicHome); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Validate created %s: %v", musicHome, err)
+	}
+
+	if err := cfg.CheckDirectories(); err != nil {
+		t.Fatalf("CheckDirectories: %v", err)
+	}
+	entries, err := os.ReadDir(cfg.Library.DataHome)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("DATA_HOME = %v, %v, want an empty directory", entries, err)
+	}
+
+	blocked := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocked, nil, 0644)
+	cfg.Library.MusicHome = blocked
+	if err := cfg.CheckDirectories(); err == nil || !strings.HasPrefix(err.Error(), "library.music_home:") {
+		t.Fatalf("CheckDirectories = %v, want a library.music_home problem", err)
+	}
+}
+
+func TestMusicHomeOnlyRequiredByLibraryCommands(t *testing.T) {
+	cfg := Default()
+	cfg.Spotify = Spotify{ClientID: "id", ClientSecret: "secret"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate without music_home: %v", err)
+	}
+	if err := cfg.ValidateLibrary(); err == nil || !strings.HasPrefix(err.Error(), "library.music_home:") {
+		t.Fatalf("ValidateLibrary = %v, want a library.music_home problem", err)
+	}
+	cfg.Library.MusicHome = t.TempDir()
+	if err := cfg.ValidateLibrary(); err != nil {
+		t.Fatalf("ValidateLibrary: %v", err)
+	}
+}
@@ -1,12 +1,128 @@
 // Package constants contains constant values used across the application.
 package constants
 
+import "time"
+
 const DownloadWorkerPoolSize = 5
 
+// DefaultPathTemplate lays the library out as album artist / album / track.
+const DefaultPathTemplate = "{album_artist}/{album}/{disc:02}-{track:02} {title}.{ext}"
+
+// DefaultMatchThreshold is the minimum score a YouTube Music candidate needs
+// before it is downloaded.
+const DefaultMatchThreshold = 0.7
+
+// Defaults of the retry policy used for every job stage without its own.
+const (
+	DefaultRetryAttempts   = 3
+	DefaultRetryBackoff    = 5 * time.Second
+	DefaultRetryMaxBackoff = 2 * time.Minute
+)
+
 type SpotifyEntityType string
 
 const (
-	SpotifyEntityTypeTrack  SpotifyEntityType = "track"
-	SpotifyEntityTypeAlbum  SpotifyEntityType = "album"
-	SpotifyEntityTypeArtist SpotifyEntityType = "artist"
+	SpotifyEntityTypeTrack    SpotifyEntityType = "track"
+	SpotifyEntityTypeAlbum    SpotifyEntityType = "album"
+	SpotifyEntityTypeArtist   SpotifyEntityType = "artist"
+	SpotifyEntityTypePlaylist SpotifyEntityType = "playlist"
+)
+
+type AlbumGroup string
+
+const (
+	AlbumGroupAlbum       AlbumGroup = "album"
+	AlbumGroupSingle      AlbumGroup = "single"
+	AlbumGroupCompilation AlbumGroup = "compilation"
+	AlbumGroupAppearsOn   AlbumGroup = "appears_on"
+)
+
+type JobState string
+
+const (
+	JobStateQueued      JobState = "queued"
+	JobStateSearching   JobState = "searching"
+	JobStateDownloading JobState = "downloading"
+	JobStateTagging     JobState = "tagging"
+	JobStateDone        JobState = "done"
+	JobStateFailed      JobState = "failed"
+	JobStateCancelled   JobState = "cancelled"
+)
+
+// Terminal reports whether a job in this state will not be processed any further.
+func (s JobState) Terminal() bool {
+	return s == JobStateDone || s == JobStateFailed || s == JobStateCancelled
+}
+
+// RequestState tells whether the jobs of a download request are still being
+// queued.
+type RequestState string
+
+const (
+	RequestStateQueueing RequestState = "queueing"
+	RequestStateQueued   RequestState = "queued"
 )
+
+type JobEventType string
+
+const (
+	JobEventTypeState    JobEventType = "state"
+	JobEventTypeProgress JobEventType = "progress"
+	// JobEventTypeRequest is published once a request's jobs are all
+	// queued. It carries only the request ID.
+	JobEventTypeRequest JobEventType = "request"
+)
+
+type WebhookEvent string
+
+const (
+	WebhookEventJobDone          WebhookEvent = "job.done"
+	WebhookEventJobFailed        WebhookEvent = "job.failed"
+	WebhookEventRequestCompleted WebhookEvent = "request.completed"
+	WebhookEventArtistRelease    WebhookEvent = "artist.release"
+)
+
+// Scope is a permission granted to an API key. Admin grants every scope.
+type Scope string
+
+const (
+	ScopeSearch   Scope = "search"
+	ScopeDownload Scope = "download"
+	ScopeAdmin    Scope = "admin"
+)
+
+func (s Scope) Valid() bool {
+	switch s {
+	case ScopeSearch, ScopeDownload, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+type AudioFormat string
+
+const (
+	AudioFormatMP3  AudioFormat = "mp3"
+	AudioFormatOpus AudioFormat = "opus"
+	AudioFormatM4A  AudioFormat = "m4a"
+	AudioFormatFLAC AudioFormat = "flac"
+	AudioFormatOGG  AudioFormat = "ogg"
+)
+
+// Valid reports whether f is a supported output format. The empty format is
+// valid and means mp3.
+func (f AudioFormat) Valid() bool {
+	switch f {
+	case "", AudioFormatMP3, AudioFormatOpus, AudioFormatM4A, AudioFormatFLAC, AudioFormatOGG:
+		return true
+	}
+	return false
+}
+
+// Extension is the file extension, without the dot, of files in this format.
+func (f AudioFormat) Extension() string {
+	if f == "" {
+		return string(AudioFormatMP3)
+	}
+	return string(f)
+}
@@ -2,6 +2,7 @@
 package logger
 
 import (
+	"io"
 	"log/slog"
 	"os"
 
@@ -13,8 +14,13 @@ type Logger struct {
 }
 
 func NewLogger() ports.Logger {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+	return New(os.Stdout, slog.LevelDebug)
+}
+
+// New returns a logger writing records of at least level to w.
+func New(w io.Writer, level slog.Level) ports.Logger {
+	logger := slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
 	}))
 	return &Logger{l: logger}
 }
@@ -0,0 +1,104 @@
+// Package metrics defines the Prometheus metrics exported on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "audio_scraper"
+
+// Values of the result label.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Jobs waiting for a worker.",
+	})
+	ActiveWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_workers",
+		Help:      "Workers currently processing a job.",
+	})
+	JobOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_outcomes_total",
+		Help:      "Jobs that finished, by final state, the stage they ended in and, for failures, the class of error.",
+	}, []string{"state", "stage", "error_class"})
+
+	YTSearchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "yt_search_duration_seconds",
+		Help:      "Latency of YouTube Music searches.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 8),
+	}, []string{"result"})
+	YTDLPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ytdlp_duration_seconds",
+		Help:      "Time yt-dlp takes to download and extract a track.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 9),
+	}, []string{"result"})
+
+	SpotifyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spotify_requests_total",
+		Help:      "Spotify Web API calls, counting every page and retry.",
+	}, []string{"call"})
+	SpotifyErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spotify_errors_total",
+		Help:      "Spotify Web API calls that failed.",
+	}, []string{"call"})
+
+	CoverFetchFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cover_fetch_failures_total",
+		Help:      "Cover art downloads that failed while tagging.",
+	})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of API requests by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		QueueDepth,
+		ActiveWorkers,
+		JobOutcomes,
+		YTSearchDuration,
+		YTDLPDuration,
+		SpotifyRequests,
+		SpotifyErrors,
+		CoverFetchFailures,
+		HTTPRequestDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Result returns the result label value for err.
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOK
+}
@@ -1,42 +1,331 @@
 // Package models defines data models used across the audio scraper service.
 package models
 
-import "audio-scraper/internal/constants"
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+
+	"audio-scraper/internal/constants"
+)
+
+// APIKey is a credential accepted by the API and the scopes it grants.
+type APIKey struct {
+	Name   string
+	Key    string
+	Scopes []constants.Scope
+}
 
 type Choice struct {
-	Type  constants.SpotifyEntityType `json:"type"`
-	ID    string                      `json:"id"`
-	Label string                      `json:"label"`
+	// Index is the position of the choice in its search response.
+	Index     int                         `json:"index"`
+	Type      constants.SpotifyEntityType `json:"type"`
+	ID        string                      `json:"id"`
+	Label     string                      `json:"label"`
+	Thumbnail string                      `json:"thumbnail,omitempty"`
 }
 
 type Choices []Choice
 
+// FindByLabel returns the first choice with the given label. Labels that
+// differ only in whitespace, case or Unicode normalization match, so a label
+// typed by hand finds "Beyoncé" whether the é is composed or not.
 func (choices Choices) FindByLabel(label string) *Choice {
 	for _, choice := range choices {
 		if choice.Label == label {
 			return &choice
 		}
 	}
+	label = normalizeLabel(label)
+	for _, choice := range choices {
+		if normalizeLabel(choice.Label) == label {
+			return &choice
+		}
+	}
+	return nil
+}
+
+// normalizeLabel collapses whitespace and case folds label, then composes it
+// to NFC; folding can decompose characters, so composing comes last.
+func normalizeLabel(label string) string {
+	label = strings.Join(strings.Fields(label), " ")
+	return norm.NFC.String(cases.Fold().String(label))
+}
+
+func (choices Choices) FindByIndex(index int) *Choice {
+	for _, choice := range choices {
+		if choice.Index == index {
+			return &choice
+		}
+	}
+	return nil
+}
+
+// FindByID returns the choice for a Spotify ID, given bare or as a
+// spotify:<type>:<id> URI.
+func (choices Choices) FindByID(id string) *Choice {
+	if parts := strings.Split(id, ":"); len(parts) == 3 && parts[0] == "spotify" {
+		id = parts[2]
+	}
+	for _, choice := range choices {
+		if choice.ID == id {
+			return &choice
+		}
+	}
 	return nil
 }
 
 type SearchResponse struct {
-	RequestID string   `json:"request_id"`
-	Choices   []string `json:"choices"`
+	RequestID string `json:"request_id"`
+	// Choices holds the labels of Results, in the same order.
+	Choices []string `json:"choices"`
+	Results []Choice `json:"results"`
 }
 
+// DownloadRequest selects choices of an earlier search by label, by index or
+// by Spotify ID. Every selection is queued once.
 type DownloadRequest struct {
+	RequestID   string                 `json:"request_id"`
+	Choices     []string               `json:"choices,omitempty"`
+	Indexes     []int                  `json:"indexes,omitempty"`
+	IDs         []string               `json:"ids,omitempty"`
+	AlbumGroups []constants.AlbumGroup `json:"album_groups,omitempty"`
+	Format      constants.AudioFormat  `json:"format,omitempty"`
+	Force       bool                   `json:"force,omitempty"`
+}
+
+type DownloadURLRequest struct {
+	URL         string                 `json:"url,omitempty"`
+	URLs        []string               `json:"urls,omitempty"`
+	AlbumGroups []constants.AlbumGroup `json:"album_groups,omitempty"`
+	Format      constants.AudioFormat  `json:"format,omitempty"`
+	Force       bool                   `json:"force,omitempty"`
+}
+
+// RequestProgress reports how far queueing a download request has got. Jobs
+// lists the jobs queued so far; once State is queued it lists them all.
+type RequestProgress struct {
+	RequestID string                 `json:"request_id"`
+	State     constants.RequestState `json:"state"`
+	Jobs      []string               `json:"jobs"`
+	Skipped   int                    `json:"skipped"`
+	Failed    int                    `json:"failed"`
+}
+
+type CancelResponse struct {
 	RequestID string   `json:"request_id"`
-	Choices   []string `json:"choices"`
+	Cancelled []string `json:"cancelled"`
 }
 
 type DownloadJob struct {
-	RequestID    string
-	TrackID      string
-	Track        string
-	Album        string
-	Artist       string
-	ReleaseDate  string
-	TrackNumber  int
-	ThumbnailURL string
+	ID           string                `json:"id"`
+	RequestID    string                `json:"request_id"`
+	TrackID      string                `json:"track_id"`
+	AlbumID      string                `json:"album_id"`
+	Track        string                `json:"track"`
+	Album        string                `json:"album"`
+	Artist       string                `json:"artist"`
+	Artists      []string              `json:"artists,omitempty"`
+	AlbumArtist  string                `json:"album_artist"`
+	ReleaseDate  string                `json:"release_date"`
+	TrackNumber  int                   `json:"track_number"`
+	TrackTotal   int                   `json:"track_total,omitempty"`
+	DiscNumber   int                   `json:"disc_number"`
+	DiscTotal    int                   `json:"disc_total,omitempty"`
+	DurationMs   int                   `json:"duration_ms"`
+	ISRC         string                `json:"isrc,omitempty"`
+	Genres       []string              `json:"genres,omitempty"`
+	Copyright    string                `json:"copyright,omitempty"`
+	Compilation  bool                  `json:"compilation,omitempty"`
+	ThumbnailURL string                `json:"thumbnail_url"`
+	Format       constants.AudioFormat `json:"format,omitempty"`
+	// Path is the library file of a track that was skipped because the
+	// library already had it.
+	Path string `json:"path,omitempty"`
+}
+
+// JobEvent reports a job state transition or, while a job is downloading, how
+// far the download has got.
+type JobEvent struct {
+	Type      constants.JobEventType `json:"type"`
+	JobID     string                 `json:"job_id"`
+	RequestID string                 `json:"request_id"`
+	State     constants.JobState     `json:"state"`
+	Error     string                 `json:"error,omitempty"`
+	Progress  float64                `json:"progress,omitempty"`
+	Time      time.Time              `json:"time"`
+}
+
+// WebhookPayload is the body posted to webhook targets. Job is set for job
+// events and Request for request events.
+type WebhookPayload struct {
+	Event   constants.WebhookEvent `json:"event"`
+	Time    time.Time              `json:"time"`
+	Job     *JobStatus             `json:"job,omitempty"`
+	Request *RequestSummary        `json:"request,omitempty"`
+	Release *Release               `json:"release,omitempty"`
+}
+
+// RequestSummary counts the outcomes of the jobs of a finished request.
+type RequestSummary struct {
+	RequestID string `json:"request_id"`
+	Total     int    `json:"total"`
+	Done      int    `json:"done"`
+	Failed    int    `json:"failed"`
+	Cancelled int    `json:"cancelled"`
+}
+
+// WatchedArtist is an artist whose new releases are queued as they come out.
+// AlbumGroups limits which releases are downloaded; every release is recorded
+// in KnownReleases either way, so widening the groups later does not pull in
+// the back catalogue.
+type WatchedArtist struct {
+	ArtistID      string                 `json:"artist_id"`
+	Name          string                 `json:"name"`
+	AlbumGroups   []constants.AlbumGroup `json:"album_groups,omitempty"`
+	Format        constants.AudioFormat  `json:"format,omitempty"`
+	KnownReleases []string               `json:"known_releases"`
+	CreatedAt     time.Time              `json:"created_at"`
+	CheckedAt     time.Time              `json:"checked_at"`
+	LastError     string                 `json:"last_error,omitempty"`
+}
+
+// WatchRequest adds an artist, given as an ID, URI or link, to the watchlist.
+// Backfill downloads the releases already out instead of only later ones.
+type WatchRequest struct {
+	Artist      string                 `json:"artist"`
+	AlbumGroups []constants.AlbumGroup `json:"album_groups,omitempty"`
+	Format      constants.AudioFormat  `json:"format,omitempty"`
+	Backfill    bool                   `json:"backfill,omitempty"`
+}
+
+// WatchResponse answers a watch request. Backfill lists the releases being
+// queued when the request asked for the existing releases too.
+type WatchResponse struct {
+	Artist   WatchedArtist       `json:"artist"`
+	Backfill *WatchCheckResponse `json:"backfill,omitempty"`
+}
+
+// WatchUpdateRequest changes the settings of a watched artist. Fields left
+// out are kept.
+type WatchUpdateRequest struct {
+	AlbumGroups *[]constants.AlbumGroup `json:"album_groups,omitempty"`
+	Format      *constants.AudioFormat  `json:"format,omitempty"`
+}
+
+// Release is a new release of a watched artist and the request its tracks
+// are queued under. Jobs is only known once the release is queued, when the
+// notifier is told.
+type Release struct {
+	ArtistID    string               `json:"artist_id"`
+	Artist      string               `json:"artist"`
+	AlbumID     string               `json:"album_id"`
+	Album       string               `json:"album"`
+	AlbumGroup  constants.AlbumGroup `json:"album_group"`
+	ReleaseDate string               `json:"release_date"`
+	RequestID   string               `json:"request_id"`
+	Jobs        int                  `json:"jobs,omitempty"`
+}
+
+// WatchCheckResponse lists the new releases a check of a watched artist
+// found. Each is queued in the background under a request of its own, whose
+// progress is under /requests/{request_id}.
+type WatchCheckResponse struct {
+	ArtistID string    `json:"artist_id"`
+	Releases []Release `json:"releases"`
+}
+
+// MirroredPlaylist is a Spotify playlist kept in sync with a local playlist
+// file. Name is the playlist's name when mirroring started; the file keeps
+// that name so players referencing it do not lose it on a rename. Tracks
+// lists the playlist as of the last sync, followed by tracks since removed
+// from it when PruneRemoved is off.
+type MirroredPlaylist struct {
+	PlaylistID string                `json:"playlist_id"`
+	Name       string                `json:"name"`
+	Format     constants.AudioFormat `json:"format,omitempty"`
+	// PruneRemoved drops tracks removed from the Spotify playlist from the
+	// playlist file; DeleteRemoved also deletes their audio when nothing
+	// else uses it.
+	PruneRemoved  bool          `json:"prune_removed"`
+	DeleteRemoved bool          `json:"delete_removed"`
+	Path          string        `json:"path,omitempty"`
+	SnapshotID    string        `json:"snapshot_id,omitempty"`
+	Tracks        []MirrorTrack `json:"tracks"`
+	CreatedAt     time.Time     `json:"created_at"`
+	SyncedAt      time.Time     `json:"synced_at"`
+	LastError     string        `json:"last_error,omitempty"`
+	// LastSync is what the last sync changed.
+	LastSync *MirrorSyncResult `json:"last_sync,omitempty"`
+}
+
+// MirrorTrack is one entry of a mirrored playlist. Owned marks tracks the
+// mirror downloaded itself rather than found in the library; only those are
+// ever deleted.
+type MirrorTrack struct {
+	Job     DownloadJob `json:"job"`
+	Owned   bool        `json:"owned,omitempty"`
+	Removed bool        `json:"removed,omitempty"`
+}
+
+// MirrorRequest starts mirroring a playlist, given as an ID, URI or link.
+type MirrorRequest struct {
+	Playlist      string                `json:"playlist"`
+	Format        constants.AudioFormat `json:"format,omitempty"`
+	PruneRemoved  bool                  `json:"prune_removed,omitempty"`
+	DeleteRemoved bool                  `json:"delete_removed,omitempty"`
+}
+
+// MirrorUpdateRequest changes the settings of a mirrored playlist. Fields
+// left out are kept.
+type MirrorUpdateRequest struct {
+	Format        *constants.AudioFormat `json:"format,omitempty"`
+	PruneRemoved  *bool                  `json:"prune_removed,omitempty"`
+	DeleteRemoved *bool                  `json:"delete_removed,omitempty"`
+}
+
+// MirrorSyncResult reports what a sync of a mirrored playlist changed.
+// Removed counts tracks newly gone from the Spotify playlist and Deleted the
+// files deleted because of removals. The jobs of the sync are listed under
+// its request.
+type MirrorSyncResult struct {
+	RequestID string `json:"request_id"`
+	Added     int    `json:"added"`
+	Removed   int    `json:"removed"`
+	Deleted   int    `json:"deleted"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+}
+
+// MirrorResponse answers a mirror request with the mirror and the progress
+// of its first sync, which runs in the background.
+type MirrorResponse struct {
+	Mirror MirroredPlaylist `json:"mirror"`
+	Sync   RequestProgress  `json:"sync"`
+}
+
+// LibraryStats summarises a library scan.
+type LibraryStats struct {
+	Files      int `json:"files"`
+	Unreadable int `json:"unreadable"`
+	TrackIDs   int `json:"track_ids"`
+	ISRCs      int `json:"isrcs"`
+}
+
+type JobStatus struct {
+	Job       DownloadJob        `json:"job"`
+	State     constants.JobState `json:"state"`
+	Error     string             `json:"error,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+type YTCandidate struct {
+	VideoID    string   `json:"video_id"`
+	Title      string   `json:"title"`
+	Artists    []string `json:"artists"`
+	Album      string   `json:"album"`
+	DurationMs int      `json:"duration_ms"`
 }
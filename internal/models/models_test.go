@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestFindByLabel(t *testing.T) {
+	choices := Choices{
+		{Index: 0, ID: "composed", Label: "Artist: Beyonc\u00e9"},
+		{Index: 1, ID: "spaced", Label: "Album:  OK   Computer"},
+		{Index: 2, ID: "german", Label: "Track: Straße"},
+		{Index: 3, ID: "exact", Label: "Track: Song"},
+		{Index: 4, ID: "exact-case", Label: "Track: SONG"},
+	}
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"Artist: Beyonc\u00e9", "composed"},
+		{"Artist: Beyonce\u0301", "composed"},
+		{"artist: BEYONCE\u0301", "composed"},
+		{" album: ok computer ", "spaced"},
+		{"track: STRASSE", "german"},
+		{"Track: SONG", "exact-case"},
+		{"track: song", "exact"},
+		{"Artist: Beyonce", ""},
+	}
+	for _, tt := range tests {
+		got := choices.FindByLabel(tt.label)
+		switch {
+		case tt.want == "" && got != nil:
+			t.Errorf("FindByLabel(%q) = %q, want no match", tt.label, got.ID)
+		case tt.want != "" && (got == nil || got.ID != tt.want):
+			t.Errorf("FindByLabel(%q) = %v, want %q", tt.label, got, tt.want)
+		}
+	}
+}
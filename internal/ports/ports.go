@@ -4,10 +4,25 @@ package ports
 
 import (
 	"context"
+	"errors"
 
 	"audio-scraper/internal/models"
 )
 
+var (
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobNotRequeueable = errors.New("job is not in the dead-letter list")
+	ErrJobNotCancellable = errors.New("job has already finished")
+	ErrJobFinished       = errors.New("job has already finished")
+	ErrNoConfidentMatch  = errors.New("no confident yt match")
+
+	ErrArtistNotWatched     = errors.New("artist is not on the watchlist")
+	ErrArtistAlreadyWatched = errors.New("artist is already on the watchlist")
+
+	ErrPlaylistNotMirrored     = errors.New("playlist is not mirrored")
+	ErrPlaylistAlreadyMirrored = errors.New("playlist is already mirrored")
+)
+
 type Logger interface {
 	Debug(msg string, args ...any)
 	Info(msg string, args ...any)
@@ -18,5 +33,23 @@ type Logger interface {
 
 type DownloadQueue interface {
 	Enqueue(ctx context.Context, job models.DownloadJob) error
-	Shutdown()
+	Requeue(ctx context.Context, jobID string) error
+	Cancel(ctx context.Context, jobID string) error
+	CancelRequest(ctx context.Context, requestID string) ([]string, error)
+	Shutdown(ctx context.Context) error
+}
+
+// EventBus fans job events out to every subscriber. Subscribers that fall
+// behind miss events rather than block publishers, except those following
+// state and request events only, which get every one of them.
+type EventBus interface {
+	Publish(event models.JobEvent)
+	Subscribe() (<-chan models.JobEvent, func())
+	SubscribeStates() (<-chan models.JobEvent, func())
+}
+
+// ReleaseNotifier is told about every new release of a watched artist that
+// was queued.
+type ReleaseNotifier interface {
+	NotifyRelease(release models.Release)
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/zmb3/spotify/v2"
 
+	"audio-scraper/internal/constants"
 	"audio-scraper/internal/models"
 )
 
@@ -12,21 +13,98 @@ type SpotifyProvider interface {
 	Search(ctx context.Context, query string, t spotify.SearchType, opts ...spotify.RequestOption) (*spotify.SearchResult, error)
 	GetTrack(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullTrack, error)
 	GetAlbum(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullAlbum, error)
-	GetArtist(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.SimpleAlbumPage, error)
+	GetArtist(ctx context.Context, id spotify.ID) (*spotify.FullArtist, error)
+	GetAlbumTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) ([]spotify.SimpleTrack, error)
+	GetArtistAlbums(ctx context.Context, id spotify.ID, albumTypes []spotify.AlbumType, opts ...spotify.RequestOption) ([]spotify.SimpleAlbum, error)
+	GetPlaylist(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullPlaylist, error)
+	GetPlaylistTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) ([]spotify.FullTrack, error)
 }
 
 type StoreProvider interface {
 	Set(key string, choices models.Choices)
 	Get(key string) (models.Choices, bool)
 	Delete(key string)
+	Shutdown()
+}
+
+type JobStoreProvider interface {
+	Create(job models.DownloadJob) (models.JobStatus, error)
+	// SetState moves a job to state. A finished job only moves from failed
+	// back to queued; any other change returns ErrJobFinished.
+	SetState(id string, state constants.JobState, reason string) (models.JobStatus, error)
+	Get(id string) (models.JobStatus, bool)
+	Claim(state constants.JobState) (models.JobStatus, bool)
+	ListByRequest(requestID string) []models.JobStatus
+	ListByState(state constants.JobState) []models.JobStatus
+	Close() error
 }
 
 type YTProvider interface {
-	Search(ctx context.Context, track string, album string, artist string) (string, error)
-	Download(ctx context.Context, path string, videoURL string) error
+	Search(ctx context.Context, job *models.DownloadJob) (string, error)
+	// Download reports progress, as a percentage, while it runs.
+	Download(ctx context.Context, path string, videoURL string, format constants.AudioFormat, progress func(percent float64)) error
+}
+
+// YTCandidateSource returns YouTube Music song results for a query. It is the
+// seam between fetching candidates and scoring them.
+type YTCandidateSource interface {
+	Search(ctx context.Context, query string) ([]models.YTCandidate, error)
 }
 
 type FSProvider interface {
-	InitializePath(ctx context.Context, job *models.DownloadJob) (string, error)
+	StagePath(ctx context.Context, job *models.DownloadJob) (string, error)
 	TagFile(ctx context.Context, filePath string, job *models.DownloadJob) error
+	// ReadTrackIDs returns the Spotify track ID and ISRC tagged in a file.
+	ReadTrackIDs(ctx context.Context, filePath string) (trackID string, isrc string, err error)
+	Finalize(ctx context.Context, stagedPath string, job *models.DownloadJob) (string, error)
+	Discard(ctx context.Context, stagedPath string)
+	// CleanStaging removes staging files left by processes that are no
+	// longer running.
+	CleanStaging(ctx context.Context) error
+	WritePlaylist(ctx context.Context, name string, jobs []models.DownloadJob) (string, error)
+	// RemoveTrack deletes a library file that no playlist besides
+	// keepPlaylist lists, reporting whether it did.
+	RemoveTrack(ctx context.Context, path string, keepPlaylist string) (bool, error)
+}
+
+// LibraryProvider indexes the tracks already present under MUSIC_HOME by
+// Spotify track ID and ISRC.
+type LibraryProvider interface {
+	Scan(ctx context.Context) (models.LibraryStats, error)
+	Lookup(trackID string, isrc string) (string, bool)
+	Add(path string, job *models.DownloadJob)
+}
+
+// WatchlistProvider persists the artists whose new releases are downloaded
+// automatically.
+type WatchlistProvider interface {
+	List() []models.WatchedArtist
+	Get(artistID string) (models.WatchedArtist, bool)
+	Put(artist models.WatchedArtist) error
+	Delete(artistID string) error
+}
+
+// MirrorProvider persists the playlists kept in sync with Spotify and what
+// was synced for each.
+type MirrorProvider interface {
+	List() []models.MirroredPlaylist
+	Get(playlistID string) (models.MirroredPlaylist, bool)
+	Put(mirror models.MirroredPlaylist) error
+	Delete(playlistID string) error
+}
+
+// ClaimProvider records which owners use the library file of a track, so a
+// mirror only deletes files nothing else has asked for. Owners are opaque
+// strings such as "mirror:<playlist ID>".
+type ClaimProvider interface {
+	Claim(owner string, trackID string, isrc string) error
+	Release(owner string, trackID string) error
+	// Claimed reports whether an owner other than except claims the track,
+	// matching by Spotify track ID or ISRC.
+	Claimed(trackID string, isrc string, except string) (bool, error)
+}
+
+// WebhookProvider delivers a signed payload to one webhook target.
+type WebhookProvider interface {
+	Send(ctx context.Context, url string, payload models.WebhookPayload) error
 }
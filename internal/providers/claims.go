@@ -0,0 +1,277 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"audio-scraper/internal/ports"
+)
+
+const claimJournalFile = "claims.jsonl"
+
+// claimRecord is one line of the claim journal. A released record drops the
+// owner's earlier claim on the track.
+type claimRecord struct {
+	Owner    string `json:"owner"`
+	TrackID  string `json:"track_id"`
+	ISRC     string `json:"isrc,omitempty"`
+	Released bool   `json:"released,omitempty"`
+}
+
+type claimKey struct {
+	owner   string
+	trackID string
+}
+
+// claimClient keeps the claims in memory and appends every change to a JSON
+// lines journal in DATA_HOME. Every change is a single appended line, so
+// serve and a concurrent get can both record claims; Claimed first reads
+// whatever other processes appended since the journal was last read. The
+// journal is compacted each time it is opened.
+type claimClient struct {
+	log    ports.Logger
+	path   string
+	claims map[claimKey]string
+	// read is the journal file read so far and offset how much of it, up
+	// to the end of its last complete line.
+	read   os.FileInfo
+	offset int64
+	mu     sync.Mutex
+}
+
+func NewClaimProvider(l ports.Logger, dataHome string) (ports.ClaimProvider, error) {
+	if dataHome == "" {
+		return nil, errors.New("missing DATA_HOME")
+	}
+	if err := os.MkdirAll(dataHome, 0755); err != nil {
+		l.Error("failed to create data directory", "path", dataHome, "err", err)
+		return nil, errors.New("failed to create data directory")
+	}
+
+	c := &claimClient{
+		log:    l.With("component", "Claims"),
+		path:   filepath.Join(dataHome, claimJournalFile),
+		claims: make(map[claimKey]string),
+	}
+	if err := c.compact(); err != nil {
+		return nil, err
+	}
+	c.log.Info("loaded track claims", "claims", len(c.claims))
+	return c, nil
+}
+
+func (c *claimClient) Claim(owner string, trackID string, isrc string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := claimKey{owner: owner, trackID: trackID}
+	if _, exists := c.claims[key]; exists {
+		return nil
+	}
+	isrc = strings.ToUpper(isrc)
+	if err := c.append(claimRecord{Owner: owner, TrackID: trackID, ISRC: isrc}); err != nil {
+		return err
+	}
+	c.claims[key] = isrc
+	return nil
+}
+
+func (c *claimClient) Release(owner string, trackID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := claimKey{owner: owner, trackID: trackID}
+	if _, exists := c.claims[key]; !exists {
+		return nil
+	}
+	if err := c.append(claimRecord{Owner: owner, TrackID: trackID, Released: true}); err != nil {
+		return err
+	}
+	delete(c.claims, key)
+	return nil
+}
+
+func (c *claimClient) Claimed(trackID string, isrc string, except string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(); err != nil {
+		return false, err
+	}
+	isrc = strings.ToUpper(isrc)
+	for key, claimedISRC := range c.claims {
+		if key.owner == except {
+			continue
+		}
+		if key.trackID == trackID || (isrc != "" && claimedISRC == isrc) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// refresh applies the lines appended to the journal since it was last read,
+// including this process's own, which changes nothing. A journal another
+// process compacted meanwhile is read again from the start. Callers hold the
+// lock.
+func (c *claimClient) refresh() error {
+	f, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		c.log.Error("failed to open claim journal", "path", c.path, "err", err)
+		return errors.New("open claim journal failed")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		c.log.Error("failed to stat claim journal", "path", c.path, "err", err)
+		return errors.New("read claim journal failed")
+	}
+	if c.read == nil || !os.SameFile(c.read, info) || info.Size() < c.offset {
+		c.claims = make(map[claimKey]string)
+		c.read, c.offset = info, 0
+	}
+	return c.readFrom(f)
+}
+
+// readFrom applies the complete lines of f past the offset read so far. A
+// line still being written is left for the next read. Callers hold the lock.
+func (c *claimClient) readFrom(f *os.File) error {
+	if _, err := f.Seek(c.offset, io.SeekStart); err != nil {
+		c.log.Error("failed to seek claim journal", "path", c.path, "err", err)
+		return errors.New("read claim journal failed")
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.log.Error("failed to read claim journal", "path", c.path, "err", err)
+		return errors.New("read claim journal failed")
+	}
+	end := bytes.LastIndexByte(data, '\n') + 1
+	for _, line := range bytes.Split(data[:end], []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var record claimRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// A line cut short by a crash is skipped rather than losing the
+			// claims after it.
+			c.log.Warn("skipping malformed claim journal entry", "err", err)
+			continue
+		}
+		key := claimKey{owner: record.Owner, trackID: record.TrackID}
+		if record.Released {
+			delete(c.claims, key)
+			continue
+		}
+		c.claims[key] = record.ISRC
+	}
+	c.offset += int64(end)
+	return nil
+}
+
+// compact loads the journal and replaces it with one line per claim held.
+// Lines another process appends to the old journal while it is replaced are
+// copied over afterwards. Callers hold the lock, apart from the constructor.
+func (c *claimClient) compact() error {
+	old, err := os.Open(c.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.log.Error("failed to open claim journal", "path", c.path, "err", err)
+		return errors.New("open claim journal failed")
+	}
+	if old != nil {
+		defer old.Close()
+		if err := c.readFrom(old); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]claimKey, 0, len(c.claims))
+	for key := range c.claims {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].owner != keys[j].owner {
+			return keys[i].owner < keys[j].owner
+		}
+		return keys[i].trackID < keys[j].trackID
+	})
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, key := range keys {
+		if err := enc.Encode(claimRecord{Owner: key.owner, TrackID: key.trackID, ISRC: c.claims[key]}); err != nil {
+			c.log.Error("failed to encode claim", "err", err)
+			return errors.New("encode claim failed")
+		}
+	}
+	if err := writeFileAtomic(c.path, buf.Bytes()); err != nil {
+		c.log.Error("failed to write claim journal", "path", c.path, "err", err)
+		return errors.New("write claim journal failed")
+	}
+
+	if old != nil {
+		oldOffset := c.offset
+		if err := c.readFrom(old); err != nil {
+			return err
+		}
+		if late := c.offset - oldOffset; late > 0 {
+			if _, err := old.Seek(oldOffset, io.SeekStart); err != nil {
+				c.log.Error("failed to seek claim journal", "path", c.path, "err", err)
+				return errors.New("read claim journal failed")
+			}
+			lines := make([]byte, late)
+			if _, err := io.ReadFull(old, lines); err != nil {
+				c.log.Error("failed to read claim journal", "path", c.path, "err", err)
+				return errors.New("read claim journal failed")
+			}
+			if err := c.appendLines(lines); err != nil {
+				return err
+			}
+		}
+	}
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		c.log.Error("failed to stat claim journal", "path", c.path, "err", err)
+		return errors.New("read claim journal failed")
+	}
+	// Anything past what was just written is read on the next refresh.
+	c.read, c.offset = info, int64(buf.Len())
+	return nil
+}
+
+// append writes one record to the end of the journal. Callers hold the lock.
+func (c *claimClient) append(record claimRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		c.log.Error("failed to encode claim", "err", err)
+		return errors.New("encode claim failed")
+	}
+	return c.appendLines(append(data, '\n'))
+}
+
+// appendLines adds complete lines to the end of the journal. The file is
+// opened in append mode for each write so lines from several processes never
+// overwrite each other.
+func (c *claimClient) appendLines(lines []byte) error {
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		c.log.Error("failed to open claim journal", "path", c.path, "err", err)
+		return errors.New("open claim journal failed")
+	}
+	if _, err := f.Write(lines); err != nil {
+		f.Close()
+		c.log.Error("failed to write claim journal", "path", c.path, "err", err)
+		return errors.New("write claim journal failed")
+	}
+	if err := f.Close(); err != nil {
+		c.log.Error("failed to write claim journal", "path", c.path, "err", err)
+		return errors.New("write claim journal failed")
+	}
+	return nil
+}
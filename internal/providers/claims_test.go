@@ -0,0 +1,131 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClaimsMatchOtherOwnersByTrackOrISRC(t *testing.T) {
+	claims, err := NewClaimProvider(quietLogger(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := claims.Claim("mirror:a", "track", "isrc1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := claims.Claim("downloads", "other", "ISRC1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		trackID, isrc, except string
+		want                  bool
+	}{
+		{"track", "", "mirror:a", false},
+		{"track", "isrc1", "mirror:a", true},
+		{"track", "", "mirror:b", true},
+		{"other", "", "downloads", false},
+		{"unknown", "", "", false},
+	} {
+		claimed, err := claims.Claimed(c.trackID, c.isrc, c.except)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed != c.want {
+			t.Errorf("Claimed(%q, %q, %q) = %v, want %v", c.trackID, c.isrc, c.except, claimed, c.want)
+		}
+	}
+}
+
+func TestClaimsAreSharedThroughTheJournal(t *testing.T) {
+	dataHome := t.TempDir()
+	serve, err := NewClaimProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get, err := NewClaimProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serve.Claim("mirror:a", "track", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A claim made by another process after this one loaded counts.
+	if err := get.Claim("downloads", "track", ""); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := serve.Claimed("track", "", "mirror:a"); err != nil || !claimed {
+		t.Fatalf("claim of the other process not seen: %v, %v", claimed, err)
+	}
+	if err := get.Release("downloads", "track"); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := serve.Claimed("track", "", "mirror:a"); err != nil || claimed {
+		t.Fatalf("released claim still counts: %v, %v", claimed, err)
+	}
+
+	// A line cut short by a crash loses only itself.
+	f, err := os.OpenFile(filepath.Join(dataHome, claimJournalFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"owner":"downl` + "\n")
+	f.Close()
+	if err := get.Claim("downloads", "later", ""); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewClaimProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := reopened.Claimed("later", "", ""); err != nil || !claimed {
+		t.Errorf("claim after a broken line lost: %v, %v", claimed, err)
+	}
+	if claimed, err := reopened.Claimed("track", "", "downloads"); err != nil || !claimed {
+		t.Errorf("mirror claim lost on reload: %v, %v", claimed, err)
+	}
+}
+
+func TestClaimJournalIsCompactedOnOpen(t *testing.T) {
+	dataHome := t.TempDir()
+	claims, err := NewClaimProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := claims.Claim("mirror:a", "track", ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := claims.Release("mirror:a", "track"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := claims.Claim("mirror:a", "kept", "isrc"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewClaimProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dataHome, claimJournalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"owner":"mirror:a","track_id":"kept","isrc":"ISRC"}` + "\n"; string(data) != want {
+		t.Errorf("compacted journal = %q, want %q", data, want)
+	}
+
+	// The first process notices the journal was replaced and reads it again.
+	if err := reopened.Claim("downloads", "other", ""); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := claims.Claimed("other", "", ""); err != nil || !claimed {
+		t.Errorf("claim in the compacted journal not seen: %v, %v", claimed, err)
+	}
+	if claimed, err := claims.Claimed("kept", "", "downloads"); err != nil || !claimed {
+		t.Errorf("claim lost after compaction: %v, %v", claimed, err)
+	}
+}
@@ -2,141 +2,310 @@ package providers
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
-	"io"
-	"net/http"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode"
 
-	"github.com/bogem/id3v2/v2"
+	"github.com/google/uuid"
 
+	"audio-scraper/internal/constants"
 	"audio-scraper/internal/logger"
 	"audio-scraper/internal/models"
 	"audio-scraper/internal/ports"
 )
 
+const (
+	playlistDir = "Playlists"
+	stagingDir  = ".staging"
+)
+
 type fsClient struct {
-	musicHome string
+	musicHome    string
+	pathTemplate *pathTemplate
+	// stagingName is this process's directory under .staging, named
+	// "<pid>-<uuid>" so a concurrent serve or get never touches another's
+	// files and a reused pid cannot claim an abandoned directory.
+	stagingName string
 }
 
-func NewFSProvider(musicHome string) (ports.FSProvider, error) {
+func NewFSProvider(musicHome string, pathTemplate string) (ports.FSProvider, error) {
 	if musicHome == "" {
 		return nil, errors.New("missing MUSIC_HOME")
 	}
+	if pathTemplate == "" {
+		pathTemplate = constants.DefaultPathTemplate
+	}
+	tmpl, err := parsePathTemplate(pathTemplate)
+	if err != nil {
+		return nil, err
+	}
 	return &fsClient{
-		musicHome: musicHome,
+		musicHome:    musicHome,
+		pathTemplate: tmpl,
+		stagingName:  strconv.Itoa(os.Getpid()) + "-" + uuid.NewString(),
 	}, nil
 }
 
-func (f *fsClient) InitializePath(ctx context.Context, job *models.DownloadJob) (string, error) {
+// trackPath returns where the file for job lives inside the library.
+func (f *fsClient) trackPath(job *models.DownloadJob) string {
+	return filepath.Join(f.musicHome, f.pathTemplate.render(job, job.Format.Extension()))
+}
+
+// stagingPath returns where the file for job is downloaded and tagged before
+// it is moved into the library. The staging directory lives inside MUSIC_HOME
+// so the final move is a rename on the same filesystem.
+func (f *fsClient) stagingPath(job *models.DownloadJob) string {
+	return filepath.Join(f.musicHome, stagingDir, f.stagingName, job.ID+"."+job.Format.Extension())
+}
+
+func (f *fsClient) StagePath(ctx context.Context, job *models.DownloadJob) (string, error) {
 	log := logger.From(ctx)
-	path := filepath.Join(
-		f.musicHome,
-		job.Artist,
-		job.Album,
-	)
+	stagedPath := f.stagingPath(job)
+	dir := filepath.Dir(stagedPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Error("failed to create staging directory", "path", dir, "err", err)
+		return "", errors.New("failed to create staging directory")
+	}
+
+	// A leftover from an earlier attempt would make yt-dlp skip the download.
+	if err := os.Remove(stagedPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error("failed to remove stale staging file", "path", stagedPath, "err", err)
+		return "", errors.New("failed to remove stale staging file")
+	}
+
+	log.Info("initialized staging path", "staged_path", stagedPath)
+	return stagedPath, nil
+}
+
+func (f *fsClient) Finalize(ctx context.Context, stagedPath string, job *models.DownloadJob) (string, error) {
+	log := logger.From(ctx)
+	outputPath := f.trackPath(job)
+	if !isWithin(f.musicHome, outputPath) {
+		log.Error("rendered path escapes MUSIC_HOME", "output_path", outputPath)
+		return "", errors.New("output path escapes MUSIC_HOME")
+	}
+	path := filepath.Dir(outputPath)
 
 	if err := os.MkdirAll(path, 0755); err != nil {
 		log.Error("failed to create directories", "path", path, "err", err)
 		return "", errors.New("failed to create directories")
 	}
 
-	hasher := sha256.New()
-	hasher.Write([]byte(job.Track))
-	trackNameHash := hex.EncodeToString(hasher.Sum(nil))
+	// rename replaces any existing copy in one step, so the library never
+	// holds a partial file and a failed download leaves the old one intact.
+	if err := os.Rename(stagedPath, outputPath); err != nil {
+		log.Error("failed to move file into library", "staged_path", stagedPath, "output_path", outputPath, "err", err)
+		return "", errors.New("failed to move file into library")
+	}
 
-	outputPath := filepath.Join(path, trackNameHash+".mp3")
+	log.Info("moved file into library", "output_path", outputPath)
+	return outputPath, nil
+}
 
-	if _, err := os.Stat(outputPath); err == nil {
-		if err := os.Remove(outputPath); err != nil {
-			return "", errors.New("failed to remove existing file")
+// Discard removes a staged file along with any intermediate files yt-dlp left
+// next to it, which share its name but not its extension.
+func (f *fsClient) Discard(ctx context.Context, stagedPath string) {
+	log := logger.From(ctx)
+	if stagedPath == "" {
+		return
+	}
+	matches, _ := filepath.Glob(strings.TrimSuffix(stagedPath, filepath.Ext(stagedPath)) + ".*")
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn("failed to remove staging file", "path", path, "err", err)
 		}
 	}
-
-	log.Info("initialized filesystem path", "output_path", outputPath)
-	return outputPath, nil
 }
 
-func (f *fsClient) TagFile(ctx context.Context, filePath string, job *models.DownloadJob) error {
+// CleanStaging removes the staging directories of processes that are no
+// longer running, along with loose files from versions that staged directly
+// in .staging. Interrupted jobs restart from the search stage, so nothing in
+// them is ever resumed. Directories of running processes are left alone.
+func (f *fsClient) CleanStaging(ctx context.Context) error {
 	log := logger.From(ctx)
-	tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true})
+	dir := filepath.Join(f.musicHome, stagingDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
-		log.Error("failed to open id3 tag", "err", err)
-		return errors.New("open id3 tag failed")
+		log.Error("failed to read staging directory", "path", dir, "err", err)
+		return errors.New("failed to read staging directory")
 	}
-	defer tag.Close()
-	tag.DeleteAllFrames()
-
-	tag.SetTitle(job.Track)
-	tag.SetArtist(job.Artist)
-	tag.SetAlbum(job.Album)
 
-	year := ""
-	if job.ReleaseDate != "" {
-		parts := strings.Split(job.ReleaseDate, "-")
-		if len(parts) > 0 {
-			year = parts[0]
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() && f.stagingInUse(entry.Name()) {
+			continue
 		}
+		path := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Error("failed to remove orphaned staging file", "path", path, "err", err)
+			return errors.New("failed to clean staging directory")
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Info("removed orphaned staging files", "count", removed)
+	}
+	return nil
+}
+
+// stagingInUse reports whether the staging directory name belongs to this
+// process or to another one that is still running. Directories that do not
+// follow the "<pid>-<uuid>" scheme are not in use.
+func (f *fsClient) stagingInUse(name string) bool {
+	if name == f.stagingName {
+		return true
+	}
+	pidText, _, found := strings.Cut(name, "-")
+	if !found {
+		return false
 	}
-	if year != "" {
-		tag.SetYear(year)
+	pid, err := strconv.Atoi(pidText)
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		// Only one process holds a pid at a time, so another directory with
+		// ours was left by an earlier process.
+		return false
 	}
+	return processRunning(pid)
+}
 
-	if job.TrackNumber > 0 {
-		tag.AddTextFrame("TRCK", tag.DefaultEncoding(), strconv.Itoa(job.TrackNumber))
+// WritePlaylist writes an extended M3U playlist to MUSIC_HOME/Playlists that
+// references the library files of jobs, in order, by relative path. The
+// files do not need to exist yet; jobs that already have a Path point there.
+func (f *fsClient) WritePlaylist(ctx context.Context, name string, jobs []models.DownloadJob) (string, error) {
+	log := logger.From(ctx)
+	dir := filepath.Join(f.musicHome, playlistDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Error("failed to create playlist directory", "path", dir, "err", err)
+		return "", errors.New("failed to create playlist directory")
 	}
+	playlistPath := filepath.Join(dir, truncateFilename(sanitizePathComponent(name)+".m3u8", maxComponentLength))
 
-	if job.ThumbnailURL != "" {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, job.ThumbnailURL, nil)
-		if err != nil {
-			log.Error("failed to create thumbnail request", "err", err)
-			return errors.New("create thumbnail request failed")
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#PLAYLIST:" + strings.ReplaceAll(name, "\n", " ") + "\n")
+	for i := range jobs {
+		job := &jobs[i]
+		trackPath := job.Path
+		if trackPath == "" {
+			trackPath = f.trackPath(job)
 		}
-
-		resp, err := http.DefaultClient.Do(req)
+		rel, err := filepath.Rel(dir, trackPath)
 		if err != nil {
-			log.Error("failed to fetch thumbnail", "err", err)
-			return errors.New("fetch thumbnail failed")
+			log.Error("failed to resolve playlist entry", "track_id", job.TrackID, "err", err)
+			return "", errors.New("failed to resolve playlist entry")
 		}
-		defer resp.Body.Close()
+		fmt.Fprintf(&b, "#EXTINF:%d,%s - %s\n", job.DurationMs/1000, job.Artist, job.Track)
+		b.WriteString(filepath.ToSlash(rel) + "\n")
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			log.Error("unexpected thumbnail response status", "status", resp.StatusCode)
-			return errors.New("fetch thumbnail failed")
-		}
+	tmpPath := playlistPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(b.String()), 0644); err != nil {
+		log.Error("failed to write playlist", "path", tmpPath, "err", err)
+		return "", errors.New("failed to write playlist")
+	}
+	if err := os.Rename(tmpPath, playlistPath); err != nil {
+		log.Error("failed to replace playlist", "path", playlistPath, "err", err)
+		return "", errors.New("failed to write playlist")
+	}
+	return playlistPath, nil
+}
+
+// RemoveTrack deletes a library file unless a playlist under
+// MUSIC_HOME/Playlists other than keepPlaylist lists it, then removes the
+// directories it leaves empty. It reports whether the file was deleted.
+func (f *fsClient) RemoveTrack(ctx context.Context, path string, keepPlaylist string) (bool, error) {
+	log := logger.From(ctx).With("path", path)
+	path = filepath.Clean(path)
+	if !isWithin(f.musicHome, path) || path == filepath.Clean(f.musicHome) {
+		log.Error("refusing to remove file outside MUSIC_HOME")
+		return false, errors.New("path is outside MUSIC_HOME")
+	}
 
-		imgData, err := io.ReadAll(resp.Body)
+	dir := filepath.Join(f.musicHome, playlistDir)
+	playlists, err := filepath.Glob(filepath.Join(dir, "*.m3u8"))
+	if err != nil {
+		log.Error("failed to list playlists", "err", err)
+		return false, errors.New("failed to list playlists")
+	}
+	for _, playlist := range playlists {
+		if keepPlaylist != "" && filepath.Clean(playlist) == filepath.Clean(keepPlaylist) {
+			continue
+		}
+		data, err := os.ReadFile(playlist)
 		if err != nil {
-			log.Error("failed to read thumbnail data", "err", err)
-			return errors.New("read thumbnail data failed")
+			log.Error("failed to read playlist", "playlist", playlist, "err", err)
+			return false, errors.New("failed to read playlist")
 		}
-
-		mime := "image/jpeg"
-		if ct := resp.Header.Get("Content-Type"); ct != "" {
-			if strings.HasPrefix(ct, "image/") {
-				mime = strings.Split(ct, ";")[0]
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if filepath.Join(dir, filepath.FromSlash(line)) == path {
+				log.Info("keeping file listed by another playlist", "playlist", playlist)
+				return false, nil
 			}
 		}
+	}
 
-		pic := id3v2.PictureFrame{
-			Encoding:    tag.DefaultEncoding(),
-			MimeType:    mime,
-			PictureType: id3v2.PTFrontCover,
-			Description: "Cover",
-			Picture:     imgData,
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
 		}
-
-		tag.AddAttachedPicture(pic)
+		log.Error("failed to remove file", "err", err)
+		return false, errors.New("failed to remove file")
 	}
+	for parent := filepath.Dir(path); parent != filepath.Clean(f.musicHome) && isWithin(f.musicHome, parent); parent = filepath.Dir(parent) {
+		// Remove fails on directories that still hold something.
+		if os.Remove(parent) != nil {
+			break
+		}
+	}
+	log.Info("removed file from library")
+	return true, nil
+}
 
-	if err := tag.Save(); err != nil {
-		log.Error("failed to save id3 tag", "err", err)
-		return errors.New("save id3 tag failed")
+// sanitizeFilename replaces characters that are illegal in file names on
+// common filesystems, including path separators and control characters, with
+// an underscore.
+func sanitizeFilename(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', '<', '>', ':', '"', '|', '?', '*':
+			return '_'
+		}
+		if unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// sanitizePathComponent makes a rendered path component safe to use as a
+// single directory or file name: it must not be empty, must not be "." or
+// "..", must not start with a dot, which would hide it and could clash with
+// .staging, and must not end in dots or spaces, which some filesystems (and
+// SMB shares) silently strip.
+func sanitizePathComponent(component string) string {
+	component = strings.Trim(sanitizeFilename(component), ". ")
+	if component == "" {
+		return "Unknown"
 	}
+	return component
+}
 
-	return nil
+// isWithin reports whether path is root itself or lies beneath it.
+func isWithin(root string, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package providers
+
+// processRunning cannot tell on this platform whether another process is
+// still running, so it assumes it is and its staging directory is kept.
+func processRunning(pid int) bool {
+	return true
+}
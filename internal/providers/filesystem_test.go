@@ -0,0 +1,257 @@
+package providers
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+func TestStagePathIsPerProcess(t *testing.T) {
+	root := t.TempDir()
+	first, err := NewFSProvider(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewFSProvider(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &models.DownloadJob{ID: "job"}
+	firstPath, err := first.StagePath(quietContext(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondPath, err := second.StagePath(quietContext(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(filepath.Dir(firstPath)) != filepath.Join(root, stagingDir) {
+		t.Errorf("staged at %q, want a directory under %q", firstPath, filepath.Join(root, stagingDir))
+	}
+	if filepath.Dir(firstPath) == filepath.Dir(secondPath) {
+		t.Errorf("both providers stage in %q", filepath.Dir(firstPath))
+	}
+}
+
+func TestCleanStagingKeepsRunningProcesses(t *testing.T) {
+	root := t.TempDir()
+	fs, err := NewFSProvider(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownPath, err := fs.StagePath(quietContext(), &models.DownloadJob{ID: "own"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLibraryFile(t, filepath.Dir(ownPath), filepath.Base(ownPath), []byte("own"))
+
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skip("cannot start a process:", err)
+	}
+	staging := filepath.Join(root, stagingDir)
+	running := writeLibraryFile(t, staging, strconv.Itoa(os.Getppid())+"-running/job.opus", []byte("running"))
+	dead := writeLibraryFile(t, staging, strconv.Itoa(exited.ProcessState.Pid())+"-dead/job.opus", []byte("dead"))
+	reused := writeLibraryFile(t, staging, strconv.Itoa(os.Getpid())+"-earlier/job.opus", []byte("reused"))
+	legacy := writeLibraryFile(t, staging, "job.opus", []byte("legacy"))
+	unknown := writeLibraryFile(t, staging, "unknown/job.opus", []byte("unknown"))
+
+	if err := fs.CleanStaging(quietContext()); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{ownPath, running} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed: %v", path, err)
+		}
+	}
+	for _, path := range []string{dead, reused, legacy, unknown} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was kept", path)
+		}
+	}
+}
+
+func TestSanitizePathComponent(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"Radiohead", "Radiohead"},
+		{"AC/DC", "AC_DC"},
+		{`a\b:c*d?e"f<g>h|i`, "a_b_c_d_e_f_g_h_i"},
+		{"tab\there", "tab_here"},
+		{"", "Unknown"},
+		{"   ", "Unknown"},
+		{".", "Unknown"},
+		{"..", "Unknown"},
+		{"...", "Unknown"},
+		{".staging", "staging"},
+		{".audio-scraper", "audio-scraper"},
+		{"...And Justice for All", "And Justice for All"},
+		{" . hidden", "hidden"},
+		{"Trailing dots...", "Trailing dots"},
+		{"Trailing space ", "Trailing space"},
+		{"Mr. Brightside", "Mr. Brightside"},
+	} {
+		if got := sanitizePathComponent(tt.in); got != tt.want {
+			t.Errorf("sanitizePathComponent(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	root := filepath.FromSlash("/music")
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"/music", true},
+		{"/music/a/b.opus", true},
+		{"/music/../music/a", true},
+		{"/music/..", false},
+		{"/music/../etc/passwd", false},
+		{"/musicx/a", false},
+		{"/", false},
+	} {
+		if got := isWithin(root, filepath.FromSlash(tt.path)); got != tt.want {
+			t.Errorf("isWithin(%q, %q) = %v, want %v", root, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTrackPathsStayVisibleInsideTheLibrary(t *testing.T) {
+	root := t.TempDir()
+	fs, err := NewFSProvider(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []models.DownloadJob{
+		{AlbumArtist: "../../etc", Album: "..", Track: "passwd"},
+		{AlbumArtist: ".staging", Album: ".", Track: ".."},
+		{AlbumArtist: "/", Album: "/tmp/x", Track: "../../../root"},
+		{AlbumArtist: ".audio-scraper", Album: "...", Track: ""},
+	} {
+		job.ID = "job"
+		job.TrackNumber, job.DiscNumber = 1, 1
+		job.Format = "opus"
+		path := fs.(*fsClient).trackPath(&job)
+		if !isWithin(root, path) {
+			t.Errorf("%+v renders to %q, outside %q", job, path, root)
+			continue
+		}
+		rel, _ := filepath.Rel(root, path)
+		for _, component := range strings.Split(filepath.ToSlash(rel), "/") {
+			if strings.HasPrefix(component, ".") {
+				t.Errorf("%+v renders to %q with the hidden component %q", job, rel, component)
+			}
+		}
+	}
+}
+
+// stageFile stages a file with content for job, as a download would.
+func stageFile(t *testing.T, fs ports.FSProvider, job *models.DownloadJob, content string) string {
+	t.Helper()
+	path, err := fs.StagePath(quietContext(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func finalizeJob(id string) *models.DownloadJob {
+	return &models.DownloadJob{ID: id, AlbumArtist: "Radiohead", Album: "OK Computer", Track: "Airbag", TrackNumber: 1, DiscNumber: 1, Format: "opus"}
+}
+
+func TestFinalizeMovesTheStagedFileIntoTheLibrary(t *testing.T) {
+	root := t.TempDir()
+	fs, err := NewFSProvider(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged := stageFile(t, fs, finalizeJob("first"), "first")
+	path, err := fs.Finalize(quietContext(), staged, finalizeJob("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "Radiohead", "OK Computer", "01-01 Airbag.opus"); path != want {
+		t.Errorf("Finalize = %q, want %q", path, want)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("staged file still there: %v", err)
+	}
+
+	// A second download of the same track replaces the first copy.
+	staged = stageFile(t, fs, finalizeJob("second"), "second")
+	again, err := fs.Finalize(quietContext(), staged, finalizeJob("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != path {
+		t.Errorf("second Finalize = %q, want %q", again, path)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second" {
+		t.Errorf("library file holds %q, want the second download", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("album directory holds %d files, want 1", len(entries))
+	}
+}
+
+func TestFinalizeFailureLeavesTheLibraryAlone(t *testing.T) {
+	root := t.TempDir()
+	fs, err := NewFSProvider(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged := stageFile(t, fs, finalizeJob("first"), "first")
+	path, err := fs.Finalize(quietContext(), staged, finalizeJob("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A download that never produced its file keeps the existing copy.
+	missing, err := fs.StagePath(quietContext(), finalizeJob("missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Finalize(quietContext(), missing, finalizeJob("missing")); err == nil {
+		t.Fatal("Finalize of a missing staged file succeeded")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first" {
+		t.Errorf("library file holds %q after a failed finalize, want the first copy", data)
+	}
+
+	// A file in the way of the album directory fails the move; Discard then
+	// removes the staged file and whatever yt-dlp left next to it.
+	blocked := finalizeJob("blocked")
+	blocked.Album = "Blocked"
+	if err := os.WriteFile(filepath.Join(root, "Radiohead", "Blocked"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	staged = stageFile(t, fs, blocked, "blocked")
+	leftover := strings.TrimSuffix(staged, ".opus") + ".webm.part"
+	if err := os.WriteFile(leftover, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Finalize(quietContext(), staged, blocked); err == nil {
+		t.Fatal("Finalize into a blocked directory succeeded")
+	}
+	if _, err := os.Stat(staged); err != nil {
+		t.Fatalf("staged file gone after a failed finalize: %v", err)
+	}
+	fs.Discard(quietContext(), staged)
+	for _, p := range []string{staged, leftover} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still there after Discard: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package providers
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processRunning reports whether a process with pid exists. Signal 0 checks
+// without affecting it; EPERM means it exists but belongs to another user.
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,111 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/bogem/id3v2/v2"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+)
+
+// id3Writer tags MP3 files with ID3v2.4 frames.
+type id3Writer struct{}
+
+func (id3Writer) WriteTags(ctx context.Context, filePath string, job *models.DownloadJob, cover *coverArt) error {
+	log := logger.From(ctx)
+	tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true})
+	if err != nil {
+		log.Error("failed to open id3 tag", "err", err)
+		return errors.New("open id3 tag failed")
+	}
+	defer tag.Close()
+	tag.DeleteAllFrames()
+	// TDRC, TSRC and multi-valued frames are ID3v2.4; files tagged as v2.3
+	// by ffmpeg are upgraded.
+	tag.SetVersion(4)
+	enc := tag.DefaultEncoding()
+
+	tag.SetTitle(job.Track)
+	tag.SetArtist(job.Artist)
+	tag.SetAlbum(job.Album)
+
+	if job.AlbumArtist != "" {
+		tag.AddTextFrame("TPE2", enc, job.AlbumArtist)
+	}
+	if job.ReleaseDate != "" {
+		// Spotify dates are "YYYY", "YYYY-MM" or "YYYY-MM-DD", all valid TDRC values.
+		tag.AddTextFrame("TDRC", enc, job.ReleaseDate)
+	}
+	if job.TrackNumber > 0 {
+		tag.AddTextFrame("TRCK", enc, numberWithTotal(job.TrackNumber, job.TrackTotal))
+	}
+	if job.DiscNumber > 0 {
+		tag.AddTextFrame("TPOS", enc, numberWithTotal(job.DiscNumber, job.DiscTotal))
+	}
+	if job.ISRC != "" {
+		tag.AddTextFrame("TSRC", enc, job.ISRC)
+	}
+	if len(job.Genres) > 0 {
+		tag.AddTextFrame("TCON", enc, strings.Join(job.Genres, tagValueSeparator))
+	}
+	if job.Copyright != "" {
+		tag.AddTextFrame("TCOP", enc, job.Copyright)
+	}
+	if job.Compilation {
+		tag.AddTextFrame("TCMP", enc, "1")
+	}
+
+	userFrames := []struct{ description, value string }{
+		{tagArtists, strings.Join(job.Artists, tagValueSeparator)},
+		{tagSpotifyTrackID, job.TrackID},
+		{tagSpotifyAlbumID, job.AlbumID},
+	}
+	for _, frame := range userFrames {
+		if frame.value == "" {
+			continue
+		}
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    enc,
+			Description: frame.description,
+			Value:       frame.value,
+		})
+	}
+
+	if cover != nil {
+		pic := id3v2.PictureFrame{
+			Encoding:    enc,
+			MimeType:    cover.mime,
+			PictureType: id3v2.PTFrontCover,
+			Description: "Cover",
+			Picture:     cover.data,
+		}
+
+		tag.AddAttachedPicture(pic)
+	}
+
+	if err := tag.Save(); err != nil {
+		log.Error("failed to save id3 tag", "err", err)
+		return errors.New("save id3 tag failed")
+	}
+
+	return nil
+}
+
+func readID3IDs(filePath string) (trackIDs, error) {
+	tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true, ParseFrames: []string{"TSRC", "TXXX"}})
+	if err != nil {
+		return trackIDs{}, err
+	}
+	defer tag.Close()
+
+	ids := trackIDs{isrc: tag.GetTextFrame("TSRC").Text}
+	for _, f := range tag.GetFrames("TXXX") {
+		if frame, ok := f.(id3v2.UserDefinedTextFrame); ok && frame.Description == tagSpotifyTrackID {
+			ids.trackID = frame.Value
+		}
+	}
+	return ids, nil
+}
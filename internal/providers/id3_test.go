@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// mp3Audio stands in for the MPEG frames after the tag, which tagging must
+// leave untouched.
+var mp3Audio = bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64, 0x00, 0x01, 0x02, 0x03}, 64)
+
+func TestID3RoundTrip(t *testing.T) {
+	path := writeTestFile(t, "track.mp3", mp3Audio)
+	if err := (id3Writer{}).WriteTags(quietContext(), path, taggedJob(), testCover); err != nil {
+		t.Fatalf("WriteTags: %v", err)
+	}
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("open tag: %v", err)
+	}
+	defer tag.Close()
+
+	if tag.Version() != 4 {
+		t.Errorf("version = %d, want 4", tag.Version())
+	}
+	texts := map[string]string{
+		"TIT2": "Paranoid Android",
+		"TPE1": "Radiohead",
+		"TALB": "OK Computer",
+		"TPE2": "Radiohead",
+		"TRCK": "2/12",
+		"TPOS": "1/2",
+		"TDRC": "1997-05-21",
+		"TCON": "alternative rock; art rock",
+		"TSRC": "GBAYE9700101",
+		"TCOP": "1997 XL Recordings",
+		"TCMP": "1",
+	}
+	for id, want := range texts {
+		if got := tag.GetTextFrame(id).Text; got != want {
+			t.Errorf("%s = %q, want %q", id, got, want)
+		}
+	}
+
+	user := map[string]string{}
+	for _, f := range tag.GetFrames("TXXX") {
+		frame := f.(id3v2.UserDefinedTextFrame)
+		user[frame.Description] = frame.Value
+	}
+	wantUser := map[string]string{
+		tagArtists:        "Radiohead; Thom Yorke",
+		tagSpotifyTrackID: "6LgJvl0Xdtc73RJ1mmpotq",
+		tagSpotifyAlbumID: "6dVIqQ8qmQ5GBnJ9shOYGE",
+	}
+	for description, want := range wantUser {
+		if user[description] != want {
+			t.Errorf("TXXX %s = %q, want %q", description, user[description], want)
+		}
+	}
+
+	pictures := tag.GetFrames("APIC")
+	if len(pictures) != 1 {
+		t.Fatalf("got %d pictures, want 1", len(pictures))
+	}
+	pic := pictures[0].(id3v2.PictureFrame)
+	if pic.MimeType != testCover.mime || pic.PictureType != id3v2.PTFrontCover || !bytes.Equal(pic.Picture, testCover.data) {
+		t.Errorf("picture = %s type %d %q, want the front cover", pic.MimeType, pic.PictureType, pic.Picture)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, mp3Audio) {
+		t.Error("audio after the tag changed")
+	}
+
+	ids, err := readID3IDs(path)
+	if err != nil {
+		t.Fatalf("readID3IDs: %v", err)
+	}
+	if ids != (trackIDs{trackID: "6LgJvl0Xdtc73RJ1mmpotq", isrc: "GBAYE9700101"}) {
+		t.Errorf("ids = %+v", ids)
+	}
+}
+
+func TestID3ReplacesExistingTag(t *testing.T) {
+	old := id3v2.NewEmptyTag()
+	old.SetVersion(3)
+	old.SetTitle("Old Title")
+	old.AddCommentFrame(id3v2.CommentFrame{Encoding: id3v2.EncodingISO, Language: "eng", Text: "ripped by ffmpeg"})
+	var buf bytes.Buffer
+	if _, err := old.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestFile(t, "track.mp3", append(buf.Bytes(), mp3Audio...))
+
+	job := taggedJob()
+	job.Artists = nil
+	if err := (id3Writer{}).WriteTags(quietContext(), path, job, nil); err != nil {
+		t.Fatalf("WriteTags: %v", err)
+	}
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("open tag: %v", err)
+	}
+	defer tag.Close()
+	if tag.Version() != 4 || tag.Title() != "Paranoid Android" {
+		t.Errorf("tag = v2.%d %q, want v2.4 with the new title", tag.Version(), tag.Title())
+	}
+	if n := len(tag.GetFrames("COMM")); n != 0 {
+		t.Errorf("%d stale comments kept", n)
+	}
+	if n := len(tag.GetFrames("APIC")); n != 0 {
+		t.Errorf("%d pictures written without a cover", n)
+	}
+	for _, f := range tag.GetFrames("TXXX") {
+		if frame := f.(id3v2.UserDefinedTextFrame); frame.Description == tagArtists {
+			t.Errorf("ARTISTS written without artists: %q", frame.Value)
+		}
+	}
+}
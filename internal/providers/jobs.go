@@ -0,0 +1,353 @@
+package providers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+const jobJournalFile = "jobs.jsonl"
+const jobRetention = 7 * 24 * time.Hour
+
+// jobJournalCompactSize is the size past which a running store compacts its
+// journal, provided it has at least doubled since it was last compacted.
+const jobJournalCompactSize = 1 << 20
+
+// jobStoreClient keeps job statuses in memory and appends every change to a
+// JSON lines journal, so the state survives restarts. The journal is
+// compacted, dropping finished jobs past retention, each time it is opened
+// and whenever it grows past jobJournalCompactSize. Jobs that are still
+// queued double as the durable download queue: workers pull them with Claim.
+type jobStoreClient struct {
+	log     ports.Logger
+	path    string
+	journal *os.File
+	jobs    map[string]*models.JobStatus
+	mu      sync.RWMutex
+
+	// size is the length of the journal and compactedSize its length right
+	// after it was last compacted; compactSize is jobJournalCompactSize.
+	size          int64
+	compactedSize int64
+	compactSize   int64
+}
+
+func NewJobStoreProvider(l ports.Logger, dataHome string) (ports.JobStoreProvider, error) {
+	if dataHome == "" {
+		return nil, errors.New("missing DATA_HOME")
+	}
+	if err := os.MkdirAll(dataHome, 0755); err != nil {
+		l.Error("failed to create data directory", "path", dataHome, "err", err)
+		return nil, errors.New("failed to create data directory")
+	}
+
+	store := &jobStoreClient{
+		log:         l.With("component", "JobStore"),
+		path:        filepath.Join(dataHome, jobJournalFile),
+		jobs:        make(map[string]*models.JobStatus),
+		compactSize: jobJournalCompactSize,
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	if err := store.compact(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *jobStoreClient) Create(job models.DownloadJob) (models.JobStatus, error) {
+	now := time.Now()
+	status := &models.JobStatus{
+		Job:       job,
+		State:     constants.JobStateQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.ID]; exists {
+		return models.JobStatus{}, errors.New("job already exists")
+	}
+	if err := s.append(status); err != nil {
+		return models.JobStatus{}, err
+	}
+	s.jobs[job.ID] = status
+	s.compactIfLarge()
+	return *status, nil
+}
+
+func (s *jobStoreClient) SetState(id string, state constants.JobState, reason string) (models.JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, exists := s.jobs[id]
+	if !exists {
+		return models.JobStatus{}, ports.ErrJobNotFound
+	}
+	// A worker that has yet to notice Cancel must not overwrite the outcome.
+	requeue := status.State == constants.JobStateFailed && state == constants.JobStateQueued
+	if status.State.Terminal() && !requeue {
+		return models.JobStatus{}, ports.ErrJobFinished
+	}
+
+	// The change is journaled before it is applied, so memory never gets
+	// ahead of what a restart would load.
+	next := *status
+	next.State = state
+	next.Error = reason
+	next.UpdatedAt = time.Now()
+	if err := s.append(&next); err != nil {
+		return models.JobStatus{}, err
+	}
+	*status = next
+	s.compactIfLarge()
+	return next, nil
+}
+
+func (s *jobStoreClient) Get(id string) (models.JobStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status, exists := s.jobs[id]
+	if !exists {
+		return models.JobStatus{}, false
+	}
+	return *status, true
+}
+
+func (s *jobStoreClient) Claim(state constants.JobState) (models.JobStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next *models.JobStatus
+	for _, status := range s.jobs {
+		if status.State != constants.JobStateQueued {
+			continue
+		}
+		if next == nil || status.CreatedAt.Before(next.CreatedAt) {
+			next = status
+		}
+	}
+	if next == nil {
+		return models.JobStatus{}, false
+	}
+
+	claimed := *next
+	claimed.State = state
+	claimed.Error = ""
+	claimed.UpdatedAt = time.Now()
+	if err := s.append(&claimed); err != nil {
+		// The job stays queued and is claimed again once the journal can be
+		// written.
+		return models.JobStatus{}, false
+	}
+	*next = claimed
+	s.compactIfLarge()
+	return claimed, true
+}
+
+func (s *jobStoreClient) ListByRequest(requestID string) []models.JobStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var statuses []models.JobStatus
+	for _, status := range s.jobs {
+		if status.Job.RequestID == requestID {
+			statuses = append(statuses, *status)
+		}
+	}
+	sortJobStatuses(statuses)
+	return statuses
+}
+
+func (s *jobStoreClient) ListByState(state constants.JobState) []models.JobStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var statuses []models.JobStatus
+	for _, status := range s.jobs {
+		if status.State == state {
+			statuses = append(statuses, *status)
+		}
+	}
+	sortJobStatuses(statuses)
+	return statuses
+}
+
+// Close flushes the journal to disk and closes it. Changes made afterwards
+// fail, since they can no longer be journaled.
+func (s *jobStoreClient) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.journal.Sync(); err != nil {
+		s.log.Error("failed to sync job journal", "err", err)
+	}
+	if err := s.journal.Close(); err != nil {
+		s.log.Error("failed to close job journal", "err", err)
+		return errors.New("close job journal failed")
+	}
+	return nil
+}
+
+func (s *jobStoreClient) append(status *models.JobStatus) error {
+	line, err := json.Marshal(status)
+	if err != nil {
+		s.log.Error("failed to encode job status", "job_id", status.Job.ID, "err", err)
+		return errors.New("encode job status failed")
+	}
+	n, err := s.journal.Write(append(line, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		s.log.Error("failed to write job journal", "job_id", status.Job.ID, "err", err)
+		return errors.New("write job journal failed")
+	}
+	// A transition the API has reported must survive a crash.
+	if err := s.journal.Sync(); err != nil {
+		s.log.Error("failed to sync job journal", "job_id", status.Job.ID, "err", err)
+		return errors.New("sync job journal failed")
+	}
+	return nil
+}
+
+func (s *jobStoreClient) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		s.log.Error("failed to open job journal", "path", s.path, "err", err)
+		return errors.New("open job journal failed")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var status models.JobStatus
+		if err := json.Unmarshal(scanner.Bytes(), &status); err != nil {
+			// A partially written last line is expected after a crash.
+			s.log.Warn("skipping malformed job journal entry", "err", err)
+			continue
+		}
+		s.jobs[status.Job.ID] = &status
+	}
+	if err := scanner.Err(); err != nil {
+		s.log.Error("failed to read job journal", "path", s.path, "err", err)
+		return errors.New("read job journal failed")
+	}
+
+	resumed := 0
+	for _, status := range s.jobs {
+		if !status.State.Terminal() {
+			// Jobs that were in flight when the process stopped restart from
+			// the beginning; partial downloads are overwritten.
+			status.State = constants.JobStateQueued
+			status.UpdatedAt = time.Now()
+			resumed++
+		}
+	}
+	s.log.Info("loaded job journal", "jobs", len(s.jobs), "resumed", resumed)
+	return nil
+}
+
+// compactIfLarge compacts the journal once it has grown past compactSize and
+// doubled since it was last compacted. Changes keep being appended to the
+// journal as it is if compacting fails. Callers hold the lock.
+func (s *jobStoreClient) compactIfLarge() {
+	if s.size < s.compactSize || s.size < 2*s.compactedSize {
+		return
+	}
+	if err := s.compact(); err != nil {
+		s.log.Warn("failed to compact job journal", "err", err)
+		return
+	}
+	s.log.Info("compacted job journal", "jobs", len(s.jobs), "size", s.size)
+}
+
+// prune drops finished jobs last changed more than jobRetention ago. Callers
+// hold the lock, apart from the constructor.
+func (s *jobStoreClient) prune() {
+	cutoff := time.Now().Add(-jobRetention)
+	for id, status := range s.jobs {
+		if status.State.Terminal() && status.UpdatedAt.Before(cutoff) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// compact drops expired jobs and rewrites the journal so it holds exactly one
+// entry per job, leaving it open for appending. Callers hold the lock, apart
+// from the constructor.
+func (s *jobStoreClient) compact() error {
+	s.prune()
+	statuses := make([]models.JobStatus, 0, len(s.jobs))
+	for _, status := range s.jobs {
+		statuses = append(statuses, *status)
+	}
+	sortJobStatuses(statuses)
+
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		s.log.Error("failed to create job journal", "path", tmpPath, "err", err)
+		return errors.New("create job journal failed")
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, status := range statuses {
+		if err := enc.Encode(status); err != nil {
+			tmp.Close()
+			s.log.Error("failed to encode job status", "job_id", status.Job.ID, "err", err)
+			return errors.New("encode job status failed")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		s.log.Error("failed to write job journal", "path", tmpPath, "err", err)
+		return errors.New("write job journal failed")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		s.log.Error("failed to sync job journal", "path", tmpPath, "err", err)
+		return errors.New("write job journal failed")
+	}
+	if err := tmp.Close(); err != nil {
+		s.log.Error("failed to close job journal", "path", tmpPath, "err", err)
+		return errors.New("write job journal failed")
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		s.log.Error("failed to replace job journal", "path", s.path, "err", err)
+		return errors.New("replace job journal failed")
+	}
+
+	journal, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		s.log.Error("failed to open job journal", "path", s.path, "err", err)
+		return errors.New("open job journal failed")
+	}
+	info, err := journal.Stat()
+	if err != nil {
+		journal.Close()
+		s.log.Error("failed to stat job journal", "path", s.path, "err", err)
+		return errors.New("open job journal failed")
+	}
+	if s.journal != nil {
+		// Everything in the old journal is in the new one.
+		s.journal.Close()
+	}
+	s.journal = journal
+	s.size, s.compactedSize = info.Size(), info.Size()
+	return nil
+}
+
+func sortJobStatuses(statuses []models.JobStatus) {
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].CreatedAt.Before(statuses[j].CreatedAt)
+	})
+}
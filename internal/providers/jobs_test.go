@@ -0,0 +1,190 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+func openJobStore(t *testing.T, dataHome string) *jobStoreClient {
+	t.Helper()
+	store, err := NewJobStoreProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store.(*jobStoreClient)
+}
+
+func createJob(t *testing.T, store ports.JobStoreProvider, id string) {
+	t.Helper()
+	if _, err := store.Create(models.DownloadJob{ID: id, TrackID: "track-" + id}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setJobState(t *testing.T, store ports.JobStoreProvider, id string, state constants.JobState) {
+	t.Helper()
+	if _, err := store.SetState(id, state, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// journalLines returns the lines of the job journal in dataHome.
+func journalLines(t *testing.T, dataHome string) [][]byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dataHome, jobJournalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+func TestJobStoreResumesInFlightJobsAfterACrash(t *testing.T) {
+	dataHome := t.TempDir()
+	store := openJobStore(t, dataHome)
+	for _, id := range []string{"downloading", "done", "failed", "queued"} {
+		createJob(t, store, id)
+	}
+	if claimed, ok := store.Claim(constants.JobStateSearching); !ok || claimed.Job.ID != "downloading" {
+		t.Fatalf("Claim() = %+v, %v, want the oldest job", claimed, ok)
+	}
+	setJobState(t, store, "downloading", constants.JobStateDownloading)
+	setJobState(t, store, "done", constants.JobStateDone)
+	setJobState(t, store, "failed", constants.JobStateFailed)
+
+	// The process dies without closing the store.
+	reopened := openJobStore(t, dataHome)
+	for id, want := range map[string]constants.JobState{
+		"downloading": constants.JobStateQueued,
+		"done":        constants.JobStateDone,
+		"failed":      constants.JobStateFailed,
+		"queued":      constants.JobStateQueued,
+	} {
+		status, found := reopened.Get(id)
+		if !found || status.State != want {
+			t.Errorf("job %s after reopening = %+v, %v, want %s", id, status, found, want)
+		}
+	}
+
+	var claimed []string
+	for {
+		status, ok := reopened.Claim(constants.JobStateSearching)
+		if !ok {
+			break
+		}
+		claimed = append(claimed, status.Job.ID)
+	}
+	if len(claimed) != 2 || claimed[0] != "downloading" || claimed[1] != "queued" {
+		t.Errorf("claimed after reopening = %v, want the interrupted job and then the queued one", claimed)
+	}
+}
+
+func TestJobStoreCompactsTheJournalOnOpen(t *testing.T) {
+	dataHome := t.TempDir()
+	now := time.Now()
+	kept := models.JobStatus{Job: models.DownloadJob{ID: "kept"}, CreatedAt: now, UpdatedAt: now}
+	expired := models.JobStatus{
+		Job:       models.DownloadJob{ID: "expired"},
+		State:     constants.JobStateDone,
+		CreatedAt: now.Add(-jobRetention - time.Hour),
+		UpdatedAt: now.Add(-jobRetention - time.Hour),
+	}
+	var journal bytes.Buffer
+	enc := json.NewEncoder(&journal)
+	enc.Encode(expired)
+	for _, state := range []constants.JobState{constants.JobStateQueued, constants.JobStateFailed, constants.JobStateQueued, constants.JobStateFailed} {
+		kept.State = state
+		enc.Encode(kept)
+	}
+	if err := os.WriteFile(filepath.Join(dataHome, jobJournalFile), journal.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := openJobStore(t, dataHome)
+	lines := journalLines(t, dataHome)
+	if len(lines) != 1 {
+		t.Fatalf("journal after opening has %d lines, want 1", len(lines))
+	}
+	var status models.JobStatus
+	if err := json.Unmarshal(lines[0], &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Job.ID != "kept" || status.State != constants.JobStateFailed {
+		t.Errorf("journal entry = %+v, want the kept job failed", status)
+	}
+	if _, found := store.Get("expired"); found {
+		t.Error("job finished past retention was loaded")
+	}
+}
+
+func TestJobStoreSkipsATruncatedLastLine(t *testing.T) {
+	dataHome := t.TempDir()
+	store := openJobStore(t, dataHome)
+	createJob(t, store, "whole")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// A crash cut the last write short.
+	journal, err := os.OpenFile(filepath.Join(dataHome, jobJournalFile), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.WriteString(`{"job":{"id":"cut","track_id":"tr`); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	reopened := openJobStore(t, dataHome)
+	if _, found := reopened.Get("whole"); !found {
+		t.Fatal("job before the truncated line was lost")
+	}
+	if _, found := reopened.Get("cut"); found {
+		t.Fatal("truncated job was loaded")
+	}
+	// The next change is not glued onto the truncated line.
+	createJob(t, reopened, "next")
+	if err := reopened.Close(); err != nil {
+		t.Fatal(err)
+	}
+	again := openJobStore(t, dataHome)
+	if _, found := again.Get("next"); !found {
+		t.Error("job created after the truncated line was lost")
+	}
+}
+
+func TestJobStoreCompactsTheJournalOnceItGrows(t *testing.T) {
+	dataHome := t.TempDir()
+	store := openJobStore(t, dataHome)
+	store.compactSize = 2048
+	createJob(t, store, "expired")
+	setJobState(t, store, "expired", constants.JobStateDone)
+	store.jobs["expired"].UpdatedAt = time.Now().Add(-jobRetention - time.Hour)
+	createJob(t, store, "retried")
+	for range 50 {
+		setJobState(t, store, "retried", constants.JobStateFailed)
+		setJobState(t, store, "retried", constants.JobStateQueued)
+	}
+
+	if lines := journalLines(t, dataHome); len(lines) > 20 {
+		t.Errorf("journal has %d lines after 100 changes, want it compacted", len(lines))
+	}
+	if _, found := store.Get("expired"); found {
+		t.Error("job finished past retention survived compaction")
+	}
+	setJobState(t, store, "retried", constants.JobStateFailed)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := openJobStore(t, dataHome)
+	if status, found := reopened.Get("retried"); !found || status.State != constants.JobStateFailed {
+		t.Errorf("job after reopening = %+v, %v, want its last change kept", status, found)
+	}
+}
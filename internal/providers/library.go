@@ -0,0 +1,137 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+type libraryIndex struct {
+	musicHome string
+
+	mu        sync.RWMutex
+	byTrackID map[string]string
+	byISRC    map[string]string
+}
+
+func NewLibraryProvider(musicHome string) ports.LibraryProvider {
+	return &libraryIndex{
+		musicHome: musicHome,
+		byTrackID: make(map[string]string),
+		byISRC:    make(map[string]string),
+	}
+}
+
+// Scan rebuilds the index from the tags of every audio file under MUSIC_HOME.
+// Hidden directories, which hold staging files and service data, are skipped.
+// Files whose tags cannot be read, and directories that cannot be listed, are
+// logged and left out of the index; only an unreadable MUSIC_HOME fails the
+// scan.
+func (l *libraryIndex) Scan(ctx context.Context) (models.LibraryStats, error) {
+	log := logger.From(ctx)
+	byTrackID := make(map[string]string)
+	byISRC := make(map[string]string)
+	files, unreadable := 0, 0
+
+	err := filepath.WalkDir(l.musicHome, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == l.musicHome {
+				return err
+			}
+			log.Warn("skipping unreadable library entry", "path", path, "err", err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != l.musicHome && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		read, ok := tagReaders[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return nil
+		}
+
+		files++
+		ids, err := read(path)
+		if err != nil {
+			log.Debug("failed to read library file tags", "path", path, "err", err)
+			unreadable++
+			return nil
+		}
+		if ids.trackID != "" {
+			byTrackID[ids.trackID] = path
+		}
+		if ids.isrc != "" {
+			byISRC[strings.ToUpper(ids.isrc)] = path
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		log.Error("failed to scan library", "err", err)
+		return models.LibraryStats{}, errors.New("library scan failed")
+	}
+
+	l.mu.Lock()
+	l.byTrackID, l.byISRC = byTrackID, byISRC
+	l.mu.Unlock()
+	log.Info("scanned library", "files", files, "unreadable", unreadable, "track_ids", len(byTrackID), "isrcs", len(byISRC))
+	return models.LibraryStats{Files: files, Unreadable: unreadable, TrackIDs: len(byTrackID), ISRCs: len(byISRC)}, nil
+}
+
+// Lookup returns the library file holding the track with trackID or, failing
+// that, the recording with isrc. Entries whose file has since been removed
+// are dropped.
+func (l *libraryIndex) Lookup(trackID string, isrc string) (string, bool) {
+	isrc = strings.ToUpper(isrc)
+	l.mu.RLock()
+	path, ok := l.byTrackID[trackID]
+	if !ok && isrc != "" {
+		path, ok = l.byISRC[isrc]
+	}
+	l.mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		l.mu.Lock()
+		if l.byTrackID[trackID] == path {
+			delete(l.byTrackID, trackID)
+		}
+		if l.byISRC[isrc] == path {
+			delete(l.byISRC, isrc)
+		}
+		l.mu.Unlock()
+		return "", false
+	}
+	return path, true
+}
+
+func (l *libraryIndex) Add(path string, job *models.DownloadJob) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if job.TrackID != "" {
+		l.byTrackID[job.TrackID] = path
+	}
+	if job.ISRC != "" {
+		l.byISRC[strings.ToUpper(job.ISRC)] = path
+	}
+}
@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"audio-scraper/internal/models"
+)
+
+// writeLibraryFile writes data under root, creating parent directories.
+func writeLibraryFile(t *testing.T, root string, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLibraryScanIndexesEveryFormat(t *testing.T) {
+	root := t.TempDir()
+	comments := func(trackID, isrc string) []byte {
+		return vorbisCommentBlock("SPOTIFY_TRACK_ID="+trackID, "ISRC="+isrc)
+	}
+	flac := writeLibraryFile(t, root, "A/flac.flac", flacFile(flacBlock{typ: 0, body: make([]byte, 34)}, flacBlock{typ: 4, body: comments("flac", "isrcflac")}))
+	opus := writeLibraryFile(t, root, "A/opus.opus", oggStream(1, 255, testOpusHead, append([]byte("OpusTags"), comments("opus", "ISRCOPUS")...)))
+	m4a := writeLibraryFile(t, root, "B/m4a.m4a", mp4Fixture(false, true, mp4Ilst(&models.DownloadJob{TrackID: "m4a", ISRC: "ISRCM4A"}, nil)))
+	mp3 := writeLibraryFile(t, root, "B/mp3.MP3", mp3Audio)
+	if err := (id3Writer{}).WriteTags(quietContext(), mp3, &models.DownloadJob{Track: "t", TrackID: "mp3", ISRC: "ISRCMP3"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	writeLibraryFile(t, root, "B/broken.flac", []byte("not flac"))
+	writeLibraryFile(t, root, "B/cover.jpg", testCover.data)
+	writeLibraryFile(t, root, ".staging/staged.opus", oggStream(1, 255, testOpusHead, append([]byte("OpusTags"), comments("staged", "ISRCSTAGED")...)))
+
+	library := NewLibraryProvider(root)
+	stats, err := library.Scan(quietContext())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	want := models.LibraryStats{Files: 5, Unreadable: 1, TrackIDs: 4, ISRCs: 4}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	for trackID, path := range map[string]string{"flac": flac, "opus": opus, "m4a": m4a, "mp3": mp3} {
+		if got, ok := library.Lookup(trackID, ""); !ok || got != path {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", trackID, got, ok, path)
+		}
+	}
+	if got, ok := library.Lookup("unknown", "isrcopus"); !ok || got != opus {
+		t.Errorf("Lookup by ISRC = %q, %v, want %q", got, ok, opus)
+	}
+	if _, ok := library.Lookup("staged", ""); ok {
+		t.Error("file in a hidden directory indexed")
+	}
+
+	os.Remove(flac)
+	if _, ok := library.Lookup("flac", ""); ok {
+		t.Error("removed file still found")
+	}
+}
+
+func TestLibraryScanMissingRoot(t *testing.T) {
+	stats, err := NewLibraryProvider(filepath.Join(t.TempDir(), "missing")).Scan(quietContext())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if stats != (models.LibraryStats{}) {
+		t.Errorf("stats = %+v, want none", stats)
+	}
+}
+
+func TestLibraryScanSkipsUnreadableDirectories(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced for root")
+	}
+	root := t.TempDir()
+	writeLibraryFile(t, root, "open/track.opus", oggStream(1, 255, testOpusHead, append([]byte("OpusTags"), vorbisCommentBlock("SPOTIFY_TRACK_ID=open")...)))
+	locked := filepath.Join(root, "locked")
+	writeLibraryFile(t, locked, "track.opus", oggStream(1, 255, testOpusHead, append([]byte("OpusTags"), vorbisCommentBlock("SPOTIFY_TRACK_ID=locked")...)))
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+
+	library := NewLibraryProvider(root)
+	if _, err := library.Scan(quietContext()); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if _, ok := library.Lookup("open", ""); !ok {
+		t.Error("readable file not indexed")
+	}
+
+	if err := os.Chmod(root, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(root, 0755) })
+	if _, err := library.Scan(quietContext()); err == nil {
+		t.Error("Scan succeeded on an unreadable MUSIC_HOME")
+	}
+}
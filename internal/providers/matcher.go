@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"audio-scraper/internal/models"
+)
+
+// minTitleSimilarity rejects candidates whose title is clearly a different
+// song, however well the rest of the metadata lines up.
+const minTitleSimilarity = 0.5
+
+// Scoring weights. Duration is the most reliable signal: covers, live
+// versions and extended mixes usually share title and artist but not length.
+const (
+	weightDuration = 0.4
+	weightTitle    = 0.3
+	weightArtist   = 0.2
+	weightAlbum    = 0.1
+)
+
+// Durations within durationExact of each other score fully; the score then
+// falls off linearly and reaches zero at durationCutoff.
+const (
+	durationExactMs  = 3000
+	durationCutoffMs = 20000
+)
+
+var titleDecorations = regexp.MustCompile(`\s*(\(.*?\)|\[.*?\]|\s-\s.*$)`)
+
+// scoreCandidate rates how likely candidate is the recording described by
+// job, from 0 to 1. Signals that either side lacks are left out and the
+// remaining weights are rescaled.
+func scoreCandidate(job *models.DownloadJob, candidate *models.YTCandidate) float64 {
+	title := titleSimilarity(job.Track, candidate.Title)
+	if title < minTitleSimilarity {
+		return 0
+	}
+
+	score := weightTitle * title
+	total := weightTitle
+
+	if job.Artist != "" && len(candidate.Artists) > 0 {
+		best := 0.0
+		for _, artist := range candidate.Artists {
+			best = max(best, similarity(job.Artist, artist))
+		}
+		best = max(best, similarity(job.Artist, strings.Join(candidate.Artists, " ")))
+		score += weightArtist * best
+		total += weightArtist
+	}
+	if job.Album != "" && candidate.Album != "" {
+		score += weightAlbum * titleSimilarity(job.Album, candidate.Album)
+		total += weightAlbum
+	}
+	if job.DurationMs > 0 && candidate.DurationMs > 0 {
+		score += weightDuration * durationSimilarity(job.DurationMs, candidate.DurationMs)
+		total += weightDuration
+	}
+	return score / total
+}
+
+func durationSimilarity(a int, b int) float64 {
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff <= durationExactMs {
+		return 1
+	}
+	if diff >= durationCutoffMs {
+		return 0
+	}
+	return 1 - float64(diff-durationExactMs)/float64(durationCutoffMs-durationExactMs)
+}
+
+// titleSimilarity compares titles both as given and with decorations such as
+// "(Remastered 2011)" or " - Live" stripped, keeping the better result.
+func titleSimilarity(a string, b string) float64 {
+	full := similarity(a, b)
+	stripped := similarity(titleDecorations.ReplaceAllString(a, ""), titleDecorations.ReplaceAllString(b, ""))
+	return max(full, stripped)
+}
+
+// similarity is the better of the normalized edit-distance ratio and the
+// token overlap (Dice coefficient) of two strings.
+func similarity(a string, b string) float64 {
+	a, b = normalizeForMatch(a), normalizeForMatch(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	return max(levenshteinRatio(a, b), tokenDice(a, b))
+}
+
+func normalizeForMatch(s string) string {
+	s = strings.ToLower(s)
+	s = strings.ReplaceAll(s, "&", " and ")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return r
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func levenshteinRatio(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+func tokenDice(a string, b string) float64 {
+	ta, tb := strings.Fields(a), strings.Fields(b)
+	counts := make(map[string]int, len(ta))
+	for _, t := range ta {
+		counts[t]++
+	}
+	common := 0
+	for _, t := range tb {
+		if counts[t] > 0 {
+			counts[t]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(ta)+len(tb))
+}
@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+const mirrorsFile = "mirrors.json"
+
+// mirrorClient keeps the mirrored playlists in memory and rewrites
+// DATA_HOME/mirrors.json on every change, the same way the watchlist is
+// kept.
+type mirrorClient struct {
+	log     ports.Logger
+	path    string
+	mirrors map[string]models.MirroredPlaylist
+	mu      sync.RWMutex
+}
+
+func NewMirrorProvider(l ports.Logger, dataHome string) (ports.MirrorProvider, error) {
+	if dataHome == "" {
+		return nil, errors.New("missing DATA_HOME")
+	}
+	if err := os.MkdirAll(dataHome, 0755); err != nil {
+		l.Error("failed to create data directory", "path", dataHome, "err", err)
+		return nil, errors.New("failed to create data directory")
+	}
+
+	m := &mirrorClient{
+		log:     l.With("component", "Mirrors"),
+		path:    filepath.Join(dataHome, mirrorsFile),
+		mirrors: make(map[string]models.MirroredPlaylist),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// List returns the mirrors ordered by when they were added.
+func (m *mirrorClient) List() []models.MirroredPlaylist {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mirrors := make([]models.MirroredPlaylist, 0, len(m.mirrors))
+	for _, mirror := range m.mirrors {
+		mirrors = append(mirrors, mirror)
+	}
+	sort.Slice(mirrors, func(i, j int) bool {
+		if !mirrors[i].CreatedAt.Equal(mirrors[j].CreatedAt) {
+			return mirrors[i].CreatedAt.Before(mirrors[j].CreatedAt)
+		}
+		return mirrors[i].PlaylistID < mirrors[j].PlaylistID
+	})
+	return mirrors
+}
+
+func (m *mirrorClient) Get(playlistID string) (models.MirroredPlaylist, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mirror, exists := m.mirrors[playlistID]
+	return mirror, exists
+}
+
+// Put adds or replaces a mirror. The change is kept only if it was saved.
+func (m *mirrorClient) Put(mirror models.MirroredPlaylist) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous, existed := m.mirrors[mirror.PlaylistID]
+	m.mirrors[mirror.PlaylistID] = mirror
+	if err := m.save(); err != nil {
+		if existed {
+			m.mirrors[mirror.PlaylistID] = previous
+		} else {
+			delete(m.mirrors, mirror.PlaylistID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *mirrorClient) Delete(playlistID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mirror, exists := m.mirrors[playlistID]
+	if !exists {
+		return ports.ErrPlaylistNotMirrored
+	}
+	delete(m.mirrors, playlistID)
+	if err := m.save(); err != nil {
+		m.mirrors[playlistID] = mirror
+		return err
+	}
+	return nil
+}
+
+func (m *mirrorClient) load() error {
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		m.log.Error("failed to read mirrors", "path", m.path, "err", err)
+		return errors.New("read mirrors failed")
+	}
+
+	var mirrors []models.MirroredPlaylist
+	if err := json.Unmarshal(data, &mirrors); err != nil {
+		m.log.Error("failed to decode mirrors", "path", m.path, "err", err)
+		return errors.New("decode mirrors failed")
+	}
+	for _, mirror := range mirrors {
+		m.mirrors[mirror.PlaylistID] = mirror
+	}
+	m.log.Info("loaded mirrors", "mirrors", len(m.mirrors))
+	return nil
+}
+
+// save writes the mirrors to a temporary file and renames it over the old
+// one. Callers hold the lock.
+func (m *mirrorClient) save() error {
+	mirrors := make([]models.MirroredPlaylist, 0, len(m.mirrors))
+	for _, mirror := range m.mirrors {
+		mirrors = append(mirrors, mirror)
+	}
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].PlaylistID < mirrors[j].PlaylistID })
+	data, err := json.Marshal(mirrors)
+	if err != nil {
+		m.log.Error("failed to encode mirrors", "err", err)
+		return errors.New("encode mirrors failed")
+	}
+	if err := writeFileAtomic(m.path, data); err != nil {
+		m.log.Error("failed to write mirrors", "path", m.path, "err", err)
+		return errors.New("write mirrors failed")
+	}
+	return nil
+}
@@ -0,0 +1,516 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+)
+
+// mp4Writer tags M4A files with iTunes-style metadata by rewriting the
+// moov/udta/meta/ilst atom in place of any existing one.
+type mp4Writer struct{}
+
+// Data atom type indicators used by iTunes metadata items.
+const (
+	mp4TypeBinary = 0
+	mp4TypeUTF8   = 1
+	mp4TypeJPEG   = 13
+	mp4TypePNG    = 14
+	mp4TypeInt    = 21
+)
+
+// mp4FreeformMean is the namespace of freeform ("----") items written by iTunes
+// and understood by most taggers.
+const mp4FreeformMean = "com.apple.iTunes"
+
+// Containers on the path from moov to the chunk offset tables.
+var mp4OffsetContainers = map[string]bool{"trak": true, "mdia": true, "minf": true, "stbl": true}
+
+type mp4Box struct {
+	typ       string
+	start     int
+	headerLen int
+	end       int
+}
+
+func (mp4Writer) WriteTags(ctx context.Context, filePath string, job *models.DownloadJob, cover *coverArt) error {
+	log := logger.From(ctx)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		log.Error("failed to read mp4 file", "err", err)
+		return errors.New("read mp4 file failed")
+	}
+
+	tagged, err := tagMP4(data, mp4Ilst(job, cover))
+	if err != nil {
+		log.Error("failed to rewrite mp4 metadata", "err", err)
+		return errors.New("write mp4 tags failed")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tagging-*.m4a")
+	if err != nil {
+		log.Error("failed to create temporary mp4 file", "err", err)
+		return errors.New("write mp4 tags failed")
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(tagged)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Error("failed to write temporary mp4 file", "err", err)
+		return errors.New("write mp4 tags failed")
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		log.Error("failed to replace tagged mp4 file", "err", err)
+		return errors.New("write mp4 tags failed")
+	}
+
+	return nil
+}
+
+// tagMP4 returns data with its metadata item list replaced by ilst. When the
+// moov atom sits before the media data its size change moves every chunk, so
+// the chunk offset tables are shifted to match.
+func tagMP4(data []byte, ilst []byte) ([]byte, error) {
+	boxes, err := parseMP4Boxes(data)
+	if err != nil {
+		return nil, err
+	}
+	moovIndex := -1
+	for i, box := range boxes {
+		if box.typ == "moov" {
+			moovIndex = i
+			break
+		}
+	}
+	if moovIndex < 0 {
+		return nil, errors.New("no moov atom")
+	}
+	moov := boxes[moovIndex]
+	payload := data[moov.start+moov.headerLen : moov.end]
+
+	newMoov, err := buildMoov(payload, ilst, int64(moov.end), 0)
+	if err != nil {
+		return nil, err
+	}
+	if delta := int64(len(newMoov)) - int64(moov.end-moov.start); delta != 0 {
+		newMoov, err = buildMoov(payload, ilst, int64(moov.end), delta)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]byte, 0, len(data)-(moov.end-moov.start)+len(newMoov))
+	out = append(out, data[:moov.start]...)
+	out = append(out, newMoov...)
+	out = append(out, data[moov.end:]...)
+	return out, nil
+}
+
+func parseMP4Boxes(b []byte) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for off := 0; off < len(b); {
+		if len(b)-off < 8 {
+			return nil, errors.New("truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(b[off:]))
+		headerLen := 8
+		switch size {
+		case 0:
+			size = uint64(len(b) - off)
+		case 1:
+			if len(b)-off < 16 {
+				return nil, errors.New("truncated box header")
+			}
+			size = binary.BigEndian.Uint64(b[off+8:])
+			headerLen = 16
+		}
+		if size < uint64(headerLen) || size > uint64(len(b)-off) {
+			return nil, fmt.Errorf("invalid size for %q box", b[off+4:off+8])
+		}
+		boxes = append(boxes, mp4Box{
+			typ:       string(b[off+4 : off+8]),
+			start:     off,
+			headerLen: headerLen,
+			end:       off + int(size),
+		})
+		off += int(size)
+	}
+	return boxes, nil
+}
+
+func encodeMP4Box(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	var out []byte
+	if size > math.MaxUint32 {
+		out = binary.BigEndian.AppendUint32(out, 1)
+		out = append(out, typ...)
+		out = binary.BigEndian.AppendUint64(out, uint64(size+8))
+	} else {
+		out = binary.BigEndian.AppendUint32(out, uint32(size))
+		out = append(out, typ...)
+	}
+	for _, p := range payloads {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// buildMoov rebuilds the moov atom with ilst as its metadata, shifting chunk
+// offsets at or past from by delta.
+func buildMoov(payload []byte, ilst []byte, from int64, delta int64) ([]byte, error) {
+	children, err := parseMP4Boxes(payload)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	hasUdta := false
+	for _, child := range children {
+		body := payload[child.start+child.headerLen : child.end]
+		switch {
+		case child.typ == "udta":
+			hasUdta = true
+			udta, err := buildUdta(body, ilst)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(udta)
+		case mp4OffsetContainers[child.typ] && delta != 0:
+			box, err := shiftChunkOffsets(child.typ, body, from, delta)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(box)
+		default:
+			out.Write(payload[child.start:child.end])
+		}
+	}
+	if !hasUdta {
+		out.Write(encodeMP4Box("udta", newMP4Meta(ilst)))
+	}
+	return encodeMP4Box("moov", out.Bytes()), nil
+}
+
+func buildUdta(payload []byte, ilst []byte) ([]byte, error) {
+	children, err := parseMP4Boxes(payload)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	hasMeta := false
+	for _, child := range children {
+		if child.typ != "meta" {
+			out.Write(payload[child.start:child.end])
+			continue
+		}
+		hasMeta = true
+		meta, err := buildMeta(payload[child.start+child.headerLen:child.end], ilst)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(meta)
+	}
+	if !hasMeta {
+		out.Write(newMP4Meta(ilst))
+	}
+	return encodeMP4Box("udta", out.Bytes()), nil
+}
+
+// buildMeta replaces the ilst of an existing meta atom, keeping its handler
+// and any other children.
+func buildMeta(payload []byte, ilst []byte) ([]byte, error) {
+	if len(payload) < 4 {
+		return nil, errors.New("truncated meta atom")
+	}
+	children, err := parseMP4Boxes(payload[4:])
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.Write(payload[:4])
+	hasIlst := false
+	for _, child := range children {
+		if child.typ == "ilst" {
+			if !hasIlst {
+				out.Write(ilst)
+			}
+			hasIlst = true
+			continue
+		}
+		out.Write(payload[4+child.start : 4+child.end])
+	}
+	if !hasIlst {
+		out.Write(ilst)
+	}
+	return encodeMP4Box("meta", out.Bytes()), nil
+}
+
+func newMP4Meta(ilst []byte) []byte {
+	hdlr := make([]byte, 0, 25)
+	hdlr = append(hdlr, 0, 0, 0, 0) // version and flags
+	hdlr = append(hdlr, 0, 0, 0, 0) // pre-defined
+	hdlr = append(hdlr, "mdirappl"...)
+	hdlr = append(hdlr, make([]byte, 8)...)
+	hdlr = append(hdlr, 0) // empty name
+	return encodeMP4Box("meta", []byte{0, 0, 0, 0}, encodeMP4Box("hdlr", hdlr), ilst)
+}
+
+func shiftChunkOffsets(typ string, payload []byte, from int64, delta int64) ([]byte, error) {
+	switch {
+	case mp4OffsetContainers[typ]:
+		children, err := parseMP4Boxes(payload)
+		if err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		for _, child := range children {
+			box, err := shiftChunkOffsets(child.typ, payload[child.start+child.headerLen:child.end], from, delta)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(box)
+		}
+		return encodeMP4Box(typ, out.Bytes()), nil
+	case typ == "stco" || typ == "co64":
+		width := 4
+		if typ == "co64" {
+			width = 8
+		}
+		if len(payload) < 8 {
+			return nil, fmt.Errorf("truncated %s atom", typ)
+		}
+		count := int(binary.BigEndian.Uint32(payload[4:]))
+		if len(payload) < 8+count*width {
+			return nil, fmt.Errorf("truncated %s atom", typ)
+		}
+		shifted := bytes.Clone(payload)
+		for i := 0; i < count; i++ {
+			entry := shifted[8+i*width:]
+			if width == 4 {
+				offset := int64(binary.BigEndian.Uint32(entry))
+				if offset < from {
+					continue
+				}
+				if offset+delta > math.MaxUint32 {
+					return nil, errors.New("chunk offset overflows stco")
+				}
+				binary.BigEndian.PutUint32(entry, uint32(offset+delta))
+			} else {
+				offset := int64(binary.BigEndian.Uint64(entry))
+				if offset < from {
+					continue
+				}
+				binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+			}
+		}
+		return encodeMP4Box(typ, shifted), nil
+	default:
+		return encodeMP4Box(typ, payload), nil
+	}
+}
+
+func mp4Ilst(job *models.DownloadJob, cover *coverArt) []byte {
+	var items [][]byte
+	text := func(name string, value string) {
+		if value != "" {
+			items = append(items, encodeMP4Box(name, mp4Data(mp4TypeUTF8, []byte(value))))
+		}
+	}
+	freeform := func(name string, value string) {
+		if value == "" {
+			return
+		}
+		items = append(items, encodeMP4Box("----",
+			encodeMP4Box("mean", []byte{0, 0, 0, 0}, []byte(mp4FreeformMean)),
+			encodeMP4Box("name", []byte{0, 0, 0, 0}, []byte(name)),
+			mp4Data(mp4TypeUTF8, []byte(value)),
+		))
+	}
+
+	text("\xa9nam", job.Track)
+	text("\xa9ART", job.Artist)
+	text("aART", job.AlbumArtist)
+	text("\xa9alb", job.Album)
+	text("\xa9day", job.ReleaseDate)
+	text("\xa9gen", strings.Join(job.Genres, tagValueSeparator))
+	text("cprt", job.Copyright)
+	if job.TrackNumber > 0 {
+		trkn := make([]byte, 8)
+		binary.BigEndian.PutUint16(trkn[2:], uint16(job.TrackNumber))
+		binary.BigEndian.PutUint16(trkn[4:], uint16(job.TrackTotal))
+		items = append(items, encodeMP4Box("trkn", mp4Data(mp4TypeBinary, trkn)))
+	}
+	if job.DiscNumber > 0 {
+		disk := make([]byte, 6)
+		binary.BigEndian.PutUint16(disk[2:], uint16(job.DiscNumber))
+		binary.BigEndian.PutUint16(disk[4:], uint16(job.DiscTotal))
+		items = append(items, encodeMP4Box("disk", mp4Data(mp4TypeBinary, disk)))
+	}
+	if job.Compilation {
+		items = append(items, encodeMP4Box("cpil", mp4Data(mp4TypeInt, []byte{1})))
+	}
+	if cover != nil {
+		dataType := uint32(mp4TypeJPEG)
+		if cover.mime == "image/png" {
+			dataType = mp4TypePNG
+		}
+		items = append(items, encodeMP4Box("covr", mp4Data(dataType, cover.data)))
+	}
+	freeform(tagISRC, job.ISRC)
+	freeform(tagArtists, strings.Join(job.Artists, tagValueSeparator))
+	freeform(tagSpotifyTrackID, job.TrackID)
+	freeform(tagSpotifyAlbumID, job.AlbumID)
+
+	return encodeMP4Box("ilst", items...)
+}
+
+func mp4Data(dataType uint32, value []byte) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, dataType) // version 0, type in flags
+	return encodeMP4Box("data", header, value)
+}
+
+// readMP4IDs reads the freeform ISRC and Spotify track ID items. Only the
+// moov atom is loaded; the media data is skipped over.
+func readMP4IDs(filePath string) (trackIDs, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return trackIDs{}, err
+	}
+	defer f.Close()
+
+	moov, err := readTopLevelMP4Box(f, "moov")
+	if err != nil {
+		return trackIDs{}, err
+	}
+	ilst := findMP4Box(moov, "udta", "meta", "ilst")
+	if ilst == nil {
+		return trackIDs{}, nil
+	}
+	items, err := parseMP4Boxes(ilst)
+	if err != nil {
+		return trackIDs{}, err
+	}
+
+	var ids trackIDs
+	for _, item := range items {
+		if item.typ != "----" {
+			continue
+		}
+		payload := ilst[item.start+item.headerLen : item.end]
+		name, value := mp4FreeformItem(payload)
+		switch name {
+		case tagSpotifyTrackID:
+			ids.trackID = value
+		case tagISRC:
+			ids.isrc = value
+		}
+	}
+	return ids, nil
+}
+
+func readTopLevelMP4Box(f *os.File, typ string) ([]byte, error) {
+	header := make([]byte, 16)
+	for off := int64(0); ; {
+		if _, err := f.ReadAt(header[:8], off); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			info, err := f.Stat()
+			if err != nil {
+				return nil, err
+			}
+			size = info.Size() - off
+		case 1:
+			if _, err := f.ReadAt(header[8:16], off+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerLen = 16
+		}
+		if size < headerLen {
+			return nil, fmt.Errorf("invalid size for %q box", header[4:8])
+		}
+		if string(header[4:8]) == typ {
+			if size-headerLen > maxCommentSize*4 {
+				return nil, fmt.Errorf("%s atom too large", typ)
+			}
+			payload := make([]byte, size-headerLen)
+			if _, err := f.ReadAt(payload, off+headerLen); err != nil {
+				return nil, err
+			}
+			return payload, nil
+		}
+		off += size
+	}
+}
+
+// findMP4Box follows path down from the children of payload and returns the
+// payload of the box it ends at, or nil. meta is a full box, so its version
+// and flags are skipped.
+func findMP4Box(payload []byte, path ...string) []byte {
+	for _, typ := range path {
+		boxes, err := parseMP4Boxes(payload)
+		if err != nil {
+			return nil
+		}
+		var found []byte
+		for _, box := range boxes {
+			if box.typ == typ {
+				found = payload[box.start+box.headerLen : box.end]
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		if typ == "meta" {
+			if len(found) < 4 {
+				return nil
+			}
+			found = found[4:]
+		}
+		payload = found
+	}
+	return payload
+}
+
+// mp4FreeformItem returns the name and text value of a "----" item.
+func mp4FreeformItem(payload []byte) (string, string) {
+	children, err := parseMP4Boxes(payload)
+	if err != nil {
+		return "", ""
+	}
+	var name, value string
+	for _, child := range children {
+		body := payload[child.start+child.headerLen : child.end]
+		if len(body) < 4 {
+			continue
+		}
+		switch child.typ {
+		case "name":
+			name = string(body[4:])
+		case "data":
+			if len(body) >= 8 {
+				value = string(body[8:])
+			}
+		}
+	}
+	return name, value
+}
@@ -0,0 +1,244 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// mp4Chunks are the sample chunks stored in the fixture's mdat.
+var mp4Chunks = [][]byte{
+	[]byte("first chunk of audio samples"),
+	[]byte("second chunk"),
+	[]byte("third and last chunk of the track"),
+}
+
+// mp4Fixture builds a minimal M4A file with one track whose chunk offset
+// table, stco or co64, points at mp4Chunks in the mdat. ilst, when set, is
+// stored as existing metadata.
+func mp4Fixture(co64 bool, moovFirst bool, ilst []byte) []byte {
+	ftyp := encodeMP4Box("ftyp", []byte("M4A \x00\x00\x02\x00isomM4A "))
+	mdatPayload := []byte("pad")
+	var chunkStarts []int
+	for _, chunk := range mp4Chunks {
+		chunkStarts = append(chunkStarts, len(mdatPayload))
+		mdatPayload = append(mdatPayload, chunk...)
+		mdatPayload = append(mdatPayload, "--"...)
+	}
+	mdat := encodeMP4Box("mdat", mdatPayload)
+
+	moov := func(offsets []int) []byte {
+		typ, table := "stco", binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(offsets)))
+		for _, offset := range offsets {
+			if co64 {
+				typ = "co64"
+				table = binary.BigEndian.AppendUint64(table, uint64(offset))
+			} else {
+				table = binary.BigEndian.AppendUint32(table, uint32(offset))
+			}
+		}
+		stbl := encodeMP4Box("stbl", encodeMP4Box("stsd", make([]byte, 8)), encodeMP4Box(typ, table))
+		trak := encodeMP4Box("trak", encodeMP4Box("tkhd", make([]byte, 84)),
+			encodeMP4Box("mdia", encodeMP4Box("mdhd", make([]byte, 24)), encodeMP4Box("minf", stbl)))
+		children := [][]byte{encodeMP4Box("mvhd", make([]byte, 100)), trak}
+		if ilst != nil {
+			children = append(children, encodeMP4Box("udta", newMP4Meta(ilst)))
+		}
+		return encodeMP4Box("moov", children...)
+	}
+
+	// The moov size does not depend on the offsets it holds, so a first
+	// pass finds where the mdat lands.
+	mdatStart := len(ftyp)
+	if moovFirst {
+		mdatStart += len(moov(make([]int, len(mp4Chunks))))
+	}
+	offsets := make([]int, len(mp4Chunks))
+	for i, start := range chunkStarts {
+		offsets[i] = mdatStart + 8 + start
+	}
+
+	if moovFirst {
+		return bytes.Join([][]byte{ftyp, moov(offsets), mdat}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, moov(offsets)}, nil)
+}
+
+// mp4ChunkOffsets reads the chunk offset table of the first track.
+func mp4ChunkOffsets(t *testing.T, data []byte) []int64 {
+	t.Helper()
+	moov := mp4TopLevelBox(t, data, "moov")
+	for _, typ := range []string{"stco", "co64"} {
+		table := findMP4Box(moov, "trak", "mdia", "minf", "stbl", typ)
+		if table == nil {
+			continue
+		}
+		count := int(binary.BigEndian.Uint32(table[4:]))
+		offsets := make([]int64, count)
+		for i := range offsets {
+			if typ == "stco" {
+				offsets[i] = int64(binary.BigEndian.Uint32(table[8+i*4:]))
+			} else {
+				offsets[i] = int64(binary.BigEndian.Uint64(table[8+i*8:]))
+			}
+		}
+		return offsets
+	}
+	t.Fatal("no chunk offset table")
+	return nil
+}
+
+func mp4TopLevelBox(t *testing.T, data []byte, typ string) []byte {
+	t.Helper()
+	boxes, err := parseMP4Boxes(data)
+	if err != nil {
+		t.Fatalf("parse boxes: %v", err)
+	}
+	for _, box := range boxes {
+		if box.typ == typ {
+			return data[box.start+box.headerLen : box.end]
+		}
+	}
+	t.Fatalf("no %s atom", typ)
+	return nil
+}
+
+// mp4Items maps the items of the ilst to the value of their data atom, with
+// freeform items keyed by name.
+func mp4Items(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	ilst := findMP4Box(mp4TopLevelBox(t, data, "moov"), "udta", "meta", "ilst")
+	if ilst == nil {
+		t.Fatal("no ilst atom")
+	}
+	boxes, err := parseMP4Boxes(ilst)
+	if err != nil {
+		t.Fatalf("parse ilst: %v", err)
+	}
+	items := make(map[string][]byte)
+	for _, box := range boxes {
+		payload := ilst[box.start+box.headerLen : box.end]
+		if box.typ == "----" {
+			name, value := mp4FreeformItem(payload)
+			items[name] = []byte(value)
+			continue
+		}
+		if data := findMP4Box(payload, "data"); data != nil {
+			items[box.typ] = data[8:]
+		}
+	}
+	return items
+}
+
+func TestMP4TagsKeepChunkOffsets(t *testing.T) {
+	for _, co64 := range []bool{false, true} {
+		for _, moovFirst := range []bool{true, false} {
+			for _, existing := range [][]byte{nil, oldMP4Tags()} {
+				name := fmt.Sprintf("co64=%v/moov_first=%v/existing_tags=%v", co64, moovFirst, existing != nil)
+				t.Run(name, func(t *testing.T) {
+					original := mp4Fixture(co64, moovFirst, existing)
+					path := writeTestFile(t, "track.m4a", original)
+					if err := (mp4Writer{}).WriteTags(quietContext(), path, taggedJob(), testCover); err != nil {
+						t.Fatalf("WriteTags: %v", err)
+					}
+					tagged, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if moovFirst && len(tagged) == len(original) {
+						t.Fatal("moov did not grow, so the offsets were not exercised")
+					}
+					offsets := mp4ChunkOffsets(t, tagged)
+					if len(offsets) != len(mp4Chunks) {
+						t.Fatalf("got %d chunk offsets, want %d", len(offsets), len(mp4Chunks))
+					}
+					for i, offset := range offsets {
+						chunk := mp4Chunks[i]
+						if offset+int64(len(chunk)) > int64(len(tagged)) || !bytes.Equal(tagged[offset:offset+int64(len(chunk))], chunk) {
+							t.Errorf("chunk %d offset %d no longer points at its samples", i, offset)
+						}
+					}
+					if !bytes.Equal(mp4TopLevelBox(t, tagged, "mdat"), mp4TopLevelBox(t, original, "mdat")) {
+						t.Error("mdat changed")
+					}
+
+					ids, err := readMP4IDs(path)
+					if err != nil {
+						t.Fatalf("readMP4IDs: %v", err)
+					}
+					if ids != (trackIDs{trackID: "6LgJvl0Xdtc73RJ1mmpotq", isrc: "GBAYE9700101"}) {
+						t.Errorf("ids = %+v", ids)
+					}
+				})
+			}
+		}
+	}
+}
+
+// oldMP4Tags is the metadata of a fixture that was tagged before.
+func oldMP4Tags() []byte {
+	job := taggedJob()
+	job.Track = "Old Title"
+	job.TrackID = "old"
+	return mp4Ilst(job, nil)
+}
+
+func TestMP4RoundTrip(t *testing.T) {
+	path := writeTestFile(t, "track.m4a", mp4Fixture(false, true, oldMP4Tags()))
+	if err := (mp4Writer{}).WriteTags(quietContext(), path, taggedJob(), testCover); err != nil {
+		t.Fatalf("WriteTags: %v", err)
+	}
+	tagged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := mp4Items(t, tagged)
+	texts := map[string]string{
+		"\xa9nam":         "Paranoid Android",
+		"\xa9ART":         "Radiohead",
+		"aART":            "Radiohead",
+		"\xa9alb":         "OK Computer",
+		"\xa9day":         "1997-05-21",
+		"\xa9gen":         "alternative rock; art rock",
+		"cprt":            "1997 XL Recordings",
+		tagISRC:           "GBAYE9700101",
+		tagArtists:        "Radiohead; Thom Yorke",
+		tagSpotifyTrackID: "6LgJvl0Xdtc73RJ1mmpotq",
+		tagSpotifyAlbumID: "6dVIqQ8qmQ5GBnJ9shOYGE",
+	}
+	for name, want := range texts {
+		if got := string(items[name]); got != want {
+			t.Errorf("%q = %q, want %q", name, got, want)
+		}
+	}
+	binaries := map[string][]byte{
+		"trkn": {0, 0, 0, 2, 0, 12, 0, 0},
+		"disk": {0, 0, 0, 1, 0, 2},
+		"cpil": {1},
+		"covr": testCover.data,
+	}
+	for name, want := range binaries {
+		if got := items[name]; !bytes.Equal(got, want) {
+			t.Errorf("%q = %v, want %v", name, got, want)
+		}
+	}
+
+	meta := findMP4Box(mp4TopLevelBox(t, tagged, "moov"), "udta", "meta")
+	if hdlr := findMP4Box(meta, "hdlr"); hdlr == nil || string(hdlr[8:16]) != "mdirappl" {
+		t.Error("meta handler lost")
+	}
+	if boxes, _ := parseMP4Boxes(meta); len(boxes) != 2 {
+		t.Errorf("meta has %d children, want hdlr and one ilst", len(boxes))
+	}
+}
+
+func TestMP4RejectsFileWithoutMoov(t *testing.T) {
+	path := writeTestFile(t, "track.m4a", encodeMP4Box("mdat", []byte("samples")))
+	if err := (mp4Writer{}).WriteTags(quietContext(), path, taggedJob(), nil); err == nil {
+		t.Fatal("WriteTags succeeded without a moov atom")
+	}
+}
@@ -1,3 +1,25 @@
 // Package providers implements various third-party service providers.
 // This includes clients for services like Spotify, YouTube, etc.
+//
+// # YouTube Music search
+//
+// YouTube Music has no public search API. ytMusicSource posts to the
+// internal youtubei/v1/search endpoint the web client uses, posing as that
+// client (ytMusicClientName, ytMusicClientVersion and a browser User-Agent),
+// and picks song rows out of the renderer tree of the response. This is the
+// same approach ytmusicapi takes, and like it the code breaks whenever
+// YouTube changes the response. Upkeep usually means one of:
+//
+//   - HTTP 400 or empty results: bump ytMusicClientVersion to the version
+//     music.youtube.com currently sends (the clientVersion in the body of any
+//     search request in the browser's network tab).
+//   - Songs found but with no artists, album or duration: the layout of the
+//     second flex column changed; adjust parseYTMusicItem.
+//   - Only non-song results: the songs filter changed; copy the new params
+//     value from a search with the "Songs" chip selected into
+//     ytMusicSongsFilter.
+//
+// ytmusic_test.go holds a song row as the web client returned it; update it
+// alongside the parser. Matching and scoring only see ports.YTCandidateSource,
+// so another backend can replace ytMusicSource without touching them.
 package providers
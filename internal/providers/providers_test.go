@@ -0,0 +1,19 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/ports"
+)
+
+// quietLogger discards everything, keeping test output readable.
+func quietLogger() ports.Logger {
+	return logger.New(io.Discard, slog.LevelError+1)
+}
+
+func quietContext() context.Context {
+	return logger.Into(context.Background(), quietLogger())
+}
@@ -3,67 +3,246 @@ package providers
 import (
 	"context"
 	"errors"
+	"net/http"
+	"sync"
 
 	"github.com/zmb3/spotify/v2"
 	spotifyauth "github.com/zmb3/spotify/v2/auth"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 
 	"audio-scraper/internal/logger"
+	"audio-scraper/internal/metrics"
 	"audio-scraper/internal/ports"
 )
 
 type spotifyClient struct {
 	client any
+	tokens *spotifyTokenSource
+}
+
+// spotifyTokenSource caches a client-credentials token and fetches a new one
+// once it expires or after Spotify rejects it.
+type spotifyTokenSource struct {
+	config *clientcredentials.Config
+	token  *oauth2.Token
+	mu     sync.Mutex
+}
+
+func (t *spotifyTokenSource) Token() (*oauth2.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token.Valid() {
+		return t.token, nil
+	}
+	token, err := t.config.Token(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	t.token = token
+	return token, nil
+}
+
+func (t *spotifyTokenSource) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = nil
+}
+
+// SpotifyEndpoints are the URLs of the Spotify accounts and Web APIs. Tests
+// point them at a local fake.
+type SpotifyEndpoints struct {
+	TokenURL string
+	// APIURL is the Web API base URL, ending in a slash.
+	APIURL string
+}
+
+var DefaultSpotifyEndpoints = SpotifyEndpoints{
+	TokenURL: spotifyauth.TokenURL,
+	APIURL:   "https://api.spotify.com/v1/",
 }
 
 func NewSpotifyProvider(clientID string, clientSecret string) (ports.SpotifyProvider, error) {
+	return NewSpotifyProviderAt(clientID, clientSecret, DefaultSpotifyEndpoints)
+}
+
+// NewSpotifyProviderAt is NewSpotifyProvider talking to the given endpoints.
+func NewSpotifyProviderAt(clientID string, clientSecret string, endpoints SpotifyEndpoints) (ports.SpotifyProvider, error) {
 	if clientID == "" {
 		return nil, errors.New("missing SPOTIFY_CLIENT_ID")
 	}
 	if clientSecret == "" {
 		return nil, errors.New("missing SPOTIFY_CLIENT_SECRET")
 	}
-	ctx := context.Background()
-	config := &clientcredentials.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		TokenURL:     spotifyauth.TokenURL,
+	tokens := &spotifyTokenSource{
+		config: &clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     endpoints.TokenURL,
+		},
 	}
-	token, err := config.Token(ctx)
-	if err != nil {
+	// Fetch the first token eagerly so bad credentials fail at startup.
+	if _, err := tokens.Token(); err != nil {
 		return nil, err
 	}
 
-	httpClient := spotifyauth.New().Client(ctx, token)
-	client := spotify.New(httpClient)
-	return &spotifyClient{client: client}, nil
+	// oauth2.NewClient would wrap tokens in a ReuseTokenSource with its own
+	// cache, which invalidate could not clear.
+	httpClient := &http.Client{Transport: &oauth2.Transport{Source: tokens}}
+	client := spotify.New(httpClient, spotify.WithBaseURL(endpoints.APIURL))
+	return &spotifyClient{client: client, tokens: tokens}, nil
+}
+
+// withReauth runs fn and, if Spotify answers 401, drops the cached token and
+// runs it once more with a freshly issued one. call labels the request in
+// the Spotify metrics; pages fetched for a call count under its name.
+func withReauth[T any](ctx context.Context, s *spotifyClient, call string, fn func(client *spotify.Client) (T, error)) (T, error) {
+	client := s.client.(*spotify.Client)
+	metrics.SpotifyRequests.WithLabelValues(call).Inc()
+	result, err := fn(client)
+
+	var spotifyErr spotify.Error
+	if errors.As(err, &spotifyErr) && spotifyErr.Status == http.StatusUnauthorized {
+		logger.From(ctx).Warn("spotify rejected access token, refreshing and retrying", "err", err)
+		s.tokens.invalidate()
+		metrics.SpotifyRequests.WithLabelValues(call).Inc()
+		result, err = fn(client)
+	}
+	if err != nil {
+		metrics.SpotifyErrors.WithLabelValues(call).Inc()
+	}
+	return result, err
 }
 
 func (s *spotifyClient) Search(ctx context.Context, query string, t spotify.SearchType, opts ...spotify.RequestOption) (*spotify.SearchResult, error) {
 	log := logger.From(ctx)
 	log.Info("performing spotify search", "query", query, "type", t)
-	client := s.client.(*spotify.Client)
-	return client.Search(ctx, query, t, opts...)
+	return withReauth(ctx, s, "search", func(client *spotify.Client) (*spotify.SearchResult, error) {
+		return client.Search(ctx, query, t, opts...)
+	})
 }
 
 func (s *spotifyClient) GetTrack(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullTrack, error) {
 	log := logger.From(ctx)
 	log.Info("fetching spotify track", "track_id", id)
-	client := s.client.(*spotify.Client)
-	return client.GetTrack(ctx, id, opts...)
+	return withReauth(ctx, s, "get_track", func(client *spotify.Client) (*spotify.FullTrack, error) {
+		return client.GetTrack(ctx, id, opts...)
+	})
 }
 
 func (s *spotifyClient) GetAlbum(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullAlbum, error) {
 	log := logger.From(ctx)
 	log.Info("fetching spotify album", "album_id", id)
-	client := s.client.(*spotify.Client)
-	return client.GetAlbum(ctx, id, opts...)
+	return withReauth(ctx, s, "get_album", func(client *spotify.Client) (*spotify.FullAlbum, error) {
+		return client.GetAlbum(ctx, id, opts...)
+	})
 }
 
-func (s *spotifyClient) GetArtist(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.SimpleAlbumPage, error) {
+func (s *spotifyClient) GetArtist(ctx context.Context, id spotify.ID) (*spotify.FullArtist, error) {
 	log := logger.From(ctx)
 	log.Info("fetching spotify artist", "artist_id", id)
-	client := s.client.(*spotify.Client)
-	albumTypes := []spotify.AlbumType{spotify.AlbumTypeAlbum, spotify.AlbumTypeSingle, spotify.AlbumTypeAppearsOn, spotify.AlbumTypeCompilation}
-	return client.GetArtistAlbums(ctx, id, albumTypes, opts...)
+	return withReauth(ctx, s, "get_artist", func(client *spotify.Client) (*spotify.FullArtist, error) {
+		return client.GetArtist(ctx, id)
+	})
+}
+
+func (s *spotifyClient) GetAlbumTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) ([]spotify.SimpleTrack, error) {
+	log := logger.From(ctx)
+	log.Info("fetching spotify album tracks", "album_id", id)
+	opts = append(opts, spotify.Limit(50))
+	page, err := withReauth(ctx, s, "get_album_tracks", func(client *spotify.Client) (*spotify.SimpleTrackPage, error) {
+		return client.GetAlbumTracks(ctx, id, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := page.Tracks
+	for page.Next != "" {
+		// NextPage clears the page it is given, so page through a copy to keep
+		// the Next link intact for a retry.
+		page, err = withReauth(ctx, s, "get_album_tracks", func(client *spotify.Client) (*spotify.SimpleTrackPage, error) {
+			next := *page
+			return &next, client.NextPage(ctx, &next)
+		})
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, page.Tracks...)
+	}
+	log.Debug("fetched spotify album tracks", "album_id", id, "count", len(tracks))
+	return tracks, nil
+}
+
+func (s *spotifyClient) GetArtistAlbums(ctx context.Context, id spotify.ID, albumTypes []spotify.AlbumType, opts ...spotify.RequestOption) ([]spotify.SimpleAlbum, error) {
+	log := logger.From(ctx)
+	log.Info("fetching spotify artist albums", "artist_id", id)
+	if len(albumTypes) == 0 {
+		albumTypes = []spotify.AlbumType{spotify.AlbumTypeAlbum, spotify.AlbumTypeSingle, spotify.AlbumTypeAppearsOn, spotify.AlbumTypeCompilation}
+	}
+	opts = append(opts, spotify.Limit(50))
+	page, err := withReauth(ctx, s, "get_artist_albums", func(client *spotify.Client) (*spotify.SimpleAlbumPage, error) {
+		return client.GetArtistAlbums(ctx, id, albumTypes, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	albums := page.Albums
+	for page.Next != "" {
+		page, err = withReauth(ctx, s, "get_artist_albums", func(client *spotify.Client) (*spotify.SimpleAlbumPage, error) {
+			next := *page
+			return &next, client.NextPage(ctx, &next)
+		})
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, page.Albums...)
+	}
+	log.Debug("fetched spotify artist albums", "artist_id", id, "count", len(albums))
+	return albums, nil
+}
+
+func (s *spotifyClient) GetPlaylist(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullPlaylist, error) {
+	log := logger.From(ctx)
+	log.Info("fetching spotify playlist", "playlist_id", id)
+	return withReauth(ctx, s, "get_playlist", func(client *spotify.Client) (*spotify.FullPlaylist, error) {
+		return client.GetPlaylist(ctx, id, opts...)
+	})
+}
+
+// GetPlaylistTracks returns every track of a playlist in playlist order.
+// Episodes, local files and tracks unavailable in the market are skipped.
+func (s *spotifyClient) GetPlaylistTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) ([]spotify.FullTrack, error) {
+	log := logger.From(ctx)
+	log.Info("fetching spotify playlist tracks", "playlist_id", id)
+	opts = append(opts, spotify.Limit(100))
+	page, err := withReauth(ctx, s, "get_playlist_items", func(client *spotify.Client) (*spotify.PlaylistItemPage, error) {
+		return client.GetPlaylistItems(ctx, id, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []spotify.FullTrack
+	for {
+		for _, item := range page.Items {
+			if item.IsLocal || item.Track.Track == nil || item.Track.Track.ID == "" {
+				continue
+			}
+			tracks = append(tracks, *item.Track.Track)
+		}
+		if page.Next == "" {
+			break
+		}
+		page, err = withReauth(ctx, s, "get_playlist_items", func(client *spotify.Client) (*spotify.PlaylistItemPage, error) {
+			next := *page
+			return &next, client.NextPage(ctx, &next)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Debug("fetched spotify playlist tracks", "playlist_id", id, "count", len(tracks))
+	return tracks, nil
 }
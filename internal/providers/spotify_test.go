@@ -0,0 +1,171 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// fakeSpotify serves the client-credentials token endpoint and GET
+// /v1/tracks/{id}. Tokens are numbered in the order they are issued.
+type fakeSpotify struct {
+	t *testing.T
+	// expiresIn is the lifetime of issued tokens in seconds.
+	expiresIn int
+	// reject lists tokens the API answers with 401.
+	reject map[string]bool
+
+	mu         sync.Mutex
+	issued     int
+	authorized []string
+}
+
+func newFakeSpotify(t *testing.T, expiresIn int) (*fakeSpotify, SpotifyEndpoints) {
+	f := &fakeSpotify{t: t, expiresIn: expiresIn, reject: make(map[string]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/token", f.token)
+	mux.HandleFunc("GET /v1/tracks/{id}", f.track)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return f, SpotifyEndpoints{TokenURL: server.URL + "/api/token", APIURL: server.URL + "/v1/"}
+}
+
+func (f *fakeSpotify) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+	if id != "id" || secret != "secret" {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("grant_type") != "client_credentials" {
+		f.t.Errorf("grant_type = %q, want client_credentials", r.FormValue("grant_type"))
+	}
+	f.mu.Lock()
+	f.issued++
+	token := fmt.Sprintf("token-%d", f.issued)
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"access_token": token, "token_type": "Bearer", "expires_in": f.expiresIn})
+}
+
+func (f *fakeSpotify) track(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("Authorization")
+	f.mu.Lock()
+	f.authorized = append(f.authorized, token)
+	rejected := f.reject[token]
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if rejected {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"status":401,"message":"The access token expired"}}`)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"id": r.PathValue("id"), "name": "Song " + r.PathValue("id")})
+}
+
+func (f *fakeSpotify) calls() (issued int, authorized []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.issued, append([]string(nil), f.authorized...)
+}
+
+func TestSpotifyProviderReusesValidToken(t *testing.T) {
+	fake, endpoints := newFakeSpotify(t, 3600)
+	sp, err := NewSpotifyProviderAt("id", "secret", endpoints)
+	if err != nil {
+		t.Fatalf("NewSpotifyProviderAt: %v", err)
+	}
+	for _, id := range []spotify.ID{"a", "b"} {
+		if _, err := sp.GetTrack(quietContext(), id); err != nil {
+			t.Fatalf("GetTrack(%s): %v", id, err)
+		}
+	}
+
+	issued, authorized := fake.calls()
+	if issued != 1 {
+		t.Errorf("issued %d tokens, want 1", issued)
+	}
+	for _, header := range authorized {
+		if header != "Bearer token-1" {
+			t.Errorf("API called with %q, want Bearer token-1", header)
+		}
+	}
+}
+
+func TestSpotifyProviderRefreshesExpiredToken(t *testing.T) {
+	// oauth2 treats tokens expiring within 10 seconds as expired already.
+	fake, endpoints := newFakeSpotify(t, 1)
+	sp, err := NewSpotifyProviderAt("id", "secret", endpoints)
+	if err != nil {
+		t.Fatalf("NewSpotifyProviderAt: %v", err)
+	}
+	track, err := sp.GetTrack(quietContext(), "a")
+	if err != nil {
+		t.Fatalf("GetTrack: %v", err)
+	}
+	if track.Name != "Song a" {
+		t.Errorf("track name = %q, want Song a", track.Name)
+	}
+
+	issued, authorized := fake.calls()
+	if issued != 2 {
+		t.Errorf("issued %d tokens, want 2 (startup and refresh)", issued)
+	}
+	if len(authorized) != 1 || authorized[0] != "Bearer token-2" {
+		t.Errorf("API called with %q, want [Bearer token-2]", authorized)
+	}
+}
+
+func TestSpotifyProviderRetriesOnceAfter401(t *testing.T) {
+	fake, endpoints := newFakeSpotify(t, 3600)
+	fake.reject["Bearer token-1"] = true
+	sp, err := NewSpotifyProviderAt("id", "secret", endpoints)
+	if err != nil {
+		t.Fatalf("NewSpotifyProviderAt: %v", err)
+	}
+	if _, err := sp.GetTrack(quietContext(), "a"); err != nil {
+		t.Fatalf("GetTrack: %v", err)
+	}
+
+	issued, authorized := fake.calls()
+	if issued != 2 {
+		t.Errorf("issued %d tokens, want 2", issued)
+	}
+	want := []string{"Bearer token-1", "Bearer token-2"}
+	if fmt.Sprint(authorized) != fmt.Sprint(want) {
+		t.Errorf("API called with %q, want %q", authorized, want)
+	}
+}
+
+func TestSpotifyProviderGivesUpAfterSecond401(t *testing.T) {
+	fake, endpoints := newFakeSpotify(t, 3600)
+	fake.reject["Bearer token-1"] = true
+	fake.reject["Bearer token-2"] = true
+	sp, err := NewSpotifyProviderAt("id", "secret", endpoints)
+	if err != nil {
+		t.Fatalf("NewSpotifyProviderAt: %v", err)
+	}
+	_, err = sp.GetTrack(quietContext(), "a")
+	var spotifyErr spotify.Error
+	if !errors.As(err, &spotifyErr) || spotifyErr.Status != http.StatusUnauthorized {
+		t.Fatalf("GetTrack error = %v, want a 401 spotify.Error", err)
+	}
+	if _, authorized := fake.calls(); len(authorized) != 2 {
+		t.Errorf("API called %d times, want 2", len(authorized))
+	}
+}
+
+func TestSpotifyProviderRejectsBadCredentials(t *testing.T) {
+	_, endpoints := newFakeSpotify(t, 3600)
+	if _, err := NewSpotifyProviderAt("id", "wrong", endpoints); err == nil {
+		t.Fatal("NewSpotifyProviderAt succeeded with bad credentials")
+	}
+}
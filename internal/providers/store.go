@@ -9,7 +9,6 @@ import (
 )
 
 const cleanupInterval = 30 * time.Minute
-const storeTTL = 10 * time.Minute
 
 type choiceItem struct {
 	choices   models.Choices
@@ -19,14 +18,17 @@ type choiceItem struct {
 type storeClient struct {
 	log         ports.Logger
 	requestData map[string]choiceItem
+	ttl         time.Duration
 	mu          sync.RWMutex
 	done        chan struct{}
 }
 
-func NewStoreProvider(l ports.Logger) ports.StoreProvider {
+// NewStoreProvider keeps the choices of each search for ttl.
+func NewStoreProvider(l ports.Logger, ttl time.Duration) ports.StoreProvider {
 	store := &storeClient{
 		log:         l,
 		requestData: make(map[string]choiceItem),
+		ttl:         ttl,
 		done:        make(chan struct{}),
 	}
 
@@ -60,7 +62,7 @@ func (s *storeClient) Delete(key string) {
 }
 
 func (s *storeClient) cleanupRoutine() {
-	ticker := time.NewTicker(cleanupInterval)
+	ticker := time.NewTicker(min(cleanupInterval, s.ttl))
 	defer ticker.Stop()
 
 	for {
@@ -75,7 +77,7 @@ func (s *storeClient) cleanupRoutine() {
 
 func (s *storeClient) purgeExpiredKeys() {
 	s.log.Debug("running scheduled cleanup of expired keys")
-	cutoff := time.Now().Add(-storeTTL)
+	cutoff := time.Now().Add(-s.ttl)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
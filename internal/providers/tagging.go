@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/metrics"
+	"audio-scraper/internal/models"
+)
+
+// Names of the tags written next to the standard ones: TXXX frames in ID3,
+// plain comments in Vorbis and freeform atoms in MP4.
+const (
+	tagArtists        = "ARTISTS"
+	tagISRC           = "ISRC"
+	tagSpotifyTrackID = "SPOTIFY_TRACK_ID"
+	tagSpotifyAlbumID = "SPOTIFY_ALBUM_ID"
+)
+
+// tagValueSeparator joins multi-valued tags such as genres and artists.
+const tagValueSeparator = "; "
+
+// tagWriter replaces the metadata of an audio file in one container format.
+type tagWriter interface {
+	WriteTags(ctx context.Context, filePath string, job *models.DownloadJob, cover *coverArt) error
+}
+
+// tagWriters picks a tagWriter by file extension.
+var tagWriters = map[string]tagWriter{
+	".mp3":  id3Writer{},
+	".opus": vorbisWriter{},
+	".ogg":  vorbisWriter{},
+	".flac": vorbisWriter{},
+	".m4a":  mp4Writer{},
+}
+
+// trackIDs are the identifiers read back from a tagged file to recognise the
+// track it holds.
+type trackIDs struct {
+	trackID string
+	isrc    string
+}
+
+// tagReaders picks the function reading trackIDs by file extension. Readers
+// only parse as much of the file as they need to find the tags.
+var tagReaders = map[string]func(filePath string) (trackIDs, error){
+	".mp3":  readID3IDs,
+	".opus": readOggIDs,
+	".ogg":  readOggIDs,
+	".flac": readFLACIDs,
+	".m4a":  readMP4IDs,
+}
+
+type coverArt struct {
+	mime string
+	data []byte
+}
+
+func (f *fsClient) TagFile(ctx context.Context, filePath string, job *models.DownloadJob) error {
+	log := logger.From(ctx)
+	ext := strings.ToLower(filepath.Ext(filePath))
+	writer, ok := tagWriters[ext]
+	if !ok {
+		log.Error("no tag writer for file type", "ext", ext)
+		return errors.New("unsupported file type for tagging")
+	}
+
+	var cover *coverArt
+	if job.ThumbnailURL != "" {
+		var err error
+		cover, err = fetchCover(ctx, job.ThumbnailURL)
+		if err != nil {
+			metrics.CoverFetchFailures.Inc()
+			return err
+		}
+	}
+
+	return writer.WriteTags(ctx, filePath, job, cover)
+}
+
+func (f *fsClient) ReadTrackIDs(ctx context.Context, filePath string) (string, string, error) {
+	log := logger.From(ctx)
+	read, ok := tagReaders[strings.ToLower(filepath.Ext(filePath))]
+	if !ok {
+		log.Error("no tag reader for file type", "path", filePath)
+		return "", "", errors.New("unsupported file type for tagging")
+	}
+	ids, err := read(filePath)
+	if err != nil {
+		log.Error("failed to read file tags", "path", filePath, "err", err)
+		return "", "", errors.New("read tags failed")
+	}
+	return ids.trackID, ids.isrc, nil
+}
+
+func fetchCover(ctx context.Context, url string) (*coverArt, error) {
+	log := logger.From(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		log.Error("failed to create thumbnail request", "err", err)
+		return nil, errors.New("create thumbnail request failed")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Error("failed to fetch thumbnail", "err", err)
+		return nil, errors.New("fetch thumbnail failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Error("unexpected thumbnail response status", "status", resp.StatusCode)
+		return nil, errors.New("fetch thumbnail failed")
+	}
+
+	imgData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("failed to read thumbnail data", "err", err)
+		return nil, errors.New("read thumbnail data failed")
+	}
+
+	mime := "image/jpeg"
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		if strings.HasPrefix(ct, "image/") {
+			mime = strings.Split(ct, ";")[0]
+		}
+	}
+	return &coverArt{mime: mime, data: imgData}, nil
+}
+
+// numberWithTotal formats a track or disc position as "n/total", or just "n"
+// when the total is unknown.
+func numberWithTotal(n int, total int) string {
+	if total > 0 {
+		return strconv.Itoa(n) + "/" + strconv.Itoa(total)
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,44 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"audio-scraper/internal/models"
+)
+
+// taggedJob carries every field the tag writers store.
+func taggedJob() *models.DownloadJob {
+	return &models.DownloadJob{
+		TrackID:     "6LgJvl0Xdtc73RJ1mmpotq",
+		AlbumID:     "6dVIqQ8qmQ5GBnJ9shOYGE",
+		Track:       "Paranoid Android",
+		Album:       "OK Computer",
+		Artist:      "Radiohead",
+		Artists:     []string{"Radiohead", "Thom Yorke"},
+		AlbumArtist: "Radiohead",
+		ReleaseDate: "1997-05-21",
+		TrackNumber: 2,
+		TrackTotal:  12,
+		DiscNumber:  1,
+		DiscTotal:   2,
+		ISRC:        "GBAYE9700101",
+		Genres:      []string{"alternative rock", "art rock"},
+		Copyright:   "1997 XL Recordings",
+		Compilation: true,
+	}
+}
+
+// testCover is a few bytes posing as a JPEG; writers store it verbatim.
+var testCover = &coverArt{mime: "image/jpeg", data: []byte("\xff\xd8\xff\xe0cover art\xff\xd9")}
+
+// writeTestFile writes data to a file named name in a fresh directory.
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,194 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"audio-scraper/internal/models"
+)
+
+// maxComponentLength caps each rendered path component in bytes. It stays
+// well below the usual 255 byte limit so yt-dlp can append its own suffixes.
+const maxComponentLength = 200
+
+// templateFields lists the placeholders a path template may use.
+var templateFields = map[string]bool{
+	"title":        true,
+	"artist":       true,
+	"album":        true,
+	"album_artist": true,
+	"year":         true,
+	"release_date": true,
+	"track":        true,
+	"disc":         true,
+	"track_id":     true,
+	"ext":          true,
+}
+
+type templatePart struct {
+	literal string
+	field   string
+	width   int
+}
+
+// pathTemplate renders a library-relative file path from a download job,
+// e.g. "{album_artist}/{album} ({year})/{disc:02}-{track:02} {title}.{ext}".
+// A ":NN" suffix zero-pads numeric fields to NN digits.
+type pathTemplate struct {
+	raw        string
+	components [][]templatePart
+}
+
+func parsePathTemplate(raw string) (*pathTemplate, error) {
+	if raw == "" {
+		return nil, errors.New("empty path template")
+	}
+	if filepath.IsAbs(raw) {
+		return nil, errors.New("path template must be relative to MUSIC_HOME")
+	}
+
+	t := &pathTemplate{raw: raw}
+	for _, component := range strings.Split(raw, "/") {
+		if component == "" || component == "." || component == ".." {
+			return nil, fmt.Errorf("path template %q contains an empty or relative component", raw)
+		}
+		parts, err := parseTemplateComponent(component)
+		if err != nil {
+			return nil, fmt.Errorf("path template %q: %w", raw, err)
+		}
+		t.components = append(t.components, parts)
+	}
+	return t, nil
+}
+
+func parseTemplateComponent(component string) ([]templatePart, error) {
+	var parts []templatePart
+	for component != "" {
+		open := strings.IndexByte(component, '{')
+		if open < 0 {
+			parts = append(parts, templatePart{literal: component})
+			break
+		}
+		if open > 0 {
+			parts = append(parts, templatePart{literal: component[:open]})
+		}
+		end := strings.IndexByte(component[open:], '}')
+		if end < 0 {
+			return nil, errors.New("unclosed placeholder")
+		}
+
+		placeholder := component[open+1 : open+end]
+		field, widthSpec, hasWidth := strings.Cut(placeholder, ":")
+		if !templateFields[field] {
+			return nil, fmt.Errorf("unknown placeholder {%s}", field)
+		}
+		part := templatePart{field: field}
+		if hasWidth {
+			width, err := strconv.Atoi(widthSpec)
+			if err != nil || width <= 0 {
+				return nil, fmt.Errorf("invalid width in {%s}", placeholder)
+			}
+			part.width = width
+		}
+		parts = append(parts, part)
+		component = component[open+end+1:]
+	}
+	return parts, nil
+}
+
+// render returns the path relative to the library root, using forward
+// slashes converted to the OS separator.
+func (t *pathTemplate) render(job *models.DownloadJob, ext string) string {
+	components := make([]string, 0, len(t.components))
+	for i, parts := range t.components {
+		var b strings.Builder
+		for _, part := range parts {
+			if part.field == "" {
+				b.WriteString(part.literal)
+				continue
+			}
+			b.WriteString(sanitizeFilename(templateValue(job, ext, part)))
+		}
+
+		component := b.String()
+		if i < len(t.components)-1 {
+			components = append(components, sanitizePathComponent(truncateUTF8(component, maxComponentLength)))
+			continue
+		}
+		component = truncateFilename(component, maxComponentLength)
+		// A file name ending in {ext} keeps it when the rest is sanitized
+		// away, so an untitled track is "Unknown.opus" rather than "opus".
+		if last := parts[len(parts)-1]; last.field == "ext" && ext != "" && strings.HasSuffix(component, "."+ext) {
+			stem := strings.TrimSuffix(component, "."+ext)
+			components = append(components, sanitizePathComponent(stem)+"."+ext)
+			continue
+		}
+		components = append(components, sanitizePathComponent(component))
+	}
+	return filepath.Join(components...)
+}
+
+func templateValue(job *models.DownloadJob, ext string, part templatePart) string {
+	number := func(n int) string {
+		if part.width > 0 {
+			return fmt.Sprintf("%0*d", part.width, n)
+		}
+		return strconv.Itoa(n)
+	}
+
+	switch part.field {
+	case "title":
+		return job.Track
+	case "artist":
+		return job.Artist
+	case "album":
+		return job.Album
+	case "album_artist":
+		if job.AlbumArtist != "" {
+			return job.AlbumArtist
+		}
+		return job.Artist
+	case "year":
+		year, _, _ := strings.Cut(job.ReleaseDate, "-")
+		return year
+	case "release_date":
+		return job.ReleaseDate
+	case "track":
+		return number(job.TrackNumber)
+	case "disc":
+		return number(max(job.DiscNumber, 1))
+	case "track_id":
+		return job.TrackID
+	case "ext":
+		return ext
+	}
+	return ""
+}
+
+// truncateFilename caps name at limit bytes while keeping its extension.
+func truncateFilename(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) >= limit {
+		return truncateUTF8(name, limit)
+	}
+	stem := strings.TrimSuffix(name, ext)
+	return truncateUTF8(stem, limit-len(ext)) + ext
+}
+
+// truncateUTF8 cuts s to at most limit bytes without splitting a rune.
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
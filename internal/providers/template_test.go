@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+)
+
+func templateJob() *models.DownloadJob {
+	return &models.DownloadJob{
+		TrackID:     "4uLU6hMCjMI75M1A2tKUQC",
+		Track:       "Airbag",
+		Album:       "OK Computer",
+		Artist:      "Radiohead",
+		AlbumArtist: "Radiohead",
+		ReleaseDate: "1997-05-21",
+		TrackNumber: 1,
+		DiscNumber:  1,
+	}
+}
+
+func TestPathTemplateRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		job      func(*models.DownloadJob)
+		want     string
+	}{
+		{name: "default", template: constants.DefaultPathTemplate, want: "Radiohead/OK Computer/01-01 Airbag.opus"},
+		{name: "every placeholder", template: "{artist}/{album_artist}/{album} ({year})/{release_date} {disc}-{track} {title} [{track_id}].{ext}",
+			want: "Radiohead/Radiohead/OK Computer (1997)/1997-05-21 1-1 Airbag [4uLU6hMCjMI75M1A2tKUQC].opus"},
+		{name: "album artist falls back to artist", template: "{album_artist}/{title}.{ext}",
+			job: func(j *models.DownloadJob) { j.AlbumArtist = "" }, want: "Radiohead/Airbag.opus"},
+		{name: "year of a partial date", template: "{year}/{title}.{ext}",
+			job: func(j *models.DownloadJob) { j.ReleaseDate = "1997" }, want: "1997/Airbag.opus"},
+		{name: "width pads", template: "{disc:02}-{track:03} {title}.{ext}",
+			job: func(j *models.DownloadJob) { j.TrackNumber = 7 }, want: "01-007 Airbag.opus"},
+		{name: "width never cuts", template: "{track:01} {title}.{ext}",
+			job: func(j *models.DownloadJob) { j.TrackNumber = 12 }, want: "12 Airbag.opus"},
+		{name: "missing disc counts as the first", template: "{disc}-{track} {title}.{ext}",
+			job: func(j *models.DownloadJob) { j.DiscNumber = 0 }, want: "1-1 Airbag.opus"},
+		{name: "separators in values stay in one component", template: "{artist}/{title}.{ext}",
+			job: func(j *models.DownloadJob) { j.Artist = "AC/DC"; j.Track = `What? "No" <*>` }, want: "AC_DC/What_ _No_ ___.opus"},
+		{name: "empty values", template: "{artist}/{album}/{track:02} {title}.{ext}",
+			job: func(j *models.DownloadJob) { j.Artist, j.Album, j.Track = "", " ", "" }, want: "Unknown/Unknown/01.opus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parsePathTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			job := templateJob()
+			if tt.job != nil {
+				tt.job(job)
+			}
+			if got := tmpl.render(job, "opus"); got != filepath.FromSlash(tt.want) {
+				t.Errorf("render(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathTemplateTruncatesLongComponents(t *testing.T) {
+	tmpl, err := parsePathTemplate("{album}/{title}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := templateJob()
+	job.Album = strings.Repeat("é", 150)
+	job.Track = strings.Repeat("x", 300)
+
+	parts := strings.Split(filepath.ToSlash(tmpl.render(job, "flac")), "/")
+	if len(parts) != 2 {
+		t.Fatalf("render = %v, want two components", parts)
+	}
+	album, file := parts[0], parts[1]
+	if len(album) > maxComponentLength || !utf8.ValidString(album) {
+		t.Errorf("album component is %d bytes or splits a rune", len(album))
+	}
+	if len(file) != maxComponentLength || !strings.HasSuffix(file, ".flac") {
+		t.Errorf("file name %q is %d bytes, want %d keeping the extension", file, len(file), maxComponentLength)
+	}
+}
+
+func TestParsePathTemplateRejectsBadTemplates(t *testing.T) {
+	for _, tt := range []struct {
+		template string
+		want     string
+	}{
+		{"", "empty path template"},
+		{"/music/{title}.{ext}", "relative to MUSIC_HOME"},
+		{"{artist}/../{title}.{ext}", "relative component"},
+		{"{artist}//{title}.{ext}", "relative component"},
+		{"{artist}/./{title}.{ext}", "relative component"},
+		{"{genre}/{title}.{ext}", "unknown placeholder {genre}"},
+		{"{artist}/{title.{ext}", "unknown placeholder"},
+		{"{artist}/{title", "unclosed placeholder"},
+		{"{track:x} {title}.{ext}", "invalid width in {track:x}"},
+		{"{track:0} {title}.{ext}", "invalid width in {track:0}"},
+	} {
+		if _, err := parsePathTemplate(tt.template); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parsePathTemplate(%q) = %v, want an error containing %q", tt.template, err, tt.want)
+		}
+	}
+}
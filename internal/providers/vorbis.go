@@ -0,0 +1,308 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+)
+
+// vorbisWriter tags Opus, Ogg Vorbis and FLAC files with Vorbis comments by
+// remuxing them through ffmpeg, which rewrites the comment header without
+// re-encoding the audio.
+type vorbisWriter struct{}
+
+func (vorbisWriter) WriteTags(ctx context.Context, filePath string, job *models.DownloadJob, cover *coverArt) error {
+	log := logger.From(ctx)
+	ext := strings.ToLower(filepath.Ext(filePath))
+
+	comments := vorbisComments(job)
+	// Ogg containers carry cover art as a comment; FLAC has a picture block
+	// of its own, written by ffmpeg from an attached picture stream.
+	if cover != nil && ext != ".flac" {
+		comments = append(comments, [2]string{"METADATA_BLOCK_PICTURE", base64.StdEncoding.EncodeToString(flacPictureBlock(cover))})
+	}
+
+	metaFile, err := os.CreateTemp(filepath.Dir(filePath), ".tags-*.txt")
+	if err != nil {
+		log.Error("failed to create metadata file", "err", err)
+		return errors.New("write tags failed")
+	}
+	defer os.Remove(metaFile.Name())
+	_, err = metaFile.WriteString(ffmetadata(comments))
+	if closeErr := metaFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Error("failed to write metadata file", "err", err)
+		return errors.New("write tags failed")
+	}
+
+	args := []string{"-y", "-v", "error", "-i", filePath, "-i", metaFile.Name()}
+	if cover != nil && ext == ".flac" {
+		coverFile, err := os.CreateTemp(filepath.Dir(filePath), ".cover-*")
+		if err != nil {
+			log.Error("failed to create cover file", "err", err)
+			return errors.New("write tags failed")
+		}
+		defer os.Remove(coverFile.Name())
+		_, err = coverFile.Write(cover.data)
+		if closeErr := coverFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			log.Error("failed to write cover file", "err", err)
+			return errors.New("write tags failed")
+		}
+		args = append(args, "-i", coverFile.Name(), "-map", "2:v", "-disposition:v:0", "attached_pic")
+	}
+
+	// Keep the real extension last so ffmpeg picks the right muxer.
+	tmpPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".tagging" + filepath.Ext(filePath)
+	args = append(args, "-map", "0:a", "-map_metadata", "1", "-map_metadata:s:a:0", "1:g", "-c", "copy", tmpPath)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(tmpPath)
+		log.Error("ffmpeg tagging failed", "err", err, "output", string(output))
+		return errors.New("write tags failed")
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		log.Error("failed to replace tagged file", "err", err)
+		return errors.New("write tags failed")
+	}
+
+	return nil
+}
+
+func vorbisComments(job *models.DownloadJob) [][2]string {
+	var comments [][2]string
+	add := func(key string, value string) {
+		if value != "" {
+			comments = append(comments, [2]string{key, value})
+		}
+	}
+
+	add("TITLE", job.Track)
+	add("ARTIST", job.Artist)
+	add(tagArtists, strings.Join(job.Artists, tagValueSeparator))
+	add("ALBUMARTIST", job.AlbumArtist)
+	add("ALBUM", job.Album)
+	add("DATE", job.ReleaseDate)
+	if job.TrackNumber > 0 {
+		add("TRACKNUMBER", strconv.Itoa(job.TrackNumber))
+	}
+	if job.TrackTotal > 0 {
+		add("TRACKTOTAL", strconv.Itoa(job.TrackTotal))
+	}
+	if job.DiscNumber > 0 {
+		add("DISCNUMBER", strconv.Itoa(job.DiscNumber))
+	}
+	if job.DiscTotal > 0 {
+		add("DISCTOTAL", strconv.Itoa(job.DiscTotal))
+	}
+	add(tagISRC, job.ISRC)
+	add("GENRE", strings.Join(job.Genres, tagValueSeparator))
+	add("COPYRIGHT", job.Copyright)
+	if job.Compilation {
+		add("COMPILATION", "1")
+	}
+	add(tagSpotifyTrackID, job.TrackID)
+	add(tagSpotifyAlbumID, job.AlbumID)
+	return comments
+}
+
+var ffmetadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+// ffmetadata renders comments in ffmpeg's metadata file format.
+func ffmetadata(comments [][2]string) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, c := range comments {
+		b.WriteString(ffmetadataEscaper.Replace(c[0]))
+		b.WriteString("=")
+		b.WriteString(ffmetadataEscaper.Replace(c[1]))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// flacPictureBlock encodes cover as a FLAC METADATA_BLOCK_PICTURE, the form
+// Ogg files embed cover art in. Image dimensions are left as zero, which
+// readers treat as unknown.
+func flacPictureBlock(cover *coverArt) []byte {
+	const frontCover = 3
+	var b bytes.Buffer
+	write := func(v uint32) { binary.Write(&b, binary.BigEndian, v) }
+
+	write(frontCover)
+	write(uint32(len(cover.mime)))
+	b.WriteString(cover.mime)
+	write(uint32(len("Cover")))
+	b.WriteString("Cover")
+	write(0) // width
+	write(0) // height
+	write(0) // color depth
+	write(0) // indexed colors
+	write(uint32(len(cover.data)))
+	b.Write(cover.data)
+	return b.Bytes()
+}
+
+// maxCommentSize bounds how much of a file is read looking for its comment
+// header, which may hold an embedded cover.
+const maxCommentSize = 16 << 20
+
+func readFLACIDs(filePath string) (trackIDs, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return trackIDs{}, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return trackIDs{}, errors.New("not a flac file")
+	}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return trackIDs{}, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if blockType == 4 {
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return trackIDs{}, err
+			}
+			return vorbisCommentIDs(block)
+		}
+		if last {
+			return trackIDs{}, nil
+		}
+		if _, err := r.Discard(length); err != nil {
+			return trackIDs{}, err
+		}
+	}
+}
+
+// readOggIDs reads the comment header, the second packet of the first
+// logical stream, of an Opus or Ogg Vorbis file.
+func readOggIDs(filePath string) (trackIDs, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return trackIDs{}, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var serial uint32
+	var packet []byte
+	packets := 0
+	header := make([]byte, 27)
+	for first := true; ; first = false {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return trackIDs{}, err
+		}
+		if string(header[:4]) != "OggS" {
+			return trackIDs{}, errors.New("not an ogg file")
+		}
+		pageSerial := binary.LittleEndian.Uint32(header[14:])
+		if first {
+			serial = pageSerial
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return trackIDs{}, err
+		}
+		for _, size := range segments {
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return trackIDs{}, err
+			}
+			if pageSerial != serial {
+				continue
+			}
+			if packets == 1 {
+				packet = append(packet, data...)
+				if len(packet) > maxCommentSize {
+					return trackIDs{}, errors.New("ogg comment header too large")
+				}
+			}
+			if size < 255 {
+				packets++
+				if packets == 2 {
+					switch {
+					case bytes.HasPrefix(packet, []byte("OpusTags")):
+						return vorbisCommentIDs(packet[8:])
+					case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+						return vorbisCommentIDs(packet[7:])
+					default:
+						return trackIDs{}, errors.New("unknown ogg comment header")
+					}
+				}
+			}
+		}
+	}
+}
+
+// vorbisCommentIDs parses a Vorbis comment block: a vendor string followed by
+// KEY=value comments, all prefixed with little-endian lengths.
+func vorbisCommentIDs(block []byte) (trackIDs, error) {
+	next := func() ([]byte, error) {
+		if len(block) < 4 {
+			return nil, errors.New("truncated vorbis comment")
+		}
+		n := binary.LittleEndian.Uint32(block)
+		if uint64(n) > uint64(len(block)-4) {
+			return nil, errors.New("truncated vorbis comment")
+		}
+		value := block[4 : 4+n]
+		block = block[4+n:]
+		return value, nil
+	}
+
+	if _, err := next(); err != nil {
+		return trackIDs{}, err
+	}
+	if len(block) < 4 {
+		return trackIDs{}, errors.New("truncated vorbis comment")
+	}
+	count := binary.LittleEndian.Uint32(block)
+	block = block[4:]
+
+	var ids trackIDs
+	for i := uint32(0); i < count; i++ {
+		comment, err := next()
+		if err != nil {
+			return trackIDs{}, err
+		}
+		key, value, ok := strings.Cut(string(comment), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(key) {
+		case tagSpotifyTrackID:
+			ids.trackID = value
+		case tagISRC:
+			ids.isrc = value
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,190 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// vorbisCommentBlock encodes a Vorbis comment block with the given KEY=value
+// comments.
+func vorbisCommentBlock(comments ...string) []byte {
+	block := binary.LittleEndian.AppendUint32(nil, uint32(len("test vendor")))
+	block = append(block, "test vendor"...)
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(comments)))
+	for _, c := range comments {
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(c)))
+		block = append(block, c...)
+	}
+	return block
+}
+
+// flacFile builds a FLAC stream from metadata blocks given as type and body;
+// the last one is flagged as such.
+func flacFile(blocks ...flacBlock) []byte {
+	out := []byte("fLaC")
+	for i, b := range blocks {
+		header := b.typ
+		if i == len(blocks)-1 {
+			header |= 0x80
+		}
+		out = append(out, header, byte(len(b.body)>>16), byte(len(b.body)>>8), byte(len(b.body)))
+		out = append(out, b.body...)
+	}
+	return append(out, "audio frames"...)
+}
+
+type flacBlock struct {
+	typ  byte
+	body []byte
+}
+
+// oggStream packs packets into pages of at most maxSegments lacing values
+// each, so a large packet spans several pages. CRCs are left as zero, which
+// the reader does not check.
+func oggStream(serial uint32, maxSegments int, packets ...[]byte) []byte {
+	var segments [][]byte
+	for _, p := range packets {
+		for len(p) >= 255 {
+			segments = append(segments, p[:255])
+			p = p[255:]
+		}
+		segments = append(segments, p)
+	}
+
+	var out []byte
+	for page := 0; len(segments) > 0; page++ {
+		n := min(maxSegments, len(segments))
+		header := make([]byte, 27)
+		copy(header, "OggS")
+		binary.LittleEndian.PutUint32(header[14:], serial)
+		binary.LittleEndian.PutUint32(header[18:], uint32(page))
+		header[26] = byte(n)
+		out = append(out, header...)
+		for _, s := range segments[:n] {
+			out = append(out, byte(len(s)))
+		}
+		for _, s := range segments[:n] {
+			out = append(out, s...)
+		}
+		segments = segments[n:]
+	}
+	return out
+}
+
+// testOpusHead is the identification header of a stereo 48 kHz Opus stream.
+var testOpusHead = []byte("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+
+var libraryComments = []string{
+	"TITLE=Paranoid Android",
+	"spotify_track_id=6LgJvl0Xdtc73RJ1mmpotq",
+	"ISRC=GBAYE9700101",
+	"NOTE=a=b",
+}
+
+var wantLibraryIDs = trackIDs{trackID: "6LgJvl0Xdtc73RJ1mmpotq", isrc: "GBAYE9700101"}
+
+func TestVorbisCommentIDs(t *testing.T) {
+	ids, err := vorbisCommentIDs(vorbisCommentBlock(libraryComments...))
+	if err != nil {
+		t.Fatalf("vorbisCommentIDs: %v", err)
+	}
+	if ids != wantLibraryIDs {
+		t.Errorf("ids = %+v, want %+v", ids, wantLibraryIDs)
+	}
+
+	block := vorbisCommentBlock(libraryComments...)
+	for _, n := range []int{0, 3, 20, len(block) - 1} {
+		if _, err := vorbisCommentIDs(block[:n]); err == nil {
+			t.Errorf("block cut to %d bytes parsed", n)
+		}
+	}
+}
+
+func TestReadFLACIDs(t *testing.T) {
+	streamInfo := flacBlock{typ: 0, body: make([]byte, 34)}
+	picture := flacBlock{typ: 6, body: flacPictureBlock(testCover)}
+	comments := flacBlock{typ: 4, body: vorbisCommentBlock(libraryComments...)}
+
+	tests := []struct {
+		name string
+		data []byte
+		want trackIDs
+	}{
+		{name: "comments after picture", data: flacFile(streamInfo, picture, comments), want: wantLibraryIDs},
+		{name: "comments last", data: flacFile(streamInfo, comments), want: wantLibraryIDs},
+		{name: "no comments", data: flacFile(streamInfo, picture)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := readFLACIDs(writeTestFile(t, "track.flac", tt.data))
+			if err != nil {
+				t.Fatalf("readFLACIDs: %v", err)
+			}
+			if ids != tt.want {
+				t.Errorf("ids = %+v, want %+v", ids, tt.want)
+			}
+		})
+	}
+
+	if _, err := readFLACIDs(writeTestFile(t, "track.flac", []byte("ID3 not flac"))); err == nil {
+		t.Error("read IDs from a file that is not FLAC")
+	}
+}
+
+func TestReadOggIDs(t *testing.T) {
+	comments := vorbisCommentBlock(append(libraryComments, "METADATA_BLOCK_PICTURE="+string(bytes.Repeat([]byte("x"), 1000)))...)
+	vorbisIdent := append([]byte("\x01vorbis"), make([]byte, 23)...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "opus", data: oggStream(1, 255, testOpusHead, append([]byte("OpusTags"), comments...), []byte("audio"))},
+		{name: "vorbis", data: oggStream(1, 255, vorbisIdent, append([]byte("\x03vorbis"), comments...), []byte("\x05vorbis setup"))},
+		{name: "comments across pages", data: oggStream(1, 2, testOpusHead, append([]byte("OpusTags"), comments...))},
+		{
+			name: "interleaved stream",
+			data: bytes.Join([][]byte{
+				oggStream(7, 255, testOpusHead),
+				oggStream(9, 255, []byte("other stream header"), []byte("other stream comments")),
+				oggStream(7, 255, append([]byte("OpusTags"), comments...)),
+			}, nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := readOggIDs(writeTestFile(t, "track.opus", tt.data))
+			if err != nil {
+				t.Fatalf("readOggIDs: %v", err)
+			}
+			if ids != wantLibraryIDs {
+				t.Errorf("ids = %+v, want %+v", ids, wantLibraryIDs)
+			}
+		})
+	}
+
+	bad := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not ogg", data: []byte("fLaC and more bytes than an ogg page header")},
+		{name: "unknown codec", data: oggStream(1, 255, []byte("Speex"), []byte("Speex comments"))},
+		{name: "truncated", data: oggStream(1, 255, testOpusHead, append([]byte("OpusTags"), comments...))[:300]},
+	}
+	for _, tt := range bad {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readOggIDs(writeTestFile(t, "track.opus", tt.data)); err == nil {
+				t.Error("readOggIDs succeeded")
+			}
+		})
+	}
+}
+
+func TestFFMetadataEscapesValues(t *testing.T) {
+	got := ffmetadata([][2]string{{"TITLE", "a=b; #1 \\ x"}, {"COMMENT", "two\nlines"}})
+	want := ";FFMETADATA1\n" + `TITLE=a\=b\; \#1 \\ x` + "\n" + `COMMENT=two\` + "\nlines\n"
+	if got != want {
+		t.Errorf("ffmetadata = %q, want %q", got, want)
+	}
+}
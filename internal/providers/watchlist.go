@@ -0,0 +1,172 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+const watchlistFile = "watchlist.json"
+
+// watchlistClient keeps the watched artists in memory and rewrites
+// DATA_HOME/watchlist.json on every change. The file is replaced atomically,
+// so a crash mid-write leaves the previous watchlist intact.
+type watchlistClient struct {
+	log     ports.Logger
+	path    string
+	artists map[string]models.WatchedArtist
+	mu      sync.RWMutex
+}
+
+func NewWatchlistProvider(l ports.Logger, dataHome string) (ports.WatchlistProvider, error) {
+	if dataHome == "" {
+		return nil, errors.New("missing DATA_HOME")
+	}
+	if err := os.MkdirAll(dataHome, 0755); err != nil {
+		l.Error("failed to create data directory", "path", dataHome, "err", err)
+		return nil, errors.New("failed to create data directory")
+	}
+
+	w := &watchlistClient{
+		log:     l.With("component", "Watchlist"),
+		path:    filepath.Join(dataHome, watchlistFile),
+		artists: make(map[string]models.WatchedArtist),
+	}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// List returns the watched artists ordered by when they were added.
+func (w *watchlistClient) List() []models.WatchedArtist {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	artists := make([]models.WatchedArtist, 0, len(w.artists))
+	for _, artist := range w.artists {
+		artists = append(artists, artist)
+	}
+	sort.Slice(artists, func(i, j int) bool {
+		if !artists[i].CreatedAt.Equal(artists[j].CreatedAt) {
+			return artists[i].CreatedAt.Before(artists[j].CreatedAt)
+		}
+		return artists[i].ArtistID < artists[j].ArtistID
+	})
+	return artists
+}
+
+func (w *watchlistClient) Get(artistID string) (models.WatchedArtist, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	artist, exists := w.artists[artistID]
+	return artist, exists
+}
+
+// Put adds or replaces an artist. The change is kept only if it was saved.
+func (w *watchlistClient) Put(artist models.WatchedArtist) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	previous, existed := w.artists[artist.ArtistID]
+	w.artists[artist.ArtistID] = artist
+	if err := w.save(); err != nil {
+		if existed {
+			w.artists[artist.ArtistID] = previous
+		} else {
+			delete(w.artists, artist.ArtistID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (w *watchlistClient) Delete(artistID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	artist, exists := w.artists[artistID]
+	if !exists {
+		return ports.ErrArtistNotWatched
+	}
+	delete(w.artists, artistID)
+	if err := w.save(); err != nil {
+		w.artists[artistID] = artist
+		return err
+	}
+	return nil
+}
+
+func (w *watchlistClient) load() error {
+	data, err := os.ReadFile(w.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		w.log.Error("failed to read watchlist", "path", w.path, "err", err)
+		return errors.New("read watchlist failed")
+	}
+
+	var artists []models.WatchedArtist
+	if err := json.Unmarshal(data, &artists); err != nil {
+		w.log.Error("failed to decode watchlist", "path", w.path, "err", err)
+		return errors.New("decode watchlist failed")
+	}
+	for _, artist := range artists {
+		w.artists[artist.ArtistID] = artist
+	}
+	w.log.Info("loaded watchlist", "artists", len(w.artists))
+	return nil
+}
+
+// save writes the watchlist to a temporary file and renames it over the old
+// one. Callers hold the lock.
+func (w *watchlistClient) save() error {
+	artists := make([]models.WatchedArtist, 0, len(w.artists))
+	for _, artist := range w.artists {
+		artists = append(artists, artist)
+	}
+	sort.Slice(artists, func(i, j int) bool { return artists[i].ArtistID < artists[j].ArtistID })
+	data, err := json.MarshalIndent(artists, "", "  ")
+	if err != nil {
+		w.log.Error("failed to encode watchlist", "err", err)
+		return errors.New("encode watchlist failed")
+	}
+	if err := writeFileAtomic(w.path, data); err != nil {
+		w.log.Error("failed to write watchlist", "path", w.path, "err", err)
+		return errors.New("write watchlist failed")
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data through a synced temporary file in
+// the same directory.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+func TestWatchlistSurvivesReopening(t *testing.T) {
+	dataHome := t.TempDir()
+	watchlist, err := NewWatchlistProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	first := models.WatchedArtist{
+		ArtistID:      "first",
+		Name:          "First",
+		AlbumGroups:   []constants.AlbumGroup{constants.AlbumGroupAlbum},
+		Format:        constants.AudioFormatFLAC,
+		KnownReleases: []string{"a1", "a2"},
+		CreatedAt:     created,
+		CheckedAt:     created.Add(time.Hour),
+		LastError:     "fetch releases: timeout",
+	}
+	second := models.WatchedArtist{ArtistID: "second", Name: "Second", KnownReleases: []string{}, CreatedAt: created.Add(time.Minute)}
+	gone := models.WatchedArtist{ArtistID: "gone", Name: "Gone", KnownReleases: []string{}, CreatedAt: created}
+	for _, artist := range []models.WatchedArtist{second, first, gone} {
+		if err := watchlist.Put(artist); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := watchlist.Delete("gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewWatchlistProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artists := reopened.List()
+	if len(artists) != 2 || artists[0].ArtistID != "first" || artists[1].ArtistID != "second" {
+		t.Fatalf("List() = %+v, want first then second", artists)
+	}
+	got, found := reopened.Get("first")
+	if !found {
+		t.Fatal("first artist not found after reopening")
+	}
+	if got.Name != first.Name || got.Format != first.Format || got.LastError != first.LastError ||
+		len(got.AlbumGroups) != 1 || got.AlbumGroups[0] != constants.AlbumGroupAlbum ||
+		len(got.KnownReleases) != 2 || !got.CreatedAt.Equal(first.CreatedAt) || !got.CheckedAt.Equal(first.CheckedAt) {
+		t.Errorf("Get(first) = %+v, want %+v", got, first)
+	}
+	if _, found := reopened.Get("gone"); found {
+		t.Error("deleted artist came back after reopening")
+	}
+	if err := reopened.Delete("gone"); !errors.Is(err, ports.ErrArtistNotWatched) {
+		t.Errorf("Delete(gone) = %v, want ErrArtistNotWatched", err)
+	}
+}
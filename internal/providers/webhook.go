@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// Headers sent with every webhook delivery. The signature is the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the webhook secret, so receivers can
+// reject both forged and replayed deliveries.
+const (
+	webhookEventHeader     = "X-Audio-Scraper-Event"
+	webhookTimestampHeader = "X-Audio-Scraper-Timestamp"
+	webhookSignatureHeader = "X-Audio-Scraper-Signature"
+)
+
+type webhookClient struct {
+	secret     []byte
+	httpClient *http.Client
+}
+
+func NewWebhookProvider(secret string) ports.WebhookProvider {
+	return &webhookClient{
+		secret:     []byte(secret),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *webhookClient) Send(ctx context.Context, url string, payload models.WebhookPayload) error {
+	log := logger.From(ctx)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("failed to encode webhook payload", "err", err)
+		return errors.New("encode webhook payload failed")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Error("failed to create webhook request", "err", err)
+		return errors.New("create webhook request failed")
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, string(payload.Event))
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	if len(c.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(c.secret, timestamp, body))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Error("webhook request failed", "err", err)
+		return errors.New("webhook request failed")
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Error("unexpected webhook response status", "status", resp.StatusCode)
+		return fmt.Errorf("webhook target responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
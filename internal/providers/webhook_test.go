@@ -0,0 +1,69 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+)
+
+func TestWebhookSendSignsDeliveries(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	payload := models.WebhookPayload{
+		Event:   constants.WebhookEventRequestCompleted,
+		Time:    time.Now().UTC(),
+		Request: &models.RequestSummary{RequestID: "req", Total: 2, Done: 2},
+	}
+	if err := NewWebhookProvider("s3cret").Send(quietContext(), server.URL, payload); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := header.Get(webhookEventHeader); got != string(constants.WebhookEventRequestCompleted) {
+		t.Errorf("event header = %q", got)
+	}
+	timestamp := header.Get(webhookTimestampHeader)
+	if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Errorf("timestamp header = %q", timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get(webhookSignatureHeader) != want {
+		t.Errorf("signature = %q, want %q", header.Get(webhookSignatureHeader), want)
+	}
+
+	var received models.WebhookPayload
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if received.Event != payload.Event || *received.Request != *payload.Request {
+		t.Errorf("body = %+v, want %+v", received, payload)
+	}
+}
+
+func TestWebhookSendReportsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	payload := models.WebhookPayload{Event: constants.WebhookEventJobDone, Time: time.Now()}
+	if err := NewWebhookProvider("s3cret").Send(quietContext(), server.URL, payload); err == nil {
+		t.Fatal("Send succeeded on a 502 response")
+	}
+}
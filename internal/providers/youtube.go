@@ -1,54 +1,173 @@
 package providers
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"audio-scraper/internal/constants"
 	"audio-scraper/internal/logger"
+	"audio-scraper/internal/metrics"
+	"audio-scraper/internal/models"
 	"audio-scraper/internal/ports"
 )
 
-type youtubeClient struct{}
+type youtubeClient struct {
+	source    ports.YTCandidateSource
+	threshold float64
+}
 
-func NewYTProvider() ports.YTProvider {
-	return &youtubeClient{}
+// NewYTProvider matches jobs against candidates from source and rejects any
+// best match scoring below threshold.
+func NewYTProvider(source ports.YTCandidateSource, threshold float64) ports.YTProvider {
+	if threshold <= 0 {
+		threshold = constants.DefaultMatchThreshold
+	}
+	return &youtubeClient{source: source, threshold: threshold}
 }
 
-func (y *youtubeClient) Search(ctx context.Context, track string, album string, artist string) (string, error) {
+func (y *youtubeClient) Search(ctx context.Context, job *models.DownloadJob) (string, error) {
 	log := logger.From(ctx)
 
-	log.Info("performing yt search", "track", track, "album", album, "artist", artist)
-	cmd := exec.Command("python3", "scripts/yt-music.py", track, album, artist)
-
-	output, err := cmd.CombinedOutput()
+	query := strings.TrimSpace(job.Track + " " + job.Artist)
+	log.Info("performing yt search", "track", job.Track, "album", job.Album, "artist", job.Artist, "query", query)
+	start := time.Now()
+	candidates, err := y.source.Search(ctx, query)
+	metrics.YTSearchDuration.WithLabelValues(metrics.Result(err)).Observe(time.Since(start).Seconds())
 	if err != nil {
-		log.Error("yt search command failed", "err", err, "output", string(output))
+		log.Error("yt search failed", "err", err)
 		return "", errors.New("yt search failed")
 	}
+	if len(candidates) == 0 {
+		log.Warn("yt search returned no candidates")
+		return "", fmt.Errorf("%w: no search results", ports.ErrNoConfidentMatch)
+	}
 
-	log.Info("yt search output", "output", string(output))
-	return string(output), nil
+	var best *models.YTCandidate
+	bestScore := 0.0
+	for i := range candidates {
+		candidate := &candidates[i]
+		score := scoreCandidate(job, candidate)
+		log.Debug("scored yt candidate", "video_id", candidate.VideoID, "title", candidate.Title, "artists", candidate.Artists, "album", candidate.Album, "duration_ms", candidate.DurationMs, "score", score)
+		if score > bestScore {
+			best = candidate
+			bestScore = score
+		}
+	}
+	if best == nil || bestScore < y.threshold {
+		log.Warn("no yt candidate above match threshold", "best_score", bestScore, "threshold", y.threshold)
+		return "", fmt.Errorf("%w: best score %.2f below %.2f", ports.ErrNoConfidentMatch, bestScore, y.threshold)
+	}
+
+	log.Info("selected yt candidate", "video_id", best.VideoID, "title", best.Title, "score", bestScore)
+	return "https://music.youtube.com/watch?v=" + best.VideoID, nil
 }
 
-func (y *youtubeClient) Download(ctx context.Context, path string, videoURL string) error {
+func (y *youtubeClient) Download(ctx context.Context, path string, videoURL string, format constants.AudioFormat, progress func(percent float64)) (err error) {
 	log := logger.From(ctx)
-	log.Info("starting yt-dlp download", "path", path)
+	start := time.Now()
+	defer func() {
+		metrics.YTDLPDuration.WithLabelValues(metrics.Result(err)).Observe(time.Since(start).Seconds())
+	}()
+	log.Info("starting yt-dlp download", "path", path, "format", format.Extension())
+	// yt-dlp names the extracted file itself, so the extension in path is
+	// swapped for its template field.
+	output := strings.TrimSuffix(path, filepath.Ext(path)) + ".%(ext)s"
 	cmd := exec.CommandContext(
 		ctx,
 		"yt-dlp",
-		"-q",
+		"--newline",
+		"--progress",
+		"--no-warnings",
 		"-x",
 		"--audio-quality", "0",
-		"--audio-format", "mp3",
-		"-o", path,
+		"--audio-format", ytdlpAudioFormat(format),
+		"-o", output,
 		videoURL,
 	)
-	output, err := cmd.CombinedOutput()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		log.Error("yt-dlp command failed", "err", err, "output", string(output))
+		log.Error("failed to open yt-dlp output", "err", err)
+		return errors.New("yt-dlp download failed")
+	}
+	if err := cmd.Start(); err != nil {
+		log.Error("failed to start yt-dlp", "err", err)
+		return errors.New("yt-dlp download failed")
+	}
+
+	// Keep the tail of the output for the error log.
+	var tail []string
+	report := ytdlpProgressReporter(progress)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if report(line) {
+			continue
+		}
+		tail = append(tail, line)
+		if len(tail) > ytdlpOutputTail {
+			tail = tail[1:]
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		log.Error("yt-dlp command failed", "err", err, "output", strings.Join(tail, "\n"), "stderr", stderr.String())
 		return errors.New("yt-dlp download failed")
 	}
 
 	return nil
 }
+
+// ytdlpProgress matches the progress lines yt-dlp prints with --newline, such
+// as "[download]  42.7% of 3.21MiB at 1.02MiB/s ETA 00:02".
+var ytdlpProgress = regexp.MustCompile(`^\[download\]\s+([0-9.]+)%`)
+
+// ytdlpProgressReporter returns a function that passes the percentage of a
+// yt-dlp progress line on to progress and reports whether the line was one.
+// Only whole percentages are passed on so subscribers are not flooded. yt-dlp
+// downloads some videos in several parts, each counting up from zero again,
+// so a drop in the percentage starts over.
+func ytdlpProgressReporter(progress func(percent float64)) func(line string) bool {
+	reported := -1
+	return func(line string) bool {
+		m := ytdlpProgress.FindStringSubmatch(line)
+		if m == nil {
+			return false
+		}
+		percent, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return true
+		}
+		if int(percent) < reported {
+			reported = -1
+		}
+		if int(percent) > reported {
+			reported = int(percent)
+			progress(percent)
+		}
+		return true
+	}
+}
+
+// ytdlpOutputTail is how many non-progress lines of yt-dlp output are kept
+// for logging a failure.
+const ytdlpOutputTail = 20
+
+// ytdlpAudioFormat maps a format to yt-dlp's --audio-format name, which is
+// the codec rather than the container for Ogg Vorbis.
+func ytdlpAudioFormat(format constants.AudioFormat) string {
+	if format == constants.AudioFormatOGG {
+		return "vorbis"
+	}
+	return format.Extension()
+}
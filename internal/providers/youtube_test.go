@@ -0,0 +1,187 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// cannedSource answers every search with the same candidates.
+type cannedSource struct {
+	candidates []models.YTCandidate
+	err        error
+	queries    []string
+}
+
+func (s *cannedSource) Search(ctx context.Context, query string) ([]models.YTCandidate, error) {
+	s.queries = append(s.queries, query)
+	return s.candidates, s.err
+}
+
+func matchJob() *models.DownloadJob {
+	return &models.DownloadJob{
+		Track:      "Paranoid Android",
+		Artist:     "Radiohead",
+		Album:      "OK Computer",
+		DurationMs: 387000,
+	}
+}
+
+func TestYTSearchPicksBestCandidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []models.YTCandidate
+		want       string
+	}{
+		{
+			name: "duration outweighs a matching title",
+			candidates: []models.YTCandidate{
+				{VideoID: "live", Title: "Paranoid Android (Live)", Artists: []string{"Radiohead"}, Album: "OK Computer", DurationMs: 452000},
+				{VideoID: "studio", Title: "Paranoid Android", Artists: []string{"Radiohead"}, DurationMs: 388000},
+			},
+			want: "studio",
+		},
+		{
+			name: "artist separates covers",
+			candidates: []models.YTCandidate{
+				{VideoID: "cover", Title: "Paranoid Android", Artists: []string{"Christopher O'Riley"}, DurationMs: 387000},
+				{VideoID: "original", Title: "Paranoid Android", Artists: []string{"Radiohead"}, DurationMs: 387000},
+			},
+			want: "original",
+		},
+		{
+			name: "artist matched among several",
+			candidates: []models.YTCandidate{
+				{VideoID: "other", Title: "Paranoid Android", Artists: []string{"Sia"}, DurationMs: 386000},
+				{VideoID: "feat", Title: "Paranoid Android", Artists: []string{"Thom Yorke", "Radiohead"}, DurationMs: 386000},
+			},
+			want: "feat",
+		},
+		{
+			name: "decorations ignored",
+			candidates: []models.YTCandidate{
+				{VideoID: "remaster", Title: "Paranoid Android (Remastered)", Artists: []string{"Radiohead"}, Album: "OK Computer OKNOTOK 1997 2017", DurationMs: 387500},
+			},
+			want: "remaster",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &cannedSource{candidates: tt.candidates}
+			url, err := NewYTProvider(source, 0).Search(quietContext(), matchJob())
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if want := "https://music.youtube.com/watch?v=" + tt.want; url != want {
+				t.Fatalf("Search = %q, want %q", url, want)
+			}
+			if len(source.queries) != 1 || source.queries[0] != "Paranoid Android Radiohead" {
+				t.Fatalf("queries = %q", source.queries)
+			}
+		})
+	}
+}
+
+func TestYTSearchRejectsWeakMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []models.YTCandidate
+		threshold  float64
+	}{
+		{name: "no results"},
+		{
+			name:       "different song",
+			candidates: []models.YTCandidate{{VideoID: "a", Title: "Karma Police", Artists: []string{"Radiohead"}, Album: "OK Computer", DurationMs: 387000}},
+		},
+		{
+			name:       "duration far off",
+			candidates: []models.YTCandidate{{VideoID: "a", Title: "Paranoid Android", Artists: []string{"Radiohead"}, DurationMs: 420000}},
+		},
+		{
+			name:       "below a stricter threshold",
+			candidates: []models.YTCandidate{{VideoID: "a", Title: "Paranoid Android", Artists: []string{"Christopher O'Riley"}, DurationMs: 387000}},
+			threshold:  0.95,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewYTProvider(&cannedSource{candidates: tt.candidates}, tt.threshold).Search(quietContext(), matchJob())
+			if !errors.Is(err, ports.ErrNoConfidentMatch) {
+				t.Fatalf("Search error = %v, want %v", err, ports.ErrNoConfidentMatch)
+			}
+		})
+	}
+}
+
+func TestYTSearchSourceFailure(t *testing.T) {
+	_, err := NewYTProvider(&cannedSource{err: errors.New("boom")}, 0).Search(quietContext(), matchJob())
+	if err == nil || errors.Is(err, ports.ErrNoConfidentMatch) {
+		t.Fatalf("Search error = %v, want a search failure", err)
+	}
+}
+
+func TestDurationSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b int
+		want float64
+	}{
+		{200000, 200000, 1},
+		{200000, 203000, 1},
+		{200000, 211500, 0.5},
+		{200000, 180000, 0},
+		{200000, 150000, 0},
+	}
+	for _, tt := range tests {
+		if got := durationSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("durationSimilarity(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestScoreCandidateRescalesMissingSignals(t *testing.T) {
+	job := &models.DownloadJob{Track: "Paranoid Android", Artist: "Radiohead"}
+	candidate := &models.YTCandidate{Title: "Paranoid Android", Artists: []string{"Radiohead"}, DurationMs: 387000}
+	if score := scoreCandidate(job, candidate); score != 1 {
+		t.Fatalf("score = %v, want 1 when every shared signal matches", score)
+	}
+}
+
+func TestYTDLPProgressReporter(t *testing.T) {
+	var reported []float64
+	report := ytdlpProgressReporter(func(percent float64) {
+		reported = append(reported, percent)
+	})
+	lines := []struct {
+		line     string
+		progress bool
+	}{
+		{"[youtube] Extracting URL: https://music.youtube.com/watch?v=abc", false},
+		{"[download]   0.0% of 3.21MiB at Unknown B/s ETA Unknown", true},
+		{"[download]   0.4% of 3.21MiB at 1.02MiB/s ETA 00:03", true},
+		{"[download]  42.7% of 3.21MiB at 1.02MiB/s ETA 00:02", true},
+		{"[download]  42.9% of 3.21MiB at 1.02MiB/s ETA 00:02", true},
+		{"[download] 100.0% of 3.21MiB in 00:00:03", true},
+		// A second part starts over from zero.
+		{"[download] Destination: staging/abc.f251.webm", false},
+		{"[download]   3.0% of 1.10MiB at 1.02MiB/s ETA 00:01", true},
+		{"[download] 100% of 1.10MiB in 00:00:01", true},
+		{"[ExtractAudio] Destination: staging/abc.opus", false},
+	}
+	for _, l := range lines {
+		if got := report(l.line); got != l.progress {
+			t.Errorf("report(%q) = %v, want %v", l.line, got, l.progress)
+		}
+	}
+	want := []float64{0, 42.7, 100, 3, 100}
+	if len(reported) != len(want) {
+		t.Fatalf("reported %v, want %v", reported, want)
+	}
+	for i := range want {
+		if reported[i] != want[i] {
+			t.Fatalf("reported %v, want %v", reported, want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+const ytMusicSearchURL = "https://music.youtube.com/youtubei/v1/search?prettyPrint=false"
+
+// ytMusicSongsFilter restricts a search to the "Songs" tab, which only holds
+// official audio tracks with artist, album and duration metadata.
+const ytMusicSongsFilter = "EgWKAQIIAWoMEA4QChADEAQQCRAF"
+
+const ytMusicClientName = "WEB_REMIX"
+const ytMusicClientVersion = "1.20241023.01.00"
+
+var ytDurationPattern = regexp.MustCompile(`^\d+(:\d{2})+$`)
+
+// ytMusicSource queries the YouTube Music web client API directly, the same
+// endpoint ytmusicapi uses.
+type ytMusicSource struct {
+	httpClient *http.Client
+	searchURL  string
+}
+
+func NewYTMusicSource() ports.YTCandidateSource {
+	return &ytMusicSource{httpClient: &http.Client{Timeout: 15 * time.Second}, searchURL: ytMusicSearchURL}
+}
+
+type ytMusicSearchRequest struct {
+	Context struct {
+		Client struct {
+			ClientName    string `json:"clientName"`
+			ClientVersion string `json:"clientVersion"`
+			HL            string `json:"hl"`
+		} `json:"client"`
+	} `json:"context"`
+	Query  string `json:"query"`
+	Params string `json:"params"`
+}
+
+type ytMusicRun struct {
+	Text               string `json:"text"`
+	NavigationEndpoint struct {
+		WatchEndpoint struct {
+			VideoID string `json:"videoId"`
+		} `json:"watchEndpoint"`
+		BrowseEndpoint struct {
+			BrowseEndpointContextSupportedConfigs struct {
+				BrowseEndpointContextMusicConfig struct {
+					PageType string `json:"pageType"`
+				} `json:"browseEndpointContextMusicConfig"`
+			} `json:"browseEndpointContextSupportedConfigs"`
+		} `json:"browseEndpoint"`
+	} `json:"navigationEndpoint"`
+}
+
+type ytMusicListItem struct {
+	FlexColumns []struct {
+		Renderer struct {
+			Text struct {
+				Runs []ytMusicRun `json:"runs"`
+			} `json:"text"`
+		} `json:"musicResponsiveListItemFlexColumnRenderer"`
+	} `json:"flexColumns"`
+	PlaylistItemData struct {
+		VideoID string `json:"videoId"`
+	} `json:"playlistItemData"`
+}
+
+type ytMusicSearchResponse struct {
+	Contents struct {
+		TabbedSearchResultsRenderer struct {
+			Tabs []struct {
+				TabRenderer struct {
+					Content struct {
+						SectionListRenderer struct {
+							Contents []struct {
+								MusicShelfRenderer struct {
+									Contents []struct {
+										Item *ytMusicListItem `json:"musicResponsiveListItemRenderer"`
+									} `json:"contents"`
+								} `json:"musicShelfRenderer"`
+							} `json:"contents"`
+						} `json:"sectionListRenderer"`
+					} `json:"content"`
+				} `json:"tabRenderer"`
+			} `json:"tabs"`
+		} `json:"tabbedSearchResultsRenderer"`
+	} `json:"contents"`
+}
+
+func (s *ytMusicSource) Search(ctx context.Context, query string) ([]models.YTCandidate, error) {
+	log := logger.From(ctx)
+
+	var body ytMusicSearchRequest
+	body.Context.Client.ClientName = ytMusicClientName
+	body.Context.Client.ClientVersion = ytMusicClientVersion
+	body.Context.Client.HL = "en"
+	body.Query = query
+	body.Params = ytMusicSongsFilter
+	payload, err := json.Marshal(body)
+	if err != nil {
+		log.Error("failed to encode yt music search request", "err", err)
+		return nil, errors.New("encode yt music search failed")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.searchURL, bytes.NewReader(payload))
+	if err != nil {
+		log.Error("failed to create yt music search request", "err", err)
+		return nil, errors.New("create yt music search failed")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "https://music.youtube.com")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Error("yt music search request failed", "err", err)
+		return nil, errors.New("yt music search request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Error("unexpected yt music search response status", "status", resp.StatusCode)
+		return nil, errors.New("yt music search request failed")
+	}
+
+	var result ytMusicSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Error("failed to decode yt music search response", "err", err)
+		return nil, errors.New("decode yt music search failed")
+	}
+
+	var candidates []models.YTCandidate
+	for _, tab := range result.Contents.TabbedSearchResultsRenderer.Tabs {
+		for _, section := range tab.TabRenderer.Content.SectionListRenderer.Contents {
+			for _, entry := range section.MusicShelfRenderer.Contents {
+				if entry.Item == nil {
+					continue
+				}
+				if candidate, ok := parseYTMusicItem(entry.Item); ok {
+					candidates = append(candidates, candidate)
+				}
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// parseYTMusicItem reads a song row. The first column holds the title; the
+// second holds "artist(s) • album • duration" as separate runs.
+func parseYTMusicItem(item *ytMusicListItem) (models.YTCandidate, bool) {
+	if len(item.FlexColumns) < 2 {
+		return models.YTCandidate{}, false
+	}
+	titleRuns := item.FlexColumns[0].Renderer.Text.Runs
+	if len(titleRuns) == 0 {
+		return models.YTCandidate{}, false
+	}
+
+	candidate := models.YTCandidate{
+		VideoID: item.PlaylistItemData.VideoID,
+		Title:   titleRuns[0].Text,
+	}
+	if candidate.VideoID == "" {
+		candidate.VideoID = titleRuns[0].NavigationEndpoint.WatchEndpoint.VideoID
+	}
+	if candidate.VideoID == "" {
+		return models.YTCandidate{}, false
+	}
+
+	inArtists := true
+	for _, run := range item.FlexColumns[1].Renderer.Text.Runs {
+		text := strings.TrimSpace(run.Text)
+		pageType := run.NavigationEndpoint.BrowseEndpoint.BrowseEndpointContextSupportedConfigs.BrowseEndpointContextMusicConfig.PageType
+		switch {
+		case text == "•":
+			inArtists = false
+		case pageType == "MUSIC_PAGE_TYPE_ALBUM":
+			candidate.Album = text
+		case ytDurationPattern.MatchString(text):
+			candidate.DurationMs = parseYTDuration(text)
+		case inArtists && text != "" && text != "&" && text != ",":
+			candidate.Artists = append(candidate.Artists, text)
+		}
+	}
+	return candidate, true
+}
+
+// parseYTDuration converts "m:ss" or "h:mm:ss" to milliseconds.
+func parseYTDuration(text string) int {
+	seconds := 0
+	for _, part := range strings.Split(text, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds * 1000
+}
@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"audio-scraper/internal/models"
+)
+
+// ytMusicSongsResponse is a trimmed search response in the shape the web
+// client received it: a song row, a row without a video ID and a row whose
+// second column lists two artists. Update it when the layout changes.
+const ytMusicSongsResponse = `{
+  "contents": {"tabbedSearchResultsRenderer": {"tabs": [{"tabRenderer": {"content": {"sectionListRenderer": {"contents": [
+    {"musicShelfRenderer": {"contents": [
+      {"musicResponsiveListItemRenderer": {
+        "flexColumns": [
+          {"musicResponsiveListItemFlexColumnRenderer": {"text": {"runs": [
+            {"text": "Paranoid Android", "navigationEndpoint": {"watchEndpoint": {"videoId": "fHiGbolFFGw"}}}
+          ]}}},
+          {"musicResponsiveListItemFlexColumnRenderer": {"text": {"runs": [
+            {"text": "Radiohead", "navigationEndpoint": {"browseEndpoint": {"browseEndpointContextSupportedConfigs": {"browseEndpointContextMusicConfig": {"pageType": "MUSIC_PAGE_TYPE_ARTIST"}}}}},
+            {"text": " • "},
+            {"text": "OK Computer", "navigationEndpoint": {"browseEndpoint": {"browseEndpointContextSupportedConfigs": {"browseEndpointContextMusicConfig": {"pageType": "MUSIC_PAGE_TYPE_ALBUM"}}}}},
+            {"text": " • "},
+            {"text": "6:27"}
+          ]}}}
+        ],
+        "playlistItemData": {"videoId": "fHiGbolFFGw"}
+      }},
+      {"musicResponsiveListItemRenderer": {
+        "flexColumns": [
+          {"musicResponsiveListItemFlexColumnRenderer": {"text": {"runs": [{"text": "Unplayable"}]}}},
+          {"musicResponsiveListItemFlexColumnRenderer": {"text": {"runs": [{"text": "Nobody"}]}}}
+        ]
+      }},
+      {"musicResponsiveListItemRenderer": {
+        "flexColumns": [
+          {"musicResponsiveListItemFlexColumnRenderer": {"text": {"runs": [
+            {"text": "Daydreaming", "navigationEndpoint": {"watchEndpoint": {"videoId": "TTAU7lLDZYU"}}}
+          ]}}},
+          {"musicResponsiveListItemFlexColumnRenderer": {"text": {"runs": [
+            {"text": "Radiohead"},
+            {"text": " & "},
+            {"text": "Thom Yorke"},
+            {"text": " • "},
+            {"text": "1:06:40"}
+          ]}}}
+        ]
+      }}
+    ]}}
+  ]}}}}]}}
+}`
+
+func TestYTMusicSearchParsesSongRows(t *testing.T) {
+	var request ytMusicSearchRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Write([]byte(ytMusicSongsResponse))
+	}))
+	defer server.Close()
+
+	source := &ytMusicSource{httpClient: server.Client(), searchURL: server.URL}
+	candidates, err := source.Search(quietContext(), "paranoid android radiohead")
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if request.Query != "paranoid android radiohead" || request.Params != ytMusicSongsFilter || request.Context.Client.ClientName != ytMusicClientName {
+		t.Errorf("request = %+v", request)
+	}
+
+	want := []models.YTCandidate{
+		{VideoID: "fHiGbolFFGw", Title: "Paranoid Android", Artists: []string{"Radiohead"}, Album: "OK Computer", DurationMs: 387000},
+		{VideoID: "TTAU7lLDZYU", Title: "Daydreaming", Artists: []string{"Radiohead", "Thom Yorke"}, DurationMs: 4000000},
+	}
+	if !reflect.DeepEqual(candidates, want) {
+		t.Fatalf("candidates = %+v, want %+v", candidates, want)
+	}
+}
+
+func TestYTMusicSearchRejectedRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Request contains an invalid argument.", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	source := &ytMusicSource{httpClient: server.Client(), searchURL: server.URL}
+	if _, err := source.Search(quietContext(), "anything"); err == nil {
+		t.Fatal("Search succeeded on a rejected request")
+	}
+}
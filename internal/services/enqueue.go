@@ -0,0 +1,448 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// Enqueuer turns Spotify tracks, albums, artists and playlists into download
+// jobs and queues them. The API and the command line share it.
+type Enqueuer struct {
+	spotify ports.SpotifyProvider
+	fs      ports.FSProvider
+	queue   ports.DownloadQueue
+	library ports.LibraryProvider
+	claims  ports.ClaimProvider
+	jobs    ports.JobStoreProvider
+}
+
+type EnqueuerDeps struct {
+	Spotify ports.SpotifyProvider
+	FS      ports.FSProvider
+	Queue   ports.DownloadQueue
+	Library ports.LibraryProvider
+	Claims  ports.ClaimProvider
+	// Jobs is only needed by batches that skip unfinished tracks.
+	Jobs ports.JobStoreProvider
+}
+
+func NewEnqueuer(deps *EnqueuerDeps) *Enqueuer {
+	return &Enqueuer{spotify: deps.Spotify, fs: deps.FS, queue: deps.Queue, library: deps.Library, claims: deps.Claims, jobs: deps.Jobs}
+}
+
+// unfinishedJobStates are the states of jobs still to be downloaded.
+var unfinishedJobStates = []constants.JobState{
+	constants.JobStateQueued,
+	constants.JobStateSearching,
+	constants.JobStateDownloading,
+	constants.JobStateTagging,
+}
+
+// downloadsOwner claims the tracks of every request that is not a mirror
+// sync. Nothing releases its claims, so the files are never deleted.
+const downloadsOwner = "downloads"
+
+// EnqueueOptions apply to every job of a Batch.
+type EnqueueOptions struct {
+	RequestID string
+	// Format is the output format of every job.
+	Format constants.AudioFormat
+	// Force queues tracks even when the library already has them.
+	Force bool
+	// AlbumGroups limits which releases of an artist are queued.
+	AlbumGroups []constants.AlbumGroup
+	// Owner claims every track queued or skipped; it defaults to the owner
+	// shared by all downloads.
+	Owner string
+	// SkipUnfinished skips tracks that already have a job queued or running,
+	// so queueing an entity again after it was only partly queued does not
+	// download its tracks twice.
+	SkipUnfinished bool
+}
+
+// Batch queues the entities of one request. Album and artist details looked
+// up for one entity are reused for the rest.
+type Batch struct {
+	enqueuer *Enqueuer
+	opts     EnqueueOptions
+	meta     *metadataCache
+	// unfinished maps the tracks with an unfinished job to that job. It is
+	// listed on first use when the batch skips unfinished tracks.
+	unfinished map[string]string
+}
+
+func (e *Enqueuer) NewBatch(opts EnqueueOptions) *Batch {
+	return &Batch{enqueuer: e, opts: opts, meta: newMetadataCache()}
+}
+
+// Queue queues everything behind a Spotify entity, logging with the logger
+// in ctx.
+func (b *Batch) Queue(ctx context.Context, entityType constants.SpotifyEntityType, id spotify.ID) QueueResult {
+	return addEntityToQueue(ctx, b.deps(ctx), b.opts.RequestID, entityType, id, b.opts.AlbumGroups)
+}
+
+// Job builds the job for track, with album and artist tags filled in, without
+// queueing it.
+func (b *Batch) Job(ctx context.Context, track *spotify.FullTrack) models.DownloadJob {
+	deps := b.deps(ctx)
+	job := newDownloadJob(b.opts.RequestID, track, deps.format)
+	enrichDownloadJob(ctx, deps, &job, track)
+	return job
+}
+
+// Enqueue queues a job built with Job unless the library already has the
+// track, in which case the job's Path is set to the existing file.
+func (b *Batch) Enqueue(ctx context.Context, job *models.DownloadJob) QueueResult {
+	return enqueueJob(ctx, b.deps(ctx), job)
+}
+
+func (b *Batch) deps(ctx context.Context) addToQueueDeps {
+	owner := b.opts.Owner
+	if owner == "" {
+		owner = downloadsOwner
+	}
+	if b.opts.SkipUnfinished && b.unfinished == nil {
+		b.unfinished = make(map[string]string)
+		for _, state := range unfinishedJobStates {
+			for _, status := range b.enqueuer.jobs.ListByState(state) {
+				b.unfinished[status.Job.TrackID] = status.Job.ID
+			}
+		}
+	}
+	return addToQueueDeps{
+		log:        logger.From(ctx),
+		sp:         b.enqueuer.spotify,
+		fs:         b.enqueuer.fs,
+		q:          b.enqueuer.queue,
+		library:    b.enqueuer.library,
+		claims:     b.enqueuer.claims,
+		owner:      owner,
+		meta:       b.meta,
+		format:     b.opts.Format,
+		force:      b.opts.Force,
+		unfinished: b.unfinished,
+	}
+}
+
+type addToQueueDeps struct {
+	log     ports.Logger
+	sp      ports.SpotifyProvider
+	fs      ports.FSProvider
+	q       ports.DownloadQueue
+	library ports.LibraryProvider
+	claims  ports.ClaimProvider
+	// owner claims every track queued or skipped with these deps.
+	owner string
+	meta  *metadataCache
+	// format is the output format of every job queued with these deps.
+	format constants.AudioFormat
+	// force queues tracks even when the library already has them.
+	force bool
+	// unfinished maps tracks that are skipped because a job is already
+	// downloading them to that job.
+	unfinished map[string]string
+}
+
+// newDownloadJob builds a job carrying the metadata of a Spotify track.
+func newDownloadJob(requestID string, track *spotify.FullTrack, format constants.AudioFormat) models.DownloadJob {
+	artist := ""
+	if len(track.Artists) > 0 {
+		artist = track.Artists[0].Name
+	}
+	artists := make([]string, 0, len(track.Artists))
+	for _, a := range track.Artists {
+		artists = append(artists, a.Name)
+	}
+	albumArtist := artist
+	if len(track.Album.Artists) > 0 {
+		albumArtist = track.Album.Artists[0].Name
+	}
+
+	return models.DownloadJob{
+		ID:           uuid.New().String(),
+		RequestID:    requestID,
+		TrackID:      track.ID.String(),
+		AlbumID:      track.Album.ID.String(),
+		Track:        track.Name,
+		Album:        track.Album.Name,
+		Artist:       artist,
+		Artists:      artists,
+		AlbumArtist:  albumArtist,
+		ReleaseDate:  track.Album.ReleaseDate,
+		TrackNumber:  int(track.TrackNumber),
+		DiscNumber:   int(track.DiscNumber),
+		DurationMs:   int(track.Duration),
+		ISRC:         track.ExternalIDs["isrc"],
+		ThumbnailURL: imageURL(track.Album.Images),
+		Format:       format,
+	}
+}
+
+// QueueResult tallies what was done with the tracks behind the queued
+// entities. Failed counts tracks, or whole entities, that could not be looked
+// up or queued.
+type QueueResult struct {
+	JobIDs  []string
+	Skipped int
+	Failed  int
+}
+
+func (r *QueueResult) Merge(other QueueResult) {
+	r.JobIDs = append(r.JobIDs, other.JobIDs...)
+	r.Skipped += other.Skipped
+	r.Failed += other.Failed
+}
+
+// enqueueJob queues job unless the library already holds the track and the
+// request does not force a download. A skipped job has its Path set to the
+// existing file. Either way the track is claimed for the owner first, so a
+// mirror never deletes a file this request uses.
+func enqueueJob(ctx context.Context, deps addToQueueDeps, job *models.DownloadJob) QueueResult {
+	log := deps.log.With("track_id", job.TrackID, "job_id", job.ID)
+	if err := deps.claims.Claim(deps.owner, job.TrackID, job.ISRC); err != nil {
+		log.Error("failed to claim track", "owner", deps.owner, "err", err)
+		return QueueResult{Failed: 1}
+	}
+	if jobID, ok := deps.unfinished[job.TrackID]; ok {
+		log.Info("track already being downloaded, skipping", "unfinished_job_id", jobID)
+		return QueueResult{Skipped: 1}
+	}
+	if !deps.force {
+		if path, ok := deps.library.Lookup(job.TrackID, job.ISRC); ok {
+			log.Info("track already in library, skipping", "path", path)
+			job.Path = path
+			return QueueResult{Skipped: 1}
+		}
+	}
+
+	if err := deps.q.Enqueue(ctx, *job); err != nil {
+		log.Error("failed to add track to download queue", "err", err)
+		return QueueResult{Failed: 1}
+	}
+
+	log.Info("track added to download queue successfully")
+	return QueueResult{JobIDs: []string{job.ID}}
+}
+
+func addTrackToQueue(ctx context.Context, deps addToQueueDeps, requestID string, trackID spotify.ID) QueueResult {
+	log := deps.log.With("track_id", trackID)
+	log.Info("adding track to download queue")
+
+	track, err := deps.sp.GetTrack(logger.Into(ctx, log), spotify.ID(trackID))
+	if err != nil {
+		log.Error("failed to fetch track details", "err", err)
+		return QueueResult{Failed: 1}
+	}
+	job := newDownloadJob(requestID, track, deps.format)
+	enrichDownloadJob(ctx, deps, &job, track)
+	return enqueueJob(ctx, deps, &job)
+}
+
+func addAlbumToQueue(ctx context.Context, deps addToQueueDeps, requestID string, albumID spotify.ID) QueueResult {
+	log := deps.log.With("album_id", albumID)
+
+	tracks, err := deps.sp.GetAlbumTracks(logger.Into(ctx, log), albumID)
+	if err != nil {
+		log.Error("failed to fetch album tracks", "err", err)
+		return QueueResult{Failed: 1}
+	}
+
+	var result QueueResult
+	for _, track := range tracks {
+		result.Merge(addTrackToQueue(ctx, deps, requestID, track.ID))
+	}
+	log.Info("album added to download queue successfully", "skipped", result.Skipped)
+	return result
+}
+
+func addArtistToQueue(ctx context.Context, deps addToQueueDeps, requestID string, artistID spotify.ID, groups []constants.AlbumGroup) QueueResult {
+	log := deps.log.With("artist_id", artistID)
+
+	albumTypes, err := AlbumTypesFromGroups(groups)
+	if err != nil {
+		log.Error("invalid album groups", "groups", groups, "err", err)
+		return QueueResult{Failed: 1}
+	}
+	albums, err := deps.sp.GetArtistAlbums(logger.Into(ctx, log), artistID, albumTypes)
+	if err != nil {
+		log.Error("failed to fetch artist albums", "err", err)
+		return QueueResult{Failed: 1}
+	}
+
+	var result QueueResult
+	seen := make(map[spotify.ID]bool)
+	for _, album := range albums {
+		if seen[album.ID] {
+			continue
+		}
+		seen[album.ID] = true
+		result.Merge(addAlbumToQueue(ctx, deps, requestID, album.ID))
+	}
+	log.Info("artist added to download queue successfully", "skipped", result.Skipped)
+	return result
+}
+
+func addPlaylistToQueue(ctx context.Context, deps addToQueueDeps, requestID string, playlistID spotify.ID) QueueResult {
+	log := deps.log.With("playlist_id", playlistID)
+
+	playlist, err := deps.sp.GetPlaylist(logger.Into(ctx, log), playlistID, spotify.Fields("id,name"))
+	if err != nil {
+		log.Error("failed to fetch playlist details", "err", err)
+		return QueueResult{Failed: 1}
+	}
+	tracks, err := deps.sp.GetPlaylistTracks(logger.Into(ctx, log), playlistID)
+	if err != nil {
+		log.Error("failed to fetch playlist tracks", "err", err)
+		return QueueResult{Failed: 1}
+	}
+
+	// Playlist items already carry full track and album metadata, so the
+	// tracks are queued without fetching each one again.
+	var result QueueResult
+	jobs := make([]models.DownloadJob, 0, len(tracks))
+	for i := range tracks {
+		job := newDownloadJob(requestID, &tracks[i], deps.format)
+		enrichDownloadJob(ctx, deps, &job, &tracks[i])
+		result.Merge(enqueueJob(ctx, deps, &job))
+		jobs = append(jobs, job)
+	}
+
+	path, err := deps.fs.WritePlaylist(logger.Into(ctx, log), playlist.Name, jobs)
+	if err != nil {
+		log.Error("failed to write playlist file", "err", err)
+	} else {
+		log.Info("wrote playlist file", "path", path)
+	}
+	log.Info("playlist added to download queue successfully", "tracks", len(tracks), "skipped", result.Skipped)
+	return result
+}
+
+// addEntityToQueue queues everything behind a Spotify entity.
+func addEntityToQueue(ctx context.Context, deps addToQueueDeps, requestID string, entityType constants.SpotifyEntityType, id spotify.ID, groups []constants.AlbumGroup) QueueResult {
+	switch entityType {
+	case constants.SpotifyEntityTypeTrack:
+		return addTrackToQueue(ctx, deps, requestID, id)
+	case constants.SpotifyEntityTypeAlbum:
+		return addAlbumToQueue(ctx, deps, requestID, id)
+	case constants.SpotifyEntityTypeArtist:
+		return addArtistToQueue(ctx, deps, requestID, id, groups)
+	case constants.SpotifyEntityTypePlaylist:
+		return addPlaylistToQueue(ctx, deps, requestID, id)
+	}
+	deps.log.Warn("unsupported entity type", "type", entityType)
+	return QueueResult{Failed: 1}
+}
+
+// ParseSpotifyURL extracts the entity type and ID from an open.spotify.com
+// link (with or without scheme, locale prefix or query string) or a
+// spotify:<type>:<id> URI.
+func ParseSpotifyURL(raw string) (constants.SpotifyEntityType, spotify.ID, error) {
+	raw = strings.TrimSpace(raw)
+	var segments []string
+	if strings.HasPrefix(raw, "spotify:") {
+		segments = strings.Split(strings.TrimPrefix(raw, "spotify:"), ":")
+	} else {
+		if !strings.Contains(raw, "://") {
+			raw = "https://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid Spotify URL %q", raw)
+		}
+		if u.Hostname() != "open.spotify.com" && u.Hostname() != "play.spotify.com" {
+			return "", "", fmt.Errorf("not a Spotify URL: %q", raw)
+		}
+		segments = strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(segments) > 0 && strings.HasPrefix(segments[0], "intl-") {
+			segments = segments[1:]
+		}
+		if len(segments) > 0 && segments[0] == "embed" {
+			segments = segments[1:]
+		}
+	}
+	if len(segments) != 2 {
+		return "", "", fmt.Errorf("unrecognized Spotify link %q", raw)
+	}
+
+	entityType := constants.SpotifyEntityType(segments[0])
+	switch entityType {
+	case constants.SpotifyEntityTypeTrack, constants.SpotifyEntityTypeAlbum, constants.SpotifyEntityTypeArtist, constants.SpotifyEntityTypePlaylist:
+	default:
+		return "", "", fmt.Errorf("unsupported Spotify entity type %q", segments[0])
+	}
+	if !isSpotifyID(segments[1]) {
+		return "", "", fmt.Errorf("invalid Spotify ID %q", segments[1])
+	}
+	return entityType, spotify.ID(segments[1]), nil
+}
+
+// ParseArtistID accepts a bare Spotify artist ID, an artist URI or an artist
+// link.
+func ParseArtistID(raw string) (spotify.ID, error) {
+	return parseEntityID(raw, constants.SpotifyEntityTypeArtist)
+}
+
+// ParsePlaylistID accepts a bare Spotify playlist ID, a playlist URI or a
+// playlist link.
+func ParsePlaylistID(raw string) (spotify.ID, error) {
+	return parseEntityID(raw, constants.SpotifyEntityTypePlaylist)
+}
+
+func parseEntityID(raw string, want constants.SpotifyEntityType) (spotify.ID, error) {
+	raw = strings.TrimSpace(raw)
+	if isSpotifyID(raw) {
+		return spotify.ID(raw), nil
+	}
+	entityType, id, err := ParseSpotifyURL(raw)
+	if err != nil {
+		return "", err
+	}
+	if entityType != want {
+		return "", fmt.Errorf("not a Spotify %s: %q", want, raw)
+	}
+	return id, nil
+}
+
+// isSpotifyID reports whether id looks like a base62 Spotify ID.
+func isSpotifyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// AlbumTypesFromGroups maps the album groups of a request to Spotify album
+// types. No groups means every group.
+func AlbumTypesFromGroups(groups []constants.AlbumGroup) ([]spotify.AlbumType, error) {
+	var albumTypes []spotify.AlbumType
+	for _, group := range groups {
+		switch group {
+		case constants.AlbumGroupAlbum:
+			albumTypes = append(albumTypes, spotify.AlbumTypeAlbum)
+		case constants.AlbumGroupSingle:
+			albumTypes = append(albumTypes, spotify.AlbumTypeSingle)
+		case constants.AlbumGroupCompilation:
+			albumTypes = append(albumTypes, spotify.AlbumTypeCompilation)
+		case constants.AlbumGroupAppearsOn:
+			albumTypes = append(albumTypes, spotify.AlbumTypeAppearsOn)
+		default:
+			return nil, fmt.Errorf("unknown album group %q", group)
+		}
+	}
+	return albumTypes, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/constants"
+)
+
+func TestParseSpotifyURL(t *testing.T) {
+	const id = "4uLU6hMCjMI75M1A2tKUQC"
+	tests := []struct {
+		name     string
+		raw      string
+		wantType constants.SpotifyEntityType
+		wantErr  string
+	}{
+		{name: "track URI", raw: "spotify:track:" + id, wantType: constants.SpotifyEntityTypeTrack},
+		{name: "album URI", raw: "spotify:album:" + id, wantType: constants.SpotifyEntityTypeAlbum},
+		{name: "artist URI", raw: "spotify:artist:" + id, wantType: constants.SpotifyEntityTypeArtist},
+		{name: "playlist URI", raw: "spotify:playlist:" + id, wantType: constants.SpotifyEntityTypePlaylist},
+		{name: "link", raw: "https://open.spotify.com/track/" + id, wantType: constants.SpotifyEntityTypeTrack},
+		{name: "link without scheme", raw: "open.spotify.com/album/" + id, wantType: constants.SpotifyEntityTypeAlbum},
+		{name: "surrounding space", raw: "  https://open.spotify.com/track/" + id + "\n", wantType: constants.SpotifyEntityTypeTrack},
+		{name: "trailing slash", raw: "https://open.spotify.com/artist/" + id + "/", wantType: constants.SpotifyEntityTypeArtist},
+		{name: "query string", raw: "https://open.spotify.com/track/" + id + "?si=abc123&context=x", wantType: constants.SpotifyEntityTypeTrack},
+		{name: "fragment", raw: "https://open.spotify.com/playlist/" + id + "#top", wantType: constants.SpotifyEntityTypePlaylist},
+		{name: "intl link", raw: "https://open.spotify.com/intl-de/album/" + id, wantType: constants.SpotifyEntityTypeAlbum},
+		{name: "intl link with query", raw: "https://open.spotify.com/intl-pt/track/" + id + "?si=1", wantType: constants.SpotifyEntityTypeTrack},
+		{name: "embed link", raw: "https://open.spotify.com/embed/playlist/" + id, wantType: constants.SpotifyEntityTypePlaylist},
+		{name: "intl embed link", raw: "https://open.spotify.com/intl-fr/embed/track/" + id, wantType: constants.SpotifyEntityTypeTrack},
+		{name: "play host", raw: "https://play.spotify.com/album/" + id, wantType: constants.SpotifyEntityTypeAlbum},
+
+		{name: "other host", raw: "https://example.com/track/" + id, wantErr: "not a Spotify URL"},
+		{name: "lookalike host", raw: "https://open.spotify.com.evil.example/track/" + id, wantErr: "not a Spotify URL"},
+		{name: "unsupported link type", raw: "https://open.spotify.com/show/" + id, wantErr: "unsupported Spotify entity type \"show\""},
+		{name: "unsupported URI type", raw: "spotify:episode:" + id, wantErr: "unsupported Spotify entity type \"episode\""},
+		{name: "user URI", raw: "spotify:user:someone:playlist:" + id, wantErr: "unrecognized Spotify link"},
+		{name: "missing ID", raw: "https://open.spotify.com/track/", wantErr: "unrecognized Spotify link"},
+		{name: "extra segment", raw: "https://open.spotify.com/album/" + id + "/tracks", wantErr: "unrecognized Spotify link"},
+		{name: "ID with punctuation", raw: "spotify:track:4uLU6hMC-MI75M1A2tKUQC", wantErr: "invalid Spotify ID"},
+		{name: "empty ID", raw: "spotify:track:", wantErr: "invalid Spotify ID"},
+		{name: "bare ID", raw: id, wantErr: "not a Spotify URL"},
+		{name: "empty", raw: "", wantErr: "not a Spotify URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entityType, gotID, err := ParseSpotifyURL(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseSpotifyURL(%q) = %q, %q, %v, want an error containing %q", tt.raw, entityType, gotID, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSpotifyURL(%q): %v", tt.raw, err)
+			}
+			if entityType != tt.wantType || gotID != spotify.ID(id) {
+				t.Errorf("ParseSpotifyURL(%q) = %q, %q, want %q, %q", tt.raw, entityType, gotID, tt.wantType, id)
+			}
+		})
+	}
+}
+
+func TestParseEntityIDAcceptsBareIDsOfTheWantedType(t *testing.T) {
+	const id = "0OdUWJ0sBjDrqHygGUXeCF"
+	for _, raw := range []string{id, "spotify:artist:" + id, "https://open.spotify.com/artist/" + id + "?si=x"} {
+		if got, err := ParseArtistID(raw); err != nil || got != spotify.ID(id) {
+			t.Errorf("ParseArtistID(%q) = %q, %v, want %q", raw, got, err, id)
+		}
+	}
+	if _, err := ParseArtistID("spotify:album:" + id); err == nil {
+		t.Error("ParseArtistID accepted an album")
+	}
+	if _, err := ParsePlaylistID("https://open.spotify.com/playlist/" + id); err != nil {
+		t.Errorf("ParsePlaylistID: %v", err)
+	}
+}
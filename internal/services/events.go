@@ -0,0 +1,145 @@
+package services
+
+import (
+	"sync"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// subscriberBuffer is how many events a subscriber can lag behind before it
+// starts missing them.
+const subscriberBuffer = 64
+
+// EventBus is an in-process ports.EventBus.
+type EventBus struct {
+	log ports.Logger
+
+	mu          sync.RWMutex
+	subscribers map[int]chan models.JobEvent
+	states      map[int]*stateSubscriber
+	nextID      int
+}
+
+func NewEventBus(l ports.Logger) *EventBus {
+	return &EventBus{
+		log:         l.With("component", "EventBus"),
+		subscribers: make(map[int]chan models.JobEvent),
+		states:      make(map[int]*stateSubscriber),
+	}
+}
+
+func (b *EventBus) Publish(event models.JobEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.log.Debug("subscriber is behind, dropping event", "subscriber", id, "job_id", event.JobID, "type", event.Type)
+		}
+	}
+	if event.Type == constants.JobEventTypeState || event.Type == constants.JobEventTypeRequest {
+		for _, s := range b.states {
+			s.push(event)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on and
+// a func that unsubscribes and closes the channel.
+func (b *EventBus) Subscribe() (<-chan models.JobEvent, func()) {
+	ch := make(chan models.JobEvent, subscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = ch
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if ch, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// SubscribeStates returns a channel receiving every state and request event
+// published from now on. Events the subscriber has yet to take are queued however far
+// it falls behind, so none is missed. Unsubscribing stops new events; the
+// channel is closed once the queued ones are taken.
+func (b *EventBus) SubscribeStates() (<-chan models.JobEvent, func()) {
+	s := &stateSubscriber{
+		ready: make(chan struct{}, 1),
+		out:   make(chan models.JobEvent),
+	}
+	go s.run()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.states[id] = s
+
+	return s.out, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if s, ok := b.states[id]; ok {
+			delete(b.states, id)
+			s.close()
+		}
+	}
+}
+
+// stateSubscriber hands queued events to out in publishing order.
+type stateSubscriber struct {
+	mu     sync.Mutex
+	queue  []models.JobEvent
+	closed bool
+	ready  chan struct{}
+	out    chan models.JobEvent
+}
+
+func (s *stateSubscriber) push(event models.JobEvent) {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *stateSubscriber) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *stateSubscriber) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *stateSubscriber) run() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		queue, closed := s.queue, s.closed
+		s.queue = nil
+		s.mu.Unlock()
+
+		if len(queue) == 0 {
+			if closed {
+				return
+			}
+			<-s.ready
+			continue
+		}
+		for _, event := range queue {
+			s.out <- event
+		}
+	}
+}
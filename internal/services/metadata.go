@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+)
+
+// metadataCache holds album and artist details looked up while queueing one
+// request, so the tracks of an album or artist share a single fetch.
+type metadataCache struct {
+	albums  map[spotify.ID]*albumMetadata
+	artists map[spotify.ID][]string
+}
+
+type albumMetadata struct {
+	album      *spotify.FullAlbum
+	discTracks map[int]int
+	discTotal  int
+}
+
+func newMetadataCache() *metadataCache {
+	return &metadataCache{
+		albums:  make(map[spotify.ID]*albumMetadata),
+		artists: make(map[spotify.ID][]string),
+	}
+}
+
+// enrichDownloadJob adds the album- and artist-level tags that a track object
+// does not carry: disc and track totals, copyright, compilation flag and
+// genres. Lookup failures are logged and leave those tags empty.
+func enrichDownloadJob(ctx context.Context, deps addToQueueDeps, job *models.DownloadJob, track *spotify.FullTrack) {
+	log := deps.log.With("track_id", job.TrackID)
+
+	if album := deps.meta.album(ctx, deps, track.Album.ID); album != nil {
+		job.DiscTotal = album.discTotal
+		job.TrackTotal = album.discTracks[max(job.DiscNumber, 1)]
+		job.Compilation = album.album.AlbumType == "compilation"
+		job.Copyright = copyrightNotice(album.album.Copyrights)
+		job.Genres = album.album.Genres
+	} else {
+		log.Warn("album details unavailable, tagging without album totals", "album_id", track.Album.ID)
+	}
+
+	if len(job.Genres) == 0 && len(track.Artists) > 0 {
+		job.Genres = deps.meta.genres(ctx, deps, track.Artists[0].ID)
+	}
+}
+
+func (c *metadataCache) album(ctx context.Context, deps addToQueueDeps, id spotify.ID) *albumMetadata {
+	if id == "" {
+		return nil
+	}
+	if meta, ok := c.albums[id]; ok {
+		return meta
+	}
+
+	log := deps.log.With("album_id", id)
+	album, err := deps.sp.GetAlbum(logger.Into(ctx, log), id)
+	if err != nil {
+		log.Error("failed to fetch album details", "err", err)
+		c.albums[id] = nil
+		return nil
+	}
+	tracks := album.Tracks.Tracks
+	if album.Tracks.Next != "" {
+		tracks, err = deps.sp.GetAlbumTracks(logger.Into(ctx, log), id)
+		if err != nil {
+			log.Error("failed to fetch album tracks", "err", err)
+			c.albums[id] = nil
+			return nil
+		}
+	}
+
+	meta := &albumMetadata{album: album, discTracks: make(map[int]int)}
+	for _, t := range tracks {
+		disc := max(int(t.DiscNumber), 1)
+		meta.discTracks[disc]++
+		meta.discTotal = max(meta.discTotal, disc)
+	}
+	c.albums[id] = meta
+	return meta
+}
+
+func (c *metadataCache) genres(ctx context.Context, deps addToQueueDeps, id spotify.ID) []string {
+	if genres, ok := c.artists[id]; ok {
+		return genres
+	}
+
+	log := deps.log.With("artist_id", id)
+	artist, err := deps.sp.GetArtist(logger.Into(ctx, log), id)
+	if err != nil {
+		log.Error("failed to fetch artist details", "err", err)
+		c.artists[id] = nil
+		return nil
+	}
+	c.artists[id] = artist.Genres
+	return artist.Genres
+}
+
+// copyrightNotice prefers the copyright (C) notice over the sound recording
+// (P) one.
+func copyrightNotice(copyrights []spotify.Copyright) string {
+	notice := ""
+	for _, c := range copyrights {
+		if c.Type == "C" {
+			return c.Text
+		}
+		if notice == "" {
+			notice = c.Text
+		}
+	}
+	return notice
+}
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// activeJobStates are the states of jobs that hold, or will hold, a library
+// file.
+var activeJobStates = []constants.JobState{
+	constants.JobStateQueued,
+	constants.JobStateSearching,
+	constants.JobStateDownloading,
+	constants.JobStateTagging,
+	constants.JobStateDone,
+}
+
+// PlaylistMirror keeps mirrored playlists in sync with Spotify. Every
+// interval it re-reads each playlist whose snapshot changed, queues the
+// tracks added since the last sync under one request, and rewrites the
+// playlist file. Tracks removed from the playlist stay in the file unless
+// the mirror prunes them.
+type PlaylistMirror struct {
+	interval time.Duration
+	format   constants.AudioFormat
+
+	log      ports.Logger
+	spotify  ports.SpotifyProvider
+	fs       ports.FSProvider
+	jobStore ports.JobStoreProvider
+	library  ports.LibraryProvider
+	mirrors  ports.MirrorProvider
+	claims   ports.ClaimProvider
+	enqueuer *Enqueuer
+	requests *RequestTracker
+
+	// mu guards read-modify-write cycles on mirrors; syncing keeps syncs
+	// from running concurrently and queueing a track twice.
+	mu      sync.Mutex
+	syncing sync.Mutex
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type MirrorDeps struct {
+	Log      ports.Logger
+	Spotify  ports.SpotifyProvider
+	FS       ports.FSProvider
+	Jobs     ports.JobStoreProvider
+	Library  ports.LibraryProvider
+	Mirrors  ports.MirrorProvider
+	Claims   ports.ClaimProvider
+	Enqueuer *Enqueuer
+	// Requests runs every sync as a download request.
+	Requests *RequestTracker
+	// Format is the output format of mirrors that do not pick one.
+	Format constants.AudioFormat
+}
+
+// NewPlaylistMirror starts syncing the mirrors every interval. With a zero
+// interval playlists are only synced on demand.
+func NewPlaylistMirror(interval time.Duration, deps *MirrorDeps) *PlaylistMirror {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &PlaylistMirror{
+		interval: interval,
+		format:   deps.Format,
+		log:      deps.Log.With("component", "PlaylistMirror"),
+		spotify:  deps.Spotify,
+		fs:       deps.FS,
+		jobStore: deps.Jobs,
+		library:  deps.Library,
+		mirrors:  deps.Mirrors,
+		claims:   deps.Claims,
+		enqueuer: deps.Enqueuer,
+		requests: deps.Requests,
+		ctx:      ctx,
+		cancel:   cancel,
+		stop:     make(chan struct{}),
+	}
+
+	if interval > 0 {
+		m.wg.Add(1)
+		go m.run()
+	}
+	return m
+}
+
+func (m *PlaylistMirror) run() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.syncAll()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Mirror starts mirroring a playlist and starts its first sync in the
+// background, which queues every track the library does not have yet.
+func (m *PlaylistMirror) Mirror(ctx context.Context, playlistID spotify.ID, format constants.AudioFormat, prune bool, deleteRemoved bool) (models.MirrorResponse, error) {
+	log := logger.From(ctx).With("playlist_id", playlistID)
+	ctx = logger.Into(ctx, log)
+	if _, exists := m.mirrors.Get(playlistID.String()); exists {
+		return models.MirrorResponse{}, ports.ErrPlaylistAlreadyMirrored
+	}
+
+	playlist, err := m.spotify.GetPlaylist(ctx, playlistID, spotify.Fields("id,name"))
+	if err != nil {
+		log.Error("failed to fetch playlist details", "err", err)
+		return models.MirrorResponse{}, errors.New("failed to fetch playlist")
+	}
+	mirror := models.MirroredPlaylist{
+		PlaylistID:    playlistID.String(),
+		Name:          playlist.Name,
+		Format:        format,
+		PruneRemoved:  prune,
+		DeleteRemoved: deleteRemoved,
+		Tracks:        []models.MirrorTrack{},
+		CreatedAt:     time.Now(),
+	}
+
+	m.mu.Lock()
+	if _, exists := m.mirrors.Get(mirror.PlaylistID); exists {
+		m.mu.Unlock()
+		return models.MirrorResponse{}, ports.ErrPlaylistAlreadyMirrored
+	}
+	err = m.mirrors.Put(mirror)
+	m.mu.Unlock()
+	if err != nil {
+		return models.MirrorResponse{}, err
+	}
+	log.Info("playlist mirrored", "name", mirror.Name)
+
+	// A failed first sync leaves the mirror in place; the next one tries
+	// again.
+	return models.MirrorResponse{Mirror: mirror, Sync: m.startSync(ctx, playlistID)}, nil
+}
+
+// Update changes the settings of a mirror. They apply from the next sync.
+func (m *PlaylistMirror) Update(playlistID string, req models.MirrorUpdateRequest) (models.MirroredPlaylist, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mirror, exists := m.mirrors.Get(playlistID)
+	if !exists {
+		return models.MirroredPlaylist{}, ports.ErrPlaylistNotMirrored
+	}
+	if req.Format != nil {
+		mirror.Format = *req.Format
+	}
+	if req.PruneRemoved != nil {
+		mirror.PruneRemoved = *req.PruneRemoved
+	}
+	if req.DeleteRemoved != nil {
+		mirror.DeleteRemoved = *req.DeleteRemoved
+	}
+	if err := m.mirrors.Put(mirror); err != nil {
+		return models.MirroredPlaylist{}, err
+	}
+	return mirror, nil
+}
+
+// Unmirror stops mirroring a playlist. Its playlist file and tracks are
+// kept, and its claims on the tracks are released.
+func (m *PlaylistMirror) Unmirror(playlistID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mirror, exists := m.mirrors.Get(playlistID)
+	if !exists {
+		return ports.ErrPlaylistNotMirrored
+	}
+	if err := m.mirrors.Delete(playlistID); err != nil {
+		return err
+	}
+	for _, track := range mirror.Tracks {
+		if err := m.claims.Release(mirrorOwner(playlistID), track.Job.TrackID); err != nil {
+			m.log.Warn("failed to release track claim", "playlist_id", playlistID, "track_id", track.Job.TrackID, "err", err)
+		}
+	}
+	return nil
+}
+
+// Sync starts a sync of a mirror in the background under a new request and
+// returns its progress.
+func (m *PlaylistMirror) Sync(ctx context.Context, playlistID spotify.ID) (models.RequestProgress, error) {
+	if _, exists := m.mirrors.Get(playlistID.String()); !exists {
+		return models.RequestProgress{}, ports.ErrPlaylistNotMirrored
+	}
+	return m.startSync(ctx, playlistID), nil
+}
+
+func (m *PlaylistMirror) startSync(ctx context.Context, playlistID spotify.ID) models.RequestProgress {
+	requestID := uuid.New().String()
+	return m.requests.Go(ctx, requestID, func(ctx context.Context, record func(QueueResult)) {
+		m.sync(ctx, playlistID, requestID, record)
+	})
+}
+
+// sync brings a mirror up to date with its Spotify playlist, reporting the
+// jobs it queues under requestID through record. The tracks are only
+// fetched again when the playlist's snapshot changed or the last sync
+// failed; the playlist file is rewritten either way.
+func (m *PlaylistMirror) sync(ctx context.Context, playlistID spotify.ID, requestID string, record func(QueueResult)) error {
+	m.syncing.Lock()
+	defer m.syncing.Unlock()
+
+	log := logger.From(ctx).With("playlist_id", playlistID, "request_id", requestID)
+	ctx = logger.Into(ctx, log)
+	result := models.MirrorSyncResult{RequestID: requestID}
+	mirror, exists := m.mirrors.Get(playlistID.String())
+	if !exists {
+		return ports.ErrPlaylistNotMirrored
+	}
+
+	playlist, err := m.spotify.GetPlaylist(ctx, playlistID, spotify.Fields("id,name,snapshot_id"))
+	if err != nil {
+		log.Error("failed to fetch playlist details", "err", err)
+		m.recordSync(mirror, result, fmt.Sprintf("fetch playlist: %v", err))
+		return errors.New("failed to fetch playlist")
+	}
+
+	if playlist.SnapshotID != mirror.SnapshotID || mirror.LastError != "" {
+		tracks, err := m.spotify.GetPlaylistTracks(ctx, playlistID)
+		if err != nil {
+			log.Error("failed to fetch playlist tracks", "err", err)
+			m.recordSync(mirror, result, fmt.Sprintf("fetch tracks: %v", err))
+			return errors.New("failed to fetch playlist tracks")
+		}
+		format := mirror.Format
+		if format == "" {
+			format = m.format
+		}
+		batch := m.enqueuer.NewBatch(EnqueueOptions{RequestID: requestID, Format: format, Owner: mirrorOwner(mirror.PlaylistID)})
+		mirror.Tracks = m.merge(ctx, batch, mirror.Tracks, tracks, record, &result)
+		mirror.SnapshotID = playlist.SnapshotID
+	}
+
+	if mirror.PruneRemoved {
+		kept := make([]models.MirrorTrack, 0, len(mirror.Tracks))
+		for _, track := range mirror.Tracks {
+			if !track.Removed {
+				kept = append(kept, track)
+				continue
+			}
+			if mirror.DeleteRemoved && m.deleteTrack(ctx, mirror, track) {
+				result.Deleted++
+			}
+			if err := m.claims.Release(mirrorOwner(mirror.PlaylistID), track.Job.TrackID); err != nil {
+				log.Warn("failed to release track claim", "track_id", track.Job.TrackID, "err", err)
+			}
+		}
+		mirror.Tracks = kept
+	}
+
+	jobs := make([]models.DownloadJob, 0, len(mirror.Tracks))
+	for i := range mirror.Tracks {
+		job := &mirror.Tracks[i].Job
+		if path, ok := m.library.Lookup(job.TrackID, job.ISRC); ok {
+			job.Path = path
+		}
+		jobs = append(jobs, *job)
+	}
+	path, err := m.fs.WritePlaylist(ctx, mirror.Name, jobs)
+	if err != nil {
+		log.Error("failed to write playlist file", "err", err)
+		m.recordSync(mirror, result, "write playlist file: "+err.Error())
+		return errors.New("failed to write playlist file")
+	}
+	mirror.Path = path
+
+	// A sync with tracks that failed to queue is recorded as failed, so the
+	// next one fetches the tracks again.
+	lastError := ""
+	if result.Failed > 0 {
+		lastError = fmt.Sprintf("failed to queue %d tracks", result.Failed)
+	}
+	m.recordSync(mirror, result, lastError)
+	log.Info("synced playlist", "added", result.Added, "removed", result.Removed, "deleted", result.Deleted,
+		"skipped", result.Skipped, "failed", result.Failed)
+	return nil
+}
+
+// merge lines the entries of the last sync up with the current tracks of
+// the playlist, queueing the new ones and reporting them through record.
+// Tracks that could not be queued are
+// left out so the next sync tries them again. Entries whose track is gone
+// are kept at the end, marked as removed.
+func (m *PlaylistMirror) merge(ctx context.Context, batch *Batch, entries []models.MirrorTrack, tracks []spotify.FullTrack, record func(QueueResult), result *models.MirrorSyncResult) []models.MirrorTrack {
+	log := logger.From(ctx)
+	previous := make(map[string]models.MirrorTrack, len(entries))
+	for _, entry := range entries {
+		if _, seen := previous[entry.Job.TrackID]; !seen {
+			previous[entry.Job.TrackID] = entry
+		}
+	}
+
+	merged := make([]models.MirrorTrack, 0, len(tracks))
+	current := make(map[string]models.MirrorTrack, len(tracks))
+	for i := range tracks {
+		id := tracks[i].ID.String()
+		if entry, ok := current[id]; ok {
+			merged = append(merged, entry)
+			continue
+		}
+		if entry, ok := previous[id]; ok {
+			entry.Removed = false
+			current[id] = entry
+			merged = append(merged, entry)
+			continue
+		}
+
+		job := batch.Job(ctx, &tracks[i])
+		queued := batch.Enqueue(ctx, &job)
+		record(queued)
+		result.Skipped += queued.Skipped
+		if queued.Failed > 0 {
+			result.Failed += queued.Failed
+			continue
+		}
+		entry := models.MirrorTrack{Job: job, Owned: len(queued.JobIDs) > 0}
+		result.Added++
+		current[id] = entry
+		merged = append(merged, entry)
+	}
+
+	for _, entry := range entries {
+		id := entry.Job.TrackID
+		if _, ok := current[id]; ok {
+			continue
+		}
+		if !entry.Removed {
+			log.Info("track removed from playlist", "track_id", id)
+			result.Removed++
+		}
+		entry.Removed = true
+		current[id] = entry
+		merged = append(merged, entry)
+	}
+	return merged
+}
+
+// deleteTrack deletes the file of a track pruned from a mirror, provided the
+// mirror downloaded it and nothing else uses it: no other owner claims it, no
+// other playlist file lists it and no other request has a job for it.
+func (m *PlaylistMirror) deleteTrack(ctx context.Context, mirror models.MirroredPlaylist, track models.MirrorTrack) bool {
+	log := logger.From(ctx).With("track_id", track.Job.TrackID)
+	if !track.Owned {
+		return false
+	}
+	claimed, err := m.claims.Claimed(track.Job.TrackID, track.Job.ISRC, mirrorOwner(mirror.PlaylistID))
+	if err != nil {
+		log.Warn("failed to check track claims", "err", err)
+		return false
+	}
+	if claimed {
+		log.Info("keeping track claimed by another owner")
+		return false
+	}
+	if status, found := m.jobStore.Get(track.Job.ID); found && !status.State.Terminal() {
+		log.Info("keeping track whose download has not finished", "job_id", track.Job.ID, "state", status.State)
+		return false
+	}
+	for _, state := range activeJobStates {
+		for _, status := range m.jobStore.ListByState(state) {
+			if status.Job.TrackID == track.Job.TrackID && status.Job.ID != track.Job.ID {
+				log.Info("keeping track another request downloads", "request_id", status.Job.RequestID)
+				return false
+			}
+		}
+	}
+	path, ok := m.library.Lookup(track.Job.TrackID, track.Job.ISRC)
+	if !ok {
+		return false
+	}
+	deleted, err := m.fs.RemoveTrack(ctx, path, mirror.Path)
+	if err != nil {
+		log.Warn("failed to delete removed track", "path", path, "err", err)
+		return false
+	}
+	return deleted
+}
+
+// mirrorOwner is the owner of the claims a mirror holds on its tracks.
+func mirrorOwner(playlistID string) string {
+	return "mirror:" + playlistID
+}
+
+// syncAll syncs every mirror in turn. Failures are logged and the remaining
+// mirrors are still synced.
+func (m *PlaylistMirror) syncAll() {
+	ctx := logger.Into(m.ctx, m.log)
+	for _, mirror := range m.mirrors.List() {
+		select {
+		case <-m.stop:
+			return
+		default:
+		}
+		requestID := uuid.New().String()
+		m.requests.Run(ctx, requestID, func(ctx context.Context, record func(QueueResult)) {
+			err := m.sync(ctx, spotify.ID(mirror.PlaylistID), requestID, record)
+			if err != nil && !errors.Is(err, ports.ErrPlaylistNotMirrored) {
+				m.log.Warn("playlist sync failed", "playlist_id", mirror.PlaylistID, "err", err)
+			}
+		})
+	}
+}
+
+// recordSync saves the outcome of a sync. Settings changed while it ran are
+// kept, and mirrors removed meanwhile stay removed.
+func (m *PlaylistMirror) recordSync(synced models.MirroredPlaylist, result models.MirrorSyncResult, lastError string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mirror, exists := m.mirrors.Get(synced.PlaylistID)
+	if !exists {
+		return
+	}
+	mirror.Tracks = synced.Tracks
+	mirror.SnapshotID = synced.SnapshotID
+	mirror.Path = synced.Path
+	mirror.SyncedAt = time.Now()
+	mirror.LastError = lastError
+	mirror.LastSync = &result
+	if err := m.mirrors.Put(mirror); err != nil {
+		m.log.Error("failed to save playlist sync", "playlist_id", synced.PlaylistID, "err", err)
+	}
+}
+
+// Shutdown stops the scheduler and waits for a sync in progress, which is
+// abandoned once ctx is done.
+func (m *PlaylistMirror) Shutdown(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stop) })
+	stopped := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		m.cancel()
+		return nil
+	case <-ctx.Done():
+		m.cancel()
+		<-stopped
+		return ctx.Err()
+	}
+}
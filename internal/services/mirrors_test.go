@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/providers"
+)
+
+type mirrorFixture struct {
+	mirror    *PlaylistMirror
+	spotify   *fakeSpotify
+	queue     *recordingQueue
+	requests  *RequestTracker
+	library   ports.LibraryProvider
+	musicHome string
+}
+
+// newMirrorFixture builds a mirror over real providers in temporary
+// directories, a fake Spotify client and a queue that only records jobs.
+// Syncs are not scheduled.
+func newMirrorFixture(t *testing.T) *mirrorFixture {
+	t.Helper()
+	musicHome, dataHome := t.TempDir(), t.TempDir()
+	fs, err := providers.NewFSProvider(musicHome, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := providers.NewJobStoreProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jobs.Close() })
+	mirrors, err := providers.NewMirrorProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := providers.NewClaimProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &mirrorFixture{
+		spotify:   newFakeSpotify(),
+		queue:     &recordingQueue{},
+		requests:  NewRequestTracker(NewEventBus(quietLogger())),
+		library:   providers.NewLibraryProvider(musicHome),
+		musicHome: musicHome,
+	}
+	f.mirror = NewPlaylistMirror(0, &MirrorDeps{
+		Log:      quietLogger(),
+		Spotify:  f.spotify,
+		FS:       fs,
+		Jobs:     jobs,
+		Library:  f.library,
+		Mirrors:  mirrors,
+		Claims:   claims,
+		Enqueuer: NewEnqueuer(&EnqueuerDeps{Spotify: f.spotify, FS: fs, Queue: f.queue, Library: f.library, Claims: claims}),
+		Requests: f.requests,
+	})
+	t.Cleanup(func() {
+		f.requests.Shutdown(context.Background())
+		f.mirror.Shutdown(context.Background())
+	})
+	return f
+}
+
+// addLibraryFile puts a file for track into the library.
+func (f *mirrorFixture) addLibraryFile(t *testing.T, track *models.DownloadJob) string {
+	t.Helper()
+	path := filepath.Join(f.musicHome, "Artist", track.TrackID+".opus")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.library.Add(path, track)
+	return path
+}
+
+// waitQueued waits for a request to finish queueing and returns its progress.
+func waitQueued(t *testing.T, requests *RequestTracker, requestID string) models.RequestProgress {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		progress, found := requests.Get(requestID)
+		if found && progress.State == constants.RequestStateQueued {
+			return progress
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("request %s not queued: %+v", requestID, progress)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMirrorSyncsInTheBackground(t *testing.T) {
+	f := newMirrorFixture(t)
+	f.spotify.addAlbum("album", "album", "t1", "t2")
+	f.spotify.playlists["playlist"] = spotify.FullPlaylist{SimplePlaylist: spotify.SimplePlaylist{ID: "playlist", Name: "Mix", SnapshotID: "first"}}
+	f.spotify.playlistTracks["playlist"] = []spotify.FullTrack{f.spotify.tracks["t1"], f.spotify.tracks["t2"]}
+	f.spotify.gate = make(chan struct{})
+
+	response, err := f.mirror.Mirror(quietContext(), "playlist", constants.AudioFormatOpus, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Sync.State != constants.RequestStateQueueing || response.Sync.RequestID == "" {
+		t.Fatalf("first sync = %+v, want queueing in the background", response.Sync)
+	}
+	if _, err := f.mirror.Mirror(quietContext(), "playlist", "", false, false); !errors.Is(err, ports.ErrPlaylistAlreadyMirrored) {
+		t.Fatalf("mirroring twice: %v", err)
+	}
+
+	close(f.spotify.gate)
+	progress := waitQueued(t, f.requests, response.Sync.RequestID)
+	if len(progress.Jobs) != 2 {
+		t.Fatalf("first sync queued %v, want 2 jobs", progress.Jobs)
+	}
+	if got := fmt.Sprint(f.queue.trackIDs()); got != "[t1 t2]" {
+		t.Errorf("queued tracks %s", got)
+	}
+	mirror, _ := f.mirror.mirrors.Get("playlist")
+	if mirror.LastSync == nil || mirror.LastSync.RequestID != response.Sync.RequestID || mirror.LastSync.Added != 2 {
+		t.Errorf("last sync = %+v", mirror.LastSync)
+	}
+
+	if _, err := f.mirror.Sync(quietContext(), "unknown"); !errors.Is(err, ports.ErrPlaylistNotMirrored) {
+		t.Fatalf("syncing an unknown playlist: %v", err)
+	}
+	f.spotify.playlists["playlist"] = spotify.FullPlaylist{SimplePlaylist: spotify.SimplePlaylist{ID: "playlist", Name: "Mix", SnapshotID: "next"}}
+	f.spotify.playlistTracks["playlist"] = []spotify.FullTrack{f.spotify.tracks["t2"]}
+	synced, err := f.mirror.Sync(quietContext(), "playlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress := waitQueued(t, f.requests, synced.RequestID); len(progress.Jobs) != 0 {
+		t.Errorf("second sync queued %v", progress.Jobs)
+	}
+	mirror, _ = f.mirror.mirrors.Get("playlist")
+	if mirror.LastSync.Removed != 1 || mirror.SnapshotID != "next" {
+		t.Errorf("after second sync: last sync %+v, snapshot %q", mirror.LastSync, mirror.SnapshotID)
+	}
+}
+
+func TestDeleteTrackRemovesFilesOnlyTheMirrorClaims(t *testing.T) {
+	f := newMirrorFixture(t)
+	track := models.DownloadJob{ID: "mirror-job", TrackID: "track", ISRC: "ISRC1"}
+	path := f.addLibraryFile(t, &track)
+	mirror := models.MirroredPlaylist{PlaylistID: "playlist"}
+	if err := f.mirror.claims.Claim(mirrorOwner(mirror.PlaylistID), track.TrackID, track.ISRC); err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.mirror.deleteTrack(quietContext(), mirror, models.MirrorTrack{Job: track, Owned: true}) {
+		t.Fatal("track only the mirror claims was kept")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file still exists: %v", err)
+	}
+}
+
+func TestDeleteTrackKeepsFilesAnAlbumSkipped(t *testing.T) {
+	f := newMirrorFixture(t)
+	track := models.DownloadJob{ID: "mirror-job", TrackID: "track", ISRC: "ISRC1"}
+	path := f.addLibraryFile(t, &track)
+	mirror := models.MirroredPlaylist{PlaylistID: "playlist"}
+	if err := f.mirror.claims.Claim(mirrorOwner(mirror.PlaylistID), track.TrackID, track.ISRC); err != nil {
+		t.Fatal(err)
+	}
+
+	// An album download finds the recording in the library under another
+	// track ID, so it creates no job, only a claim.
+	album := f.mirror.enqueuer.NewBatch(EnqueueOptions{RequestID: "album"})
+	albumJob := models.DownloadJob{ID: "album-job", RequestID: "album", TrackID: "album-track", ISRC: "isrc1"}
+	if result := album.Enqueue(quietContext(), &albumJob); result.Skipped != 1 {
+		t.Fatalf("album track not skipped: %+v", result)
+	}
+
+	if f.mirror.deleteTrack(quietContext(), mirror, models.MirrorTrack{Job: track, Owned: true}) {
+		t.Fatal("track the album claims was deleted")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file removed: %v", err)
+	}
+}
@@ -3,44 +3,77 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"time"
 
+	"audio-scraper/internal/constants"
 	"audio-scraper/internal/logger"
+	"audio-scraper/internal/metrics"
 	"audio-scraper/internal/models"
 	"audio-scraper/internal/ports"
 )
 
+// errStopping is returned by a stage that was abandoned because the pool is
+// shutting down. Such jobs are left in place and resumed on the next start.
+var errStopping = errors.New("worker pool stopping")
+
+// DownloadWorkerPool is a ports.DownloadQueue backed by the job store. Enqueued
+// jobs are persisted before they are acknowledged and workers claim them from
+// the store, so anything still queued or in flight is resumed after a restart.
+// Each stage is retried according to its RetryPolicy; jobs that run out of
+// attempts end up failed, which is the dead-letter list.
 type DownloadWorkerPool struct {
-	jobs    chan models.DownloadJob
 	workers int
+	retry   RetryPolicies
+	wake    chan struct{}
+
+	log      ports.Logger
+	yt       ports.YTProvider
+	fs       ports.FSProvider
+	jobStore ports.JobStoreProvider
+	library  ports.LibraryProvider
+	events   ports.EventBus
 
-	log ports.Logger
-	yt  ports.YTProvider
-	fs  ports.FSProvider
+	// running holds the cancel func of every job a worker is processing.
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
 
-	wg   sync.WaitGroup
-	stop chan struct{}
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 type Deps struct {
-	Log ports.Logger
-	YT  ports.YTProvider
-	FS  ports.FSProvider
+	Log     ports.Logger
+	YT      ports.YTProvider
+	FS      ports.FSProvider
+	Jobs    ports.JobStoreProvider
+	Library ports.LibraryProvider
+	Events  ports.EventBus
 }
 
 func NewDownloadWorkerPool(
 	workers int,
+	retry RetryPolicies,
 	deps *Deps,
 ) *DownloadWorkerPool {
 	p := &DownloadWorkerPool{
-		jobs:    make(chan models.DownloadJob, 1000),
-		workers: workers,
-		log:     deps.Log.With("component", "DownloadWorkerPool"),
-		yt:      deps.YT,
-		fs:      deps.FS,
-		stop:    make(chan struct{}),
+		workers:  workers,
+		retry:    retry,
+		wake:     make(chan struct{}, workers),
+		log:      deps.Log.With("component", "DownloadWorkerPool"),
+		yt:       deps.YT,
+		fs:       deps.FS,
+		jobStore: deps.Jobs,
+		library:  deps.Library,
+		events:   deps.Events,
+		running:  make(map[string]context.CancelCauseFunc),
+		stop:     make(chan struct{}),
 	}
 
+	p.updateQueueDepth()
 	p.start()
 	return p
 }
@@ -59,59 +92,414 @@ func (p *DownloadWorkerPool) worker(id int) {
 
 	for {
 		select {
-		case job, ok := <-p.jobs:
-			if !ok {
-				log.Info("jobs channel closed, worker exiting")
+		case <-p.stop:
+			log.Info("received stop signal, worker exiting")
+			return
+		default:
+		}
+
+		status, ok := p.jobStore.Claim(constants.JobStateSearching)
+		if !ok {
+			select {
+			case <-p.wake:
+				continue
+			case <-p.stop:
+				log.Info("received stop signal, worker exiting")
 				return
 			}
+		}
+		p.updateQueueDepth()
+		p.publishState(status)
 
-			log := log.With("request_id", job.RequestID, "track_id", job.TrackID)
+		p.run(ctx, log, status.Job)
+	}
+}
 
-			log.Info("processing download job")
+// run processes job under a context that Cancel, or Shutdown once its grace
+// period is over, can cancel. That also kills any yt-dlp or ffmpeg process
+// started for the job.
+func (p *DownloadWorkerPool) run(ctx context.Context, log ports.Logger, job models.DownloadJob) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
-			videoURL, err := p.yt.Search(logger.Into(ctx, log), job.Track, job.Album, job.Artist)
-			if err != nil {
-				log.Error("yt search failed", "err", err)
-				continue
-			}
-			log = log.With("video_url", videoURL)
+	metrics.ActiveWorkers.Inc()
+	defer metrics.ActiveWorkers.Dec()
 
-			path, err := p.fs.InitializePath(logger.Into(ctx, log), &job)
-			if err != nil {
-				log.Error("failed to initialize filesystem path", "err", err)
-				continue
-			}
+	p.mu.Lock()
+	p.running[job.ID] = cancel
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, job.ID)
+		p.mu.Unlock()
+	}()
 
-			err = p.yt.Download(logger.Into(ctx, log), path, videoURL)
-			if err != nil {
-				log.Error("yt download failed", "err", err)
-				continue
-			}
+	// Cancel may have run between Claim and registering the cancel func.
+	if status, _ := p.jobStore.Get(job.ID); status.State == constants.JobStateCancelled {
+		log.Info("job cancelled before processing", "job_id", job.ID)
+		return
+	}
+	p.process(ctx, log, job)
+}
 
-			err = p.fs.TagFile(logger.Into(ctx, log), path, &job)
-			if err != nil {
-				log.Error("failed to tag file", "err", err)
-				continue
-			}
-			log.Info("download job completed successfully")
+func (p *DownloadWorkerPool) process(ctx context.Context, log ports.Logger, job models.DownloadJob) {
+	log = log.With("request_id", job.RequestID, "job_id", job.ID, "track_id", job.TrackID)
+
+	log.Info("processing download job")
+
+	var videoURL string
+	err := p.attempt(ctx, log, constants.JobStateSearching, func() error {
+		var err error
+		videoURL, err = p.yt.Search(logger.Into(ctx, log), &job)
+		if err != nil {
+			log.Error("yt search failed", "err", err)
+		}
+		return err
+	})
+	if err != nil {
+		p.fail(ctx, log, job.ID, constants.JobStateSearching, err)
+		return
+	}
+	log = log.With("video_url", videoURL)
+
+	p.setState(log, job.ID, constants.JobStateDownloading, "")
+	var path string
+	err = p.attempt(ctx, log, constants.JobStateDownloading, func() error {
+		var err error
+		path, err = p.fs.StagePath(logger.Into(ctx, log), &job)
+		if err != nil {
+			log.Error("failed to initialize staging path", "err", err)
+			return err
+		}
+
+		err = p.yt.Download(logger.Into(ctx, log), path, videoURL, job.Format, func(percent float64) {
+			p.events.Publish(models.JobEvent{
+				Type:      constants.JobEventTypeProgress,
+				JobID:     job.ID,
+				RequestID: job.RequestID,
+				State:     constants.JobStateDownloading,
+				Progress:  percent,
+				Time:      time.Now(),
+			})
+		})
+		if err != nil {
+			log.Error("yt download failed", "err", err)
+		}
+		return err
+	})
+	if err != nil {
+		p.fs.Discard(logger.Into(ctx, log), path)
+		p.fail(ctx, log, job.ID, constants.JobStateDownloading, err)
+		return
+	}
+
+	p.setState(log, job.ID, constants.JobStateTagging, "")
+	err = p.attempt(ctx, log, constants.JobStateTagging, func() error {
+		err := p.fs.TagFile(logger.Into(ctx, log), path, &job)
+		if err != nil {
+			log.Error("failed to tag file", "err", err)
+			return err
+		}
+
+		libraryPath, err := p.fs.Finalize(logger.Into(ctx, log), path, &job)
+		if err != nil {
+			log.Error("failed to finalize file", "err", err)
+			return err
+		}
+		p.library.Add(libraryPath, &job)
+		return nil
+	})
+	if err != nil {
+		p.fs.Discard(logger.Into(ctx, log), path)
+		p.fail(ctx, log, job.ID, constants.JobStateTagging, err)
+		return
+	}
+	if ctx.Err() != nil && !errors.Is(context.Cause(ctx), errStopping) {
+		log.Info("job cancelled after its file was written, leaving it in the library")
+		p.cancelled(log, job.ID, constants.JobStateTagging)
+		return
+	}
+	p.setState(log, job.ID, constants.JobStateDone, "")
+	metrics.JobOutcomes.WithLabelValues(string(constants.JobStateDone), "", "").Inc()
+	log.Info("download job completed successfully")
+}
+
+// attempt runs fn until it succeeds or the stage's retry policy is exhausted,
+// backing off between attempts.
+func (p *DownloadWorkerPool) attempt(ctx context.Context, log ports.Logger, stage constants.JobState, fn func() error) error {
+	policy := p.retry.For(stage)
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ports.ErrNoConfidentMatch) {
+			// Searching again yields the same results; retrying cannot help.
+			return err
+		}
+		if attempt >= policy.Attempts {
+			return fmt.Errorf("%w (after %d attempts)", err, attempt)
+		}
+
+		delay := policy.delay(attempt)
+		log.Warn("job stage failed, retrying", "stage", stage, "attempt", attempt, "retry_in", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-p.stop:
-			log.Info("received stop signal, worker exiting")
-			return
+			return errStopping
 		}
 	}
 }
 
+func (p *DownloadWorkerPool) fail(ctx context.Context, log ports.Logger, jobID string, stage constants.JobState, err error) {
+	if errors.Is(err, errStopping) || errors.Is(context.Cause(ctx), errStopping) {
+		log.Info("job interrupted by shutdown, it will be resumed on restart", "stage", stage)
+		return
+	}
+	if ctx.Err() != nil {
+		log.Info("job cancelled", "stage", stage)
+		p.cancelled(log, jobID, stage)
+		return
+	}
+	log.Error("job moved to dead-letter list", "stage", stage, "err", err)
+	p.setState(log, jobID, constants.JobStateFailed, fmt.Sprintf("%s: %s", stage, err))
+	metrics.JobOutcomes.WithLabelValues(string(constants.JobStateFailed), string(stage), errorClass(err)).Inc()
+}
+
+// cancelled records the outcome of a job Cancel stopped in stage. Cancel
+// records the state before it stops the job, so it is only written here if
+// that failed.
+func (p *DownloadWorkerPool) cancelled(log ports.Logger, jobID string, stage constants.JobState) {
+	if status, _ := p.jobStore.Get(jobID); status.State != constants.JobStateCancelled {
+		p.setState(log, jobID, constants.JobStateCancelled, "")
+	}
+	metrics.JobOutcomes.WithLabelValues(string(constants.JobStateCancelled), string(stage), "").Inc()
+}
+
+// errorClass groups stage errors for the job outcome metric.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, ports.ErrNoConfidentMatch):
+		return "no_match"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+func (p *DownloadWorkerPool) setState(log ports.Logger, jobID string, state constants.JobState, reason string) {
+	status, err := p.jobStore.SetState(jobID, state, reason)
+	if errors.Is(err, ports.ErrJobFinished) {
+		// Cancel got there first; the job stops at its next check.
+		log.Info("job already finished, not recording state", "state", state)
+		return
+	}
+	if err != nil {
+		log.Warn("failed to record job state", "state", state, "err", err)
+		return
+	}
+	p.publishState(status)
+}
+
+func (p *DownloadWorkerPool) publishState(status models.JobStatus) {
+	p.events.Publish(models.JobEvent{
+		Type:      constants.JobEventTypeState,
+		JobID:     status.Job.ID,
+		RequestID: status.Job.RequestID,
+		State:     status.State,
+		Error:     status.Error,
+		Time:      status.UpdatedAt,
+	})
+}
+
+func (p *DownloadWorkerPool) updateQueueDepth() {
+	metrics.QueueDepth.Set(float64(len(p.jobStore.ListByState(constants.JobStateQueued))))
+}
+
+// notify wakes an idle worker. Workers that are busy pick up new jobs on
+// their own once they finish, so a full wake channel can be ignored.
+func (p *DownloadWorkerPool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
 func (p *DownloadWorkerPool) Enqueue(ctx context.Context, job models.DownloadJob) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if job.ID == "" {
+		return errors.New("missing job ID")
+	}
+	if p.stopping() {
+		return errStopping
+	}
+	status, err := p.jobStore.Create(job)
+	if err != nil {
+		return err
+	}
+	p.updateQueueDepth()
+	p.publishState(status)
+
+	p.notify()
+	return nil
+}
+
+// Requeue moves a job from the dead-letter list back into the queue.
+func (p *DownloadWorkerPool) Requeue(ctx context.Context, jobID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	status, found := p.jobStore.Get(jobID)
+	if !found {
+		return ports.ErrJobNotFound
+	}
+	if status.State != constants.JobStateFailed {
+		return ports.ErrJobNotRequeueable
+	}
+	if p.stopping() {
+		return errStopping
+	}
+	requeued, err := p.jobStore.SetState(jobID, constants.JobStateQueued, "")
+	if err != nil {
+		return err
+	}
+	p.updateQueueDepth()
+	p.publishState(requeued)
+
+	p.log.Info("requeued dead-lettered job", "job_id", jobID, "request_id", status.Job.RequestID)
+	p.notify()
+	return nil
+}
+
+// Cancel stops a job that has not finished. Queued jobs are never picked up;
+// a job being processed has its context cancelled, killing any external
+// process it is waiting on.
+func (p *DownloadWorkerPool) Cancel(ctx context.Context, jobID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	status, found := p.jobStore.Get(jobID)
+	if !found {
+		return ports.ErrJobNotFound
+	}
+	if status.State.Terminal() {
+		return ports.ErrJobNotCancellable
+	}
+	cancelled, err := p.jobStore.SetState(jobID, constants.JobStateCancelled, "")
+	if errors.Is(err, ports.ErrJobFinished) {
+		return ports.ErrJobNotCancellable
+	}
+	if err != nil {
+		return err
+	}
+	p.updateQueueDepth()
+	p.publishState(cancelled)
+
+	p.mu.Lock()
+	cancel, running := p.running[jobID]
+	p.mu.Unlock()
+	if running {
+		// The worker records the outcome once the job has stopped.
+		cancel(nil)
+	} else {
+		metrics.JobOutcomes.WithLabelValues(string(constants.JobStateCancelled), string(status.State), "").Inc()
+	}
+
+	p.log.Info("cancelled job", "job_id", jobID, "request_id", status.Job.RequestID, "state", status.State)
+	return nil
+}
+
+// CancelRequest cancels every unfinished job of a request and returns the IDs
+// of the jobs it cancelled.
+func (p *DownloadWorkerPool) CancelRequest(ctx context.Context, requestID string) ([]string, error) {
+	statuses := p.jobStore.ListByRequest(requestID)
+	if len(statuses) == 0 {
+		return nil, ports.ErrJobNotFound
+	}
+
+	cancelled := []string{}
+	for _, status := range statuses {
+		if status.State.Terminal() {
+			continue
+		}
+		err := p.Cancel(ctx, status.Job.ID)
+		if errors.Is(err, ports.ErrJobNotCancellable) {
+			// Finished while the others were being cancelled.
+			continue
+		}
+		if err != nil {
+			return cancelled, err
+		}
+		cancelled = append(cancelled, status.Job.ID)
+	}
+	return cancelled, nil
+}
+
+// Shutdown stops workers from claiming new jobs and waits for the jobs in
+// progress to finish. Once ctx is done, those jobs are interrupted instead;
+// like everything still queued, they are resumed on the next start. Shutdown
+// returns ctx's error if it had to interrupt jobs.
+func (p *DownloadWorkerPool) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	var err error
 	select {
-	case p.jobs <- job:
-		return nil
+	case <-drained:
+		p.log.Info("all in-flight jobs finished")
 	case <-ctx.Done():
-		return ctx.Err()
+		err = ctx.Err()
+		p.mu.Lock()
+		p.log.Warn("shutdown grace period expired, interrupting jobs in progress", "jobs", len(p.running))
+		for _, cancel := range p.running {
+			cancel(errStopping)
+		}
+		p.mu.Unlock()
+		<-drained
+	}
+
+	p.logUnfinished()
+	return err
+}
+
+func (p *DownloadWorkerPool) stopping() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
 	}
 }
 
-func (p *DownloadWorkerPool) Shutdown() {
-	close(p.stop)
-	close(p.jobs)
-	p.wg.Wait()
+// logUnfinished records which jobs are left for the next start.
+func (p *DownloadWorkerPool) logUnfinished() {
+	for _, state := range []constants.JobState{
+		constants.JobStateQueued,
+		constants.JobStateSearching,
+		constants.JobStateDownloading,
+		constants.JobStateTagging,
+	} {
+		statuses := p.jobStore.ListByState(state)
+		if len(statuses) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(statuses))
+		for _, status := range statuses {
+			ids = append(ids, status.Job.ID)
+		}
+		p.log.Info("unfinished jobs will resume on next start", "state", state, "count", len(ids), "job_ids", ids)
+	}
 }
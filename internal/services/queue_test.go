@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/providers"
+)
+
+// fakeYT finds every track at the same URL. search and download, when set,
+// decide how each call ends.
+type fakeYT struct {
+	search   func(ctx context.Context) error
+	download func(ctx context.Context, progress func(float64)) error
+}
+
+func (y *fakeYT) Search(ctx context.Context, job *models.DownloadJob) (string, error) {
+	if y.search != nil {
+		if err := y.search(ctx); err != nil {
+			return "", err
+		}
+	}
+	return "https://music.youtube.com/watch?v=" + job.TrackID, nil
+}
+
+func (y *fakeYT) Download(ctx context.Context, path string, videoURL string, format constants.AudioFormat, progress func(percent float64)) error {
+	if y.download != nil {
+		return y.download(ctx, progress)
+	}
+	return nil
+}
+
+// fakeFS stages and finalizes files without touching the disk, recording
+// what was discarded. tag and finalize, when set, decide how tagging and
+// moving the file into the library end.
+type fakeFS struct {
+	ports.FSProvider
+	tag      func(ctx context.Context) error
+	finalize func(ctx context.Context) error
+
+	mu        sync.Mutex
+	discarded []string
+}
+
+func (f *fakeFS) StagePath(ctx context.Context, job *models.DownloadJob) (string, error) {
+	return filepath.Join("staging", job.ID), nil
+}
+
+func (f *fakeFS) TagFile(ctx context.Context, filePath string, job *models.DownloadJob) error {
+	if f.tag != nil {
+		return f.tag(ctx)
+	}
+	return nil
+}
+
+func (f *fakeFS) Finalize(ctx context.Context, stagedPath string, job *models.DownloadJob) (string, error) {
+	if f.finalize != nil {
+		if err := f.finalize(ctx); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join("library", job.ID), nil
+}
+
+func (f *fakeFS) Discard(ctx context.Context, stagedPath string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.discarded = append(f.discarded, stagedPath)
+}
+
+type poolFixture struct {
+	pool     *DownloadWorkerPool
+	jobs     ports.JobStoreProvider
+	dataHome string
+	yt       *fakeYT
+	fs       *fakeFS
+}
+
+var noRetry = RetryPolicies{
+	constants.JobStateSearching:   {Attempts: 1},
+	constants.JobStateDownloading: {Attempts: 1},
+	constants.JobStateTagging:     {Attempts: 1},
+}
+
+// newPoolFixture starts a pool of workers over a job store in a temporary
+// directory and fake YouTube and filesystem providers.
+func newPoolFixture(t *testing.T, workers int, retry RetryPolicies) *poolFixture {
+	t.Helper()
+	dataHome := t.TempDir()
+	jobs, err := providers.NewJobStoreProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &poolFixture{jobs: jobs, dataHome: dataHome, yt: &fakeYT{}, fs: &fakeFS{}}
+	f.pool = NewDownloadWorkerPool(workers, retry, &Deps{
+		Log:     quietLogger(),
+		YT:      f.yt,
+		FS:      f.fs,
+		Jobs:    jobs,
+		Library: providers.NewLibraryProvider(t.TempDir()),
+		Events:  NewEventBus(quietLogger()),
+	})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		f.pool.Shutdown(ctx)
+		jobs.Close()
+	})
+	return f
+}
+
+func (f *poolFixture) enqueue(t *testing.T, requestID string, jobIDs ...string) {
+	t.Helper()
+	for _, id := range jobIDs {
+		if err := f.pool.Enqueue(context.Background(), models.DownloadJob{ID: id, RequestID: requestID, TrackID: "track-" + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// waitState waits for a job to reach state.
+func (f *poolFixture) waitState(t *testing.T, jobID string, state constants.JobState) models.JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, _ := f.jobs.Get(jobID)
+		if status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s", jobID, status.State, state)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFinalizeFailureDiscardsTheStagedFile(t *testing.T) {
+	f := newPoolFixture(t, 1, noRetry)
+	f.fs.finalize = func(ctx context.Context) error {
+		return errors.New("failed to move file into library")
+	}
+	f.enqueue(t, "req", "a")
+
+	status := f.waitState(t, "a", constants.JobStateFailed)
+	if !strings.HasPrefix(status.Error, string(constants.JobStateTagging)+":") {
+		t.Errorf("failed job error = %q, want it failed while tagging", status.Error)
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if len(f.fs.discarded) != 1 || f.fs.discarded[0] != filepath.Join("staging", "a") {
+		t.Errorf("discarded = %v, want the staged file of the job", f.fs.discarded)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	f := newPoolFixture(t, 0, noRetry)
+	f.enqueue(t, "req", "a")
+
+	if err := f.pool.Cancel(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	f.waitState(t, "a", constants.JobStateCancelled)
+	if err := f.pool.Cancel(context.Background(), "a"); !errors.Is(err, ports.ErrJobNotCancellable) {
+		t.Errorf("cancelling twice: %v", err)
+	}
+	if err := f.pool.Cancel(context.Background(), "unknown"); !errors.Is(err, ports.ErrJobNotFound) {
+		t.Errorf("cancelling an unknown job: %v", err)
+	}
+}
+
+func TestCancelStopsRunningJob(t *testing.T) {
+	f := newPoolFixture(t, 1, noRetry)
+	downloading := make(chan struct{})
+	f.yt.download = func(ctx context.Context, progress func(float64)) error {
+		close(downloading)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	f.enqueue(t, "req", "a")
+	<-downloading
+
+	if err := f.pool.Cancel(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	f.waitState(t, "a", constants.JobStateCancelled)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.fs.mu.Lock()
+		discarded := len(f.fs.discarded)
+		f.fs.mu.Unlock()
+		if discarded == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("staged file of the cancelled job was not discarded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCancelDuringLastStageStaysCancelled(t *testing.T) {
+	f := newPoolFixture(t, 1, noRetry)
+	downloading, finish := make(chan struct{}), make(chan struct{})
+	// The download ignores cancellation and succeeds, so the worker carries
+	// on to tagging after Cancel.
+	f.yt.download = func(ctx context.Context, progress func(float64)) error {
+		close(downloading)
+		<-finish
+		return nil
+	}
+	tagged := make(chan struct{})
+	f.fs.tag = func(ctx context.Context) error {
+		defer close(tagged)
+		return nil
+	}
+	f.enqueue(t, "req", "a")
+	<-downloading
+
+	if err := f.pool.Cancel(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	close(finish)
+	<-tagged
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.pool.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := f.jobs.Get("a"); status.State != constants.JobStateCancelled {
+		t.Fatalf("job is %s after the worker finished, want cancelled", status.State)
+	}
+	if _, err := f.jobs.SetState("a", constants.JobStateTagging, ""); !errors.Is(err, ports.ErrJobFinished) {
+		t.Errorf("moving a cancelled job on: %v", err)
+	}
+}
+
+func TestShutdownWaitsForJobsInProgress(t *testing.T) {
+	f := newPoolFixture(t, 1, noRetry)
+	downloading, finish := make(chan struct{}), make(chan struct{})
+	f.yt.download = func(ctx context.Context, progress func(float64)) error {
+		close(downloading)
+		<-finish
+		return nil
+	}
+	f.enqueue(t, "req", "a")
+	<-downloading
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- f.pool.Shutdown(ctx)
+	}()
+	// Once stopping, the pool takes no more jobs.
+	deadline := time.Now().Add(5 * time.Second)
+	for !f.pool.stopping() {
+		if time.Now().After(deadline) {
+			t.Fatal("pool did not start stopping")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	err := f.pool.Enqueue(context.Background(), models.DownloadJob{ID: "late", RequestID: "req", TrackID: "track-late"})
+	if err == nil {
+		t.Error("Enqueue during shutdown succeeded")
+	}
+	if _, found := f.jobs.Get("late"); found {
+		t.Error("job enqueued during shutdown was stored")
+	}
+
+	close(finish)
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown = %v, want the job in progress to finish", err)
+	}
+	if status, _ := f.jobs.Get("a"); status.State != constants.JobStateDone {
+		t.Errorf("job in progress is %s after shutdown, want done", status.State)
+	}
+}
+
+func TestShutdownLeavesInterruptedJobsResumable(t *testing.T) {
+	f := newPoolFixture(t, 1, noRetry)
+	downloading := make(chan struct{})
+	f.yt.download = func(ctx context.Context, progress func(float64)) error {
+		close(downloading)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	f.enqueue(t, "req", "a", "b")
+	<-downloading
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.pool.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if status, _ := f.jobs.Get("a"); status.State.Terminal() {
+		t.Fatalf("interrupted job is %s, want it left unfinished", status.State)
+	}
+
+	// The next start picks up the interrupted job before the one still queued.
+	reopened, err := providers.NewJobStoreProvider(quietLogger(), f.dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for _, id := range []string{"a", "b"} {
+		status, ok := reopened.Claim(constants.JobStateSearching)
+		if !ok || status.Job.ID != id {
+			t.Errorf("Claim after restart = %+v, %v, want job %s", status, ok, id)
+		}
+	}
+}
+
+func TestCancelRequestCancelsUnfinishedJobs(t *testing.T) {
+	f := newPoolFixture(t, 0, noRetry)
+	f.enqueue(t, "req", "a", "b", "c")
+	f.enqueue(t, "other", "d")
+	if _, err := f.jobs.SetState("c", constants.JobStateFailed, "searching: no match"); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, err := f.pool.CancelRequest(context.Background(), "req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(cancelled)
+	if len(cancelled) != 2 || cancelled[0] != "a" || cancelled[1] != "b" {
+		t.Fatalf("cancelled %v, want [a b]", cancelled)
+	}
+	for id, want := range map[string]constants.JobState{
+		"a": constants.JobStateCancelled,
+		"b": constants.JobStateCancelled,
+		"c": constants.JobStateFailed,
+		"d": constants.JobStateQueued,
+	} {
+		if status, _ := f.jobs.Get(id); status.State != want {
+			t.Errorf("job %s is %s, want %s", id, status.State, want)
+		}
+	}
+	if _, err := f.pool.CancelRequest(context.Background(), "unknown"); !errors.Is(err, ports.ErrJobNotFound) {
+		t.Errorf("cancelling an unknown request: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// requestRetention is how long the progress of a fully queued request is
+// kept. Its jobs stay listed under /jobs for as long as the job store keeps
+// them.
+const requestRetention = time.Hour
+
+// RequestTracker queues download requests in the background and reports how
+// far each has got, so the HTTP handlers can answer straight away instead of
+// resolving every album and artist within the write timeout.
+type RequestTracker struct {
+	events ports.EventBus
+
+	mu       sync.Mutex
+	requests map[string]*trackedRequest
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type trackedRequest struct {
+	progress models.RequestProgress
+	// running counts the queueing runs still adding to the request; a search
+	// can be downloaded from more than once under the same request ID.
+	running    int
+	runs       []queueRun
+	finishedAt time.Time
+}
+
+type queueRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRequestTracker publishes a request event on events whenever a request
+// is fully queued.
+func NewRequestTracker(events ports.EventBus) *RequestTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RequestTracker{
+		events:   events,
+		requests: make(map[string]*trackedRequest),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Go runs queue in the background for requestID. queue reports what it
+// queued through record, which may be called any number of times.
+func (t *RequestTracker) Go(ctx context.Context, requestID string, queue func(ctx context.Context, record func(QueueResult))) models.RequestProgress {
+	progress, _ := t.start(ctx, requestID, queue)
+	return progress
+}
+
+// Run is Go for callers that already run in the background: it waits for
+// queue to return, abandoning it once ctx is done, and returns the progress
+// of the request then.
+func (t *RequestTracker) Run(ctx context.Context, requestID string, queue func(ctx context.Context, record func(QueueResult))) models.RequestProgress {
+	_, run := t.start(ctx, requestID, queue)
+	stop := context.AfterFunc(ctx, run.cancel)
+	defer stop()
+	<-run.done
+	progress, _ := t.Get(requestID)
+	return progress
+}
+
+func (t *RequestTracker) start(ctx context.Context, requestID string, queue func(ctx context.Context, record func(QueueResult))) (models.RequestProgress, queueRun) {
+	runCtx, cancel := context.WithCancel(t.ctx)
+	runCtx = logger.Into(runCtx, logger.From(ctx))
+
+	t.mu.Lock()
+	t.prune()
+	request, exists := t.requests[requestID]
+	if !exists {
+		request = &trackedRequest{progress: models.RequestProgress{RequestID: requestID, Jobs: []string{}}}
+		t.requests[requestID] = request
+	}
+	request.running++
+	run := queueRun{cancel: cancel, done: make(chan struct{})}
+	request.runs = append(request.runs, run)
+	request.progress.State = constants.RequestStateQueueing
+	progress := request.snapshot()
+	t.wg.Add(1)
+	t.mu.Unlock()
+
+	record := func(result QueueResult) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		request.progress.Jobs = append(request.progress.Jobs, result.JobIDs...)
+		request.progress.Skipped += result.Skipped
+		request.progress.Failed += result.Failed
+	}
+	go func() {
+		defer t.wg.Done()
+		defer close(run.done)
+		defer cancel()
+		queue(runCtx, record)
+
+		t.mu.Lock()
+		request.running--
+		queued := request.running == 0
+		if queued {
+			request.progress.State = constants.RequestStateQueued
+			request.runs = nil
+			request.finishedAt = time.Now()
+			logger.From(runCtx).Info("request queued", "jobs", len(request.progress.Jobs), "skipped", request.progress.Skipped, "failed", request.progress.Failed)
+		}
+		t.mu.Unlock()
+		if queued {
+			t.events.Publish(models.JobEvent{Type: constants.JobEventTypeRequest, RequestID: requestID, Time: time.Now()})
+		}
+	}()
+	return progress, run
+}
+
+// Get returns the progress of a request queued within the last hour.
+func (t *RequestTracker) Get(requestID string) (models.RequestProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+	request, exists := t.requests[requestID]
+	if !exists {
+		return models.RequestProgress{}, false
+	}
+	return request.snapshot(), true
+}
+
+// Queueing reports whether jobs are still being queued for a request.
+// Requests the tracker does not know, such as those queued before a restart,
+// are not.
+func (t *RequestTracker) Queueing(requestID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	request, exists := t.requests[requestID]
+	return exists && request.running > 0
+}
+
+// Stop abandons the queueing of a request still in progress and waits for it
+// to return, so nothing more is queued for the request afterwards.
+func (t *RequestTracker) Stop(requestID string) {
+	t.mu.Lock()
+	request, exists := t.requests[requestID]
+	if !exists {
+		t.mu.Unlock()
+		return
+	}
+	runs := request.runs
+	t.mu.Unlock()
+
+	for _, run := range runs {
+		run.cancel()
+		<-run.done
+	}
+}
+
+// Shutdown waits for requests still being queued, which are abandoned once
+// ctx is done.
+func (t *RequestTracker) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.cancel()
+		return nil
+	case <-ctx.Done():
+		t.cancel()
+		<-stopped
+		return ctx.Err()
+	}
+}
+
+// prune drops requests queued more than requestRetention ago. Callers hold
+// the lock.
+func (t *RequestTracker) prune() {
+	cutoff := time.Now().Add(-requestRetention)
+	for id, request := range t.requests {
+		if request.running == 0 && request.finishedAt.Before(cutoff) {
+			delete(t.requests, id)
+		}
+	}
+}
+
+func (r *trackedRequest) snapshot() models.RequestProgress {
+	progress := r.progress
+	progress.Jobs = append([]string{}, r.progress.Jobs...)
+	return progress
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"audio-scraper/internal/constants"
+)
+
+func TestRequestTrackerReportsProgress(t *testing.T) {
+	tracker := NewRequestTracker(NewEventBus(quietLogger()))
+	release := make(chan struct{})
+	progress := tracker.Go(quietContext(), "req", func(ctx context.Context, record func(QueueResult)) {
+		record(QueueResult{JobIDs: []string{"a"}, Skipped: 1})
+		<-release
+		record(QueueResult{JobIDs: []string{"b"}, Failed: 1})
+	})
+	if progress.State != constants.RequestStateQueueing || len(progress.Jobs) != 0 {
+		t.Fatalf("initial progress = %+v, want queueing without jobs", progress)
+	}
+	if _, found := tracker.Get("other"); found {
+		t.Fatal("Get found an unknown request")
+	}
+
+	close(release)
+	if err := tracker.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	progress, found := tracker.Get("req")
+	if !found {
+		t.Fatal("request not tracked after queueing")
+	}
+	if progress.State != constants.RequestStateQueued || len(progress.Jobs) != 2 || progress.Skipped != 1 || progress.Failed != 1 {
+		t.Fatalf("final progress = %+v", progress)
+	}
+}
+
+func TestRequestTrackerStopWaitsForQueueing(t *testing.T) {
+	tracker := NewRequestTracker(NewEventBus(quietLogger()))
+	started := make(chan struct{})
+	tracker.Go(quietContext(), "req", func(ctx context.Context, record func(QueueResult)) {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		record(QueueResult{Failed: 1})
+	})
+	<-started
+
+	tracker.Stop("req")
+	progress, _ := tracker.Get("req")
+	if progress.State != constants.RequestStateQueued || progress.Failed != 1 {
+		t.Fatalf("progress after Stop = %+v, want queued with the last result recorded", progress)
+	}
+}
+
+func TestRequestTrackerShutdownAbandonsQueueing(t *testing.T) {
+	tracker := NewRequestTracker(NewEventBus(quietLogger()))
+	tracker.Go(quietContext(), "req", func(ctx context.Context, record func(QueueResult)) {
+		<-ctx.Done()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tracker.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"time"
+
+	"audio-scraper/internal/constants"
+)
+
+// DefaultRetryPolicy is used for every stage without an explicit policy.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   constants.DefaultRetryAttempts,
+	Backoff:    constants.DefaultRetryBackoff,
+	MaxBackoff: constants.DefaultRetryMaxBackoff,
+}
+
+// RetryPolicy describes how often a job stage is attempted before the job is
+// moved to the dead-letter list, and how long to wait between attempts. The
+// wait doubles after every failed attempt, up to MaxBackoff.
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// delay returns the wait after the given failed attempt, counting from 1.
+// MaxBackoff caps every wait, the first one included.
+func (r RetryPolicy) delay(attempt int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < attempt; i++ {
+		if r.MaxBackoff > 0 && d >= r.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		return r.MaxBackoff
+	}
+	return d
+}
+
+// RetryPolicies maps a job stage (searching, downloading, tagging) to its policy.
+type RetryPolicies map[constants.JobState]RetryPolicy
+
+func (r RetryPolicies) For(stage constants.JobState) RetryPolicy {
+	policy, ok := r[stage]
+	if !ok {
+		policy = DefaultRetryPolicy
+	}
+	if policy.Attempts <= 0 {
+		policy.Attempts = 1
+	}
+	return policy
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/ports"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"first wait is the backoff", RetryPolicy{Backoff: time.Second}, 1, time.Second},
+		{"second wait doubles", RetryPolicy{Backoff: time.Second}, 2, 2 * time.Second},
+		{"fourth wait", RetryPolicy{Backoff: time.Second}, 4, 8 * time.Second},
+		{"no cap without MaxBackoff", RetryPolicy{Backoff: time.Second}, 11, 1024 * time.Second},
+		{"below the cap", RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}, 3, 4 * time.Second},
+		{"capped", RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}, 5, 10 * time.Second},
+		{"stays capped", RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}, 1000, 10 * time.Second},
+		{"cap below the backoff", RetryPolicy{Backoff: time.Minute, MaxBackoff: 10 * time.Second}, 1, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.delay(tt.attempt); got != tt.want {
+				t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPoliciesFallBackToTheDefault(t *testing.T) {
+	policies := RetryPolicies{constants.JobStateSearching: {Attempts: 0, Backoff: time.Second}}
+	if got := policies.For(constants.JobStateSearching); got.Attempts != 1 || got.Backoff != time.Second {
+		t.Errorf("For(searching) = %+v, want a single attempt", got)
+	}
+	if got := policies.For(constants.JobStateTagging); got != DefaultRetryPolicy {
+		t.Errorf("For(tagging) = %+v, want the default policy", got)
+	}
+}
+
+func TestExhaustedRetriesDeadLetterTheJob(t *testing.T) {
+	f := newPoolFixture(t, 1, RetryPolicies{
+		constants.JobStateSearching:   {Attempts: 1},
+		constants.JobStateDownloading: {Attempts: 3, Backoff: time.Millisecond},
+		constants.JobStateTagging:     {Attempts: 1},
+	})
+	var downloads atomic.Int32
+	f.yt.download = func(ctx context.Context, progress func(float64)) error {
+		downloads.Add(1)
+		return errors.New("connection reset")
+	}
+	f.enqueue(t, "req", "a")
+
+	status := f.waitState(t, "a", constants.JobStateFailed)
+	if got := downloads.Load(); got != 3 {
+		t.Errorf("download attempts = %d, want 3", got)
+	}
+	if !strings.Contains(status.Error, "downloading") || !strings.Contains(status.Error, "after 3 attempts") {
+		t.Errorf("error = %q, want the stage and the attempts", status.Error)
+	}
+	deadLetters := f.jobs.ListByState(constants.JobStateFailed)
+	if len(deadLetters) != 1 || deadLetters[0].Job.ID != "a" {
+		t.Errorf("dead letters = %+v, want the job", deadLetters)
+	}
+}
+
+func TestNoConfidentMatchIsNotRetried(t *testing.T) {
+	f := newPoolFixture(t, 1, RetryPolicies{constants.JobStateSearching: {Attempts: 3, Backoff: time.Millisecond}})
+	var searches atomic.Int32
+	f.yt.search = func(ctx context.Context) error {
+		searches.Add(1)
+		return ports.ErrNoConfidentMatch
+	}
+	f.enqueue(t, "req", "a")
+
+	f.waitState(t, "a", constants.JobStateFailed)
+	if got := searches.Load(); got != 1 {
+		t.Errorf("search attempts = %d, want 1", got)
+	}
+}
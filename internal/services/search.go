@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// SearchLimits is how many results of each kind a search returns. Kinds with
+// fewer results leave their share to tracks.
+type SearchLimits struct {
+	Tracks    int
+	Albums    int
+	Artists   int
+	Playlists int
+}
+
+// Search looks query up on Spotify and returns up to limits of each kind of
+// result as download choices.
+func Search(ctx context.Context, sp ports.SpotifyProvider, query string, limits SearchLimits) ([]models.Choice, error) {
+	log := logger.From(ctx)
+	results, err := sp.Search(ctx, query, spotify.SearchTypeArtist|spotify.SearchTypeAlbum|spotify.SearchTypeTrack|spotify.SearchTypePlaylist)
+	if err != nil {
+		log.Error("spotify search failed", "err", err)
+		return nil, errors.New("spotify search failed")
+	}
+
+	choices, err := processSearchData(results, limits, log)
+	if err != nil {
+		log.Error("processing search data failed", "err", err)
+		return nil, errors.New("processing search data failed")
+	}
+	return choices, nil
+}
+
+func processSearchData(result *spotify.SearchResult, limits SearchLimits, log ports.Logger) ([]models.Choice, error) {
+	trackCount := limits.Tracks
+	albumCount := limits.Albums
+	artistCount := limits.Artists
+	playlistCount := limits.Playlists
+
+	var tracks []spotify.FullTrack
+	var albums []spotify.SimpleAlbum
+	var artists []spotify.FullArtist
+	var playlists []spotify.SimplePlaylist
+	if result.Tracks != nil {
+		tracks = result.Tracks.Tracks
+		log.Debug("tracks found", "count", len(tracks))
+	}
+	if result.Albums != nil {
+		albums = result.Albums.Albums
+		log.Debug("albums found", "count", len(albums))
+	}
+	if result.Artists != nil {
+		artists = result.Artists.Artists
+		log.Debug("artists found", "count", len(artists))
+	}
+	if result.Playlists != nil {
+		// Spotify pads playlist results with null entries for playlists it
+		// can no longer serve.
+		for _, p := range result.Playlists.Playlists {
+			if p.ID != "" {
+				playlists = append(playlists, p)
+			}
+		}
+		log.Debug("playlists found", "count", len(playlists))
+	}
+
+	if len(albums) < albumCount {
+		trackCount += albumCount - len(albums)
+		albumCount = len(albums)
+	}
+	if len(artists) < artistCount {
+		trackCount += artistCount - len(artists)
+		artistCount = len(artists)
+	}
+	if len(playlists) < playlistCount {
+		trackCount += playlistCount - len(playlists)
+		playlistCount = len(playlists)
+	}
+	log.Debug("reallocated counts", "tracks", trackCount, "albums", albumCount, "artists", artistCount, "playlists", playlistCount)
+
+	var choices []models.Choice
+	for i := 0; i < min(trackCount, len(tracks)); i++ {
+		t := tracks[i]
+		artistName := ""
+		if len(t.Artists) > 0 {
+			artistName = t.Artists[0].Name
+		}
+		label := fmt.Sprintf("Track: %s - %s [%s]", t.Name, artistName, t.Album.Name)
+
+		choice := models.Choice{
+			Type:      constants.SpotifyEntityTypeTrack,
+			ID:        t.ID.String(),
+			Label:     label,
+			Thumbnail: imageURL(t.Album.Images),
+		}
+		choices = append(choices, choice)
+	}
+
+	for i := 0; i < min(albumCount, len(albums)); i++ {
+		a := albums[i]
+		artistName := ""
+		if len(a.Artists) > 0 {
+			artistName = a.Artists[0].Name
+		}
+		label := fmt.Sprintf("Album: %s - %s", a.Name, artistName)
+
+		choice := models.Choice{
+			Type:      constants.SpotifyEntityTypeAlbum,
+			ID:        a.ID.String(),
+			Label:     label,
+			Thumbnail: imageURL(a.Images),
+		}
+		choices = append(choices, choice)
+	}
+
+	for i := 0; i < min(artistCount, len(artists)); i++ {
+		ar := artists[i]
+		label := fmt.Sprintf("Artist: %s", ar.Name)
+
+		choice := models.Choice{
+			Type:      constants.SpotifyEntityTypeArtist,
+			ID:        ar.ID.String(),
+			Label:     label,
+			Thumbnail: imageURL(ar.Images),
+		}
+		choices = append(choices, choice)
+	}
+
+	for i := 0; i < min(playlistCount, len(playlists)); i++ {
+		p := playlists[i]
+		label := fmt.Sprintf("Playlist: %s - %s", p.Name, p.Owner.DisplayName)
+
+		choice := models.Choice{
+			Type:      constants.SpotifyEntityTypePlaylist,
+			ID:        p.ID.String(),
+			Label:     label,
+			Thumbnail: imageURL(p.Images),
+		}
+		choices = append(choices, choice)
+	}
+
+	return choices, nil
+}
+
+// imageURL returns the largest of a Spotify entity's images, which Spotify
+// lists first.
+func imageURL(images []spotify.Image) string {
+	if len(images) == 0 {
+		return ""
+	}
+	return images[0].URL
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// quietLogger discards everything, keeping test output readable.
+func quietLogger() ports.Logger {
+	return logger.New(io.Discard, slog.LevelError+1)
+}
+
+func quietContext() context.Context {
+	return logger.Into(context.Background(), quietLogger())
+}
+
+// fakeSpotify serves canned Spotify data. Lookups of anything missing fail,
+// and the gate, when set, holds up playlist track listings until closed.
+type fakeSpotify struct {
+	mu             sync.Mutex
+	artists        map[spotify.ID]spotify.FullArtist
+	tracks         map[spotify.ID]spotify.FullTrack
+	albums         map[spotify.ID]spotify.FullAlbum
+	artistAlbums   map[spotify.ID][]spotify.SimpleAlbum
+	playlists      map[spotify.ID]spotify.FullPlaylist
+	playlistTracks map[spotify.ID][]spotify.FullTrack
+	gate           chan struct{}
+}
+
+func newFakeSpotify() *fakeSpotify {
+	return &fakeSpotify{
+		artists:        make(map[spotify.ID]spotify.FullArtist),
+		tracks:         make(map[spotify.ID]spotify.FullTrack),
+		albums:         make(map[spotify.ID]spotify.FullAlbum),
+		artistAlbums:   make(map[spotify.ID][]spotify.SimpleAlbum),
+		playlists:      make(map[spotify.ID]spotify.FullPlaylist),
+		playlistTracks: make(map[spotify.ID][]spotify.FullTrack),
+	}
+}
+
+var errNotFound = errors.New("not found")
+
+// addAlbum adds an album and its tracks, numbered from 1, by ID.
+func (s *fakeSpotify) addAlbum(id spotify.ID, group string, trackIDs ...spotify.ID) spotify.SimpleAlbum {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	album := spotify.SimpleAlbum{ID: id, Name: "Album " + id.String(), AlbumType: "album", AlbumGroup: group}
+	full := spotify.FullAlbum{SimpleAlbum: album}
+	for i, trackID := range trackIDs {
+		track := spotify.FullTrack{
+			SimpleTrack: spotify.SimpleTrack{ID: trackID, Name: "Track " + trackID.String(), TrackNumber: spotify.Numeric(i + 1), DiscNumber: 1},
+			Album:       album,
+		}
+		s.tracks[trackID] = track
+		full.Tracks.Tracks = append(full.Tracks.Tracks, track.SimpleTrack)
+	}
+	s.albums[id] = full
+	return album
+}
+
+func (s *fakeSpotify) Search(ctx context.Context, query string, t spotify.SearchType, opts ...spotify.RequestOption) (*spotify.SearchResult, error) {
+	return nil, errNotFound
+}
+
+func (s *fakeSpotify) GetTrack(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullTrack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	track, ok := s.tracks[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &track, nil
+}
+
+func (s *fakeSpotify) GetAlbum(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullAlbum, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	album, ok := s.albums[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &album, nil
+}
+
+func (s *fakeSpotify) GetArtist(ctx context.Context, id spotify.ID) (*spotify.FullArtist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	artist, ok := s.artists[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &artist, nil
+}
+
+func (s *fakeSpotify) GetAlbumTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) ([]spotify.SimpleTrack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	album, ok := s.albums[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return album.Tracks.Tracks, nil
+}
+
+func (s *fakeSpotify) GetArtistAlbums(ctx context.Context, id spotify.ID, albumTypes []spotify.AlbumType, opts ...spotify.RequestOption) ([]spotify.SimpleAlbum, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	albums, ok := s.artistAlbums[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return albums, nil
+}
+
+func (s *fakeSpotify) GetPlaylist(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) (*spotify.FullPlaylist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	playlist, ok := s.playlists[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &playlist, nil
+}
+
+func (s *fakeSpotify) GetPlaylistTracks(ctx context.Context, id spotify.ID, opts ...spotify.RequestOption) ([]spotify.FullTrack, error) {
+	s.mu.Lock()
+	gate := s.gate
+	s.mu.Unlock()
+	if gate != nil {
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tracks, ok := s.playlistTracks[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return tracks, nil
+}
+
+// recordingQueue is a ports.DownloadQueue that only records the jobs
+// enqueued.
+type recordingQueue struct {
+	mu   sync.Mutex
+	jobs []models.DownloadJob
+}
+
+func (q *recordingQueue) Enqueue(ctx context.Context, job models.DownloadJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func (q *recordingQueue) Requeue(ctx context.Context, jobID string) error { return nil }
+func (q *recordingQueue) Cancel(ctx context.Context, jobID string) error  { return nil }
+func (q *recordingQueue) CancelRequest(ctx context.Context, requestID string) ([]string, error) {
+	return nil, nil
+}
+func (q *recordingQueue) Shutdown(ctx context.Context) error { return nil }
+
+// trackIDs returns the track IDs of the jobs enqueued, in order.
+func (q *recordingQueue) trackIDs() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids := make([]string, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		ids = append(ids, job.TrackID)
+	}
+	return ids
+}
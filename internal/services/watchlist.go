@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// Watcher downloads the new releases of the artists on the watchlist. Every
+// interval it lists the releases of each artist and queues the ones it has
+// not seen before in the background through the request tracker, one request
+// per release, telling the notifier once a release is queued. Releases
+// outside an artist's album groups are recorded as seen without being
+// queued; releases that fail to queue are tried again on the next check,
+// skipping the tracks already downloading.
+type Watcher struct {
+	interval time.Duration
+	format   constants.AudioFormat
+
+	log       ports.Logger
+	spotify   ports.SpotifyProvider
+	watchlist ports.WatchlistProvider
+	enqueuer  *Enqueuer
+	requests  *RequestTracker
+	notifier  ports.ReleaseNotifier
+
+	// mu guards read-modify-write cycles on watchlist entries and pending,
+	// the releases still being queued; checking keeps checks from running
+	// concurrently and queueing a release twice.
+	mu       sync.Mutex
+	pending  map[string]bool
+	checking sync.Mutex
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type WatcherDeps struct {
+	Log       ports.Logger
+	Spotify   ports.SpotifyProvider
+	Watchlist ports.WatchlistProvider
+	Enqueuer  *Enqueuer
+	Requests  *RequestTracker
+	// Notifier is optional.
+	Notifier ports.ReleaseNotifier
+	// Format is the output format of artists that do not pick one.
+	Format constants.AudioFormat
+}
+
+// NewWatcher starts checking the watchlist every interval. With a zero
+// interval artists are only checked on demand.
+func NewWatcher(interval time.Duration, deps *WatcherDeps) *Watcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watcher{
+		interval:  interval,
+		format:    deps.Format,
+		log:       deps.Log.With("component", "Watcher"),
+		spotify:   deps.Spotify,
+		watchlist: deps.Watchlist,
+		enqueuer:  deps.Enqueuer,
+		requests:  deps.Requests,
+		notifier:  deps.Notifier,
+		pending:   make(map[string]bool),
+		ctx:       ctx,
+		cancel:    cancel,
+		stop:      make(chan struct{}),
+	}
+
+	if interval > 0 {
+		w.wg.Add(1)
+		go w.run()
+	}
+	return w
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.checkAll()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Watch adds an artist to the watchlist. Releases already out are recorded
+// as seen, unless backfill is set, in which case they are queued in the
+// background like any new release.
+func (w *Watcher) Watch(ctx context.Context, artistID spotify.ID, groups []constants.AlbumGroup, format constants.AudioFormat, backfill bool) (models.WatchResponse, error) {
+	log := logger.From(ctx).With("artist_id", artistID)
+	ctx = logger.Into(ctx, log)
+	if _, exists := w.watchlist.Get(artistID.String()); exists {
+		return models.WatchResponse{}, ports.ErrArtistAlreadyWatched
+	}
+
+	artist, err := w.spotify.GetArtist(ctx, artistID)
+	if err != nil {
+		log.Error("failed to fetch artist details", "err", err)
+		return models.WatchResponse{}, errors.New("failed to fetch artist")
+	}
+	watched := models.WatchedArtist{
+		ArtistID:      artistID.String(),
+		Name:          artist.Name,
+		AlbumGroups:   groups,
+		Format:        format,
+		KnownReleases: []string{},
+		CreatedAt:     time.Now(),
+	}
+	if !backfill {
+		albums, err := w.spotify.GetArtistAlbums(ctx, artistID, nil)
+		if err != nil {
+			log.Error("failed to fetch artist albums", "err", err)
+			return models.WatchResponse{}, errors.New("failed to fetch artist releases")
+		}
+		for _, album := range albums {
+			if !slices.Contains(watched.KnownReleases, album.ID.String()) {
+				watched.KnownReleases = append(watched.KnownReleases, album.ID.String())
+			}
+		}
+		watched.CheckedAt = watched.CreatedAt
+	}
+
+	w.mu.Lock()
+	if _, exists := w.watchlist.Get(watched.ArtistID); exists {
+		w.mu.Unlock()
+		return models.WatchResponse{}, ports.ErrArtistAlreadyWatched
+	}
+	err = w.watchlist.Put(watched)
+	w.mu.Unlock()
+	if err != nil {
+		return models.WatchResponse{}, err
+	}
+	log.Info("artist added to watchlist", "name", watched.Name, "known_releases", len(watched.KnownReleases))
+
+	if !backfill {
+		return models.WatchResponse{Artist: watched}, nil
+	}
+	check, err := w.Check(ctx, artistID)
+	if err != nil {
+		// The artist stays watched; the next check picks the releases up.
+		log.Warn("backfill failed", "err", err)
+	}
+	if current, exists := w.watchlist.Get(watched.ArtistID); exists {
+		watched = current
+	}
+	return models.WatchResponse{Artist: watched, Backfill: &check}, nil
+}
+
+// Update changes the album groups or format of a watched artist.
+func (w *Watcher) Update(artistID string, req models.WatchUpdateRequest) (models.WatchedArtist, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watched, exists := w.watchlist.Get(artistID)
+	if !exists {
+		return models.WatchedArtist{}, ports.ErrArtistNotWatched
+	}
+	if req.AlbumGroups != nil {
+		watched.AlbumGroups = *req.AlbumGroups
+	}
+	if req.Format != nil {
+		watched.Format = *req.Format
+	}
+	if err := w.watchlist.Put(watched); err != nil {
+		return models.WatchedArtist{}, err
+	}
+	return watched, nil
+}
+
+// Unwatch removes an artist from the watchlist. Jobs already queued for its
+// releases are left alone.
+func (w *Watcher) Unwatch(artistID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.watchlist.Delete(artistID)
+}
+
+// Check starts queueing the releases of a watched artist that have come out
+// since the last check, each under a request of its own so it can be
+// followed and cancelled on its own. It returns once the new releases are
+// known; a release is recorded as seen when all of its tracks are queued.
+func (w *Watcher) Check(ctx context.Context, artistID spotify.ID) (models.WatchCheckResponse, error) {
+	w.checking.Lock()
+	defer w.checking.Unlock()
+
+	log := logger.From(ctx).With("artist_id", artistID)
+	ctx = logger.Into(ctx, log)
+	response := models.WatchCheckResponse{
+		ArtistID: artistID.String(),
+		Releases: []models.Release{},
+	}
+	watched, exists := w.watchlist.Get(artistID.String())
+	if !exists {
+		return response, ports.ErrArtistNotWatched
+	}
+
+	albums, err := w.spotify.GetArtistAlbums(ctx, artistID, nil)
+	if err != nil {
+		log.Error("failed to fetch artist albums", "err", err)
+		w.recordCheck(artistID.String(), nil, fmt.Sprintf("fetch releases: %v", err))
+		return response, errors.New("failed to fetch artist releases")
+	}
+
+	format := watched.Format
+	if format == "" {
+		format = w.format
+	}
+	known := make(map[string]bool, len(watched.KnownReleases))
+	for _, id := range watched.KnownReleases {
+		known[id] = true
+	}
+
+	var seen []string
+	for _, album := range albums {
+		id := album.ID.String()
+		if known[id] {
+			continue
+		}
+		known[id] = true
+		group := constants.AlbumGroup(album.AlbumGroup)
+		if len(watched.AlbumGroups) > 0 && !slices.Contains(watched.AlbumGroups, group) {
+			log.Debug("ignoring release outside the album groups", "album_id", id, "album_group", group)
+			seen = append(seen, id)
+			continue
+		}
+
+		w.mu.Lock()
+		queueing := w.pending[id]
+		w.pending[id] = true
+		w.mu.Unlock()
+		if queueing {
+			log.Debug("release is still being queued", "album_id", id)
+			continue
+		}
+
+		release := models.Release{
+			ArtistID:    artistID.String(),
+			Artist:      watched.Name,
+			AlbumID:     id,
+			Album:       album.Name,
+			AlbumGroup:  group,
+			ReleaseDate: album.ReleaseDate,
+			RequestID:   uuid.New().String(),
+		}
+		response.Releases = append(response.Releases, release)
+	}
+
+	// The check is recorded before any release is queued, so it cannot clear
+	// the error of a release that failed to queue.
+	w.recordCheck(artistID.String(), seen, "")
+	for _, release := range response.Releases {
+		log := log.With("request_id", release.RequestID)
+		log.Info("queueing new release", "album_id", release.AlbumID, "album", release.Album, "album_group", release.AlbumGroup)
+		// A release that failed to queue before may still have tracks
+		// downloading from that attempt.
+		batch := w.enqueuer.NewBatch(EnqueueOptions{RequestID: release.RequestID, Format: format, SkipUnfinished: true})
+		w.requests.Go(logger.Into(ctx, log), release.RequestID, func(ctx context.Context, record func(QueueResult)) {
+			result := batch.Queue(ctx, constants.SpotifyEntityTypeAlbum, spotify.ID(release.AlbumID))
+			record(result)
+			w.recordRelease(ctx, release, result)
+		})
+	}
+	log.Info("checked artist for new releases", "releases", len(response.Releases))
+	return response, nil
+}
+
+// recordRelease records a release as seen once all of its tracks are queued
+// and tells the notifier. A release only partly queued is left for the next
+// check.
+func (w *Watcher) recordRelease(ctx context.Context, release models.Release, result QueueResult) {
+	log := logger.From(ctx).With("album_id", release.AlbumID)
+	release.Jobs = len(result.JobIDs)
+	// The release stays pending until the notifier has been told.
+	defer func() {
+		w.mu.Lock()
+		delete(w.pending, release.AlbumID)
+		w.mu.Unlock()
+	}()
+
+	w.mu.Lock()
+	watched, exists := w.watchlist.Get(release.ArtistID)
+	if !exists {
+		w.mu.Unlock()
+		return
+	}
+	queued := result.Failed == 0 && ctx.Err() == nil
+	if queued {
+		if !slices.Contains(watched.KnownReleases, release.AlbumID) {
+			watched.KnownReleases = append(watched.KnownReleases, release.AlbumID)
+		}
+	} else {
+		log.Warn("release only partly queued, retrying on the next check", "failed", result.Failed)
+		watched.LastError = fmt.Sprintf("failed to queue %d tracks of %s", result.Failed, release.Album)
+	}
+	if err := w.watchlist.Put(watched); err != nil {
+		log.Error("failed to save queued release", "artist_id", release.ArtistID, "err", err)
+	}
+	w.mu.Unlock()
+
+	if queued && w.notifier != nil {
+		w.notifier.NotifyRelease(release)
+	}
+}
+
+// checkAll checks every watched artist in turn. Failures are logged and the
+// remaining artists are still checked.
+func (w *Watcher) checkAll() {
+	ctx := logger.Into(w.ctx, w.log)
+	for _, watched := range w.watchlist.List() {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+		if _, err := w.Check(ctx, spotify.ID(watched.ArtistID)); err != nil && !errors.Is(err, ports.ErrArtistNotWatched) {
+			w.log.Warn("artist check failed", "artist_id", watched.ArtistID, "err", err)
+		}
+	}
+}
+
+// recordCheck adds releases to the seen list of an artist and notes the
+// outcome of the check, clearing the error of an earlier one. Artists removed during the check stay removed.
+func (w *Watcher) recordCheck(artistID string, seen []string, lastError string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watched, exists := w.watchlist.Get(artistID)
+	if !exists {
+		return
+	}
+	for _, id := range seen {
+		if !slices.Contains(watched.KnownReleases, id) {
+			watched.KnownReleases = append(watched.KnownReleases, id)
+		}
+	}
+	watched.CheckedAt = time.Now()
+	watched.LastError = lastError
+	if err := w.watchlist.Put(watched); err != nil {
+		w.log.Error("failed to save artist check", "artist_id", artistID, "err", err)
+	}
+}
+
+// Shutdown stops the scheduler and waits for a check in progress, which is
+// abandoned once ctx is done.
+func (w *Watcher) Shutdown(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	stopped := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		w.cancel()
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-stopped
+		return ctx.Err()
+	}
+}
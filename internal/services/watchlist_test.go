@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/providers"
+)
+
+type watcherFixture struct {
+	watcher   *Watcher
+	spotify   *fakeSpotify
+	queue     *recordingQueue
+	requests  *RequestTracker
+	watchlist ports.WatchlistProvider
+	jobs      ports.JobStoreProvider
+	notifier  *recordingNotifier
+}
+
+// newWatcherFixture builds a watcher over real providers in temporary
+// directories, a fake Spotify client with one artist and a queue that only
+// records jobs. With a zero interval checks are not scheduled.
+func newWatcherFixture(t *testing.T, interval time.Duration) *watcherFixture {
+	t.Helper()
+	musicHome, dataHome := t.TempDir(), t.TempDir()
+	fs, err := providers.NewFSProvider(musicHome, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := providers.NewJobStoreProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jobs.Close() })
+	watchlist, err := providers.NewWatchlistProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := providers.NewClaimProvider(quietLogger(), dataHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &watcherFixture{
+		spotify:   newFakeSpotify(),
+		queue:     &recordingQueue{},
+		requests:  NewRequestTracker(NewEventBus(quietLogger())),
+		watchlist: watchlist,
+		jobs:      jobs,
+		notifier:  &recordingNotifier{},
+	}
+	f.spotify.artists["artist"] = spotify.FullArtist{SimpleArtist: spotify.SimpleArtist{ID: "artist", Name: "Artist"}}
+	f.spotify.artistAlbums["artist"] = []spotify.SimpleAlbum{}
+	f.watcher = NewWatcher(interval, &WatcherDeps{
+		Log:       quietLogger(),
+		Spotify:   f.spotify,
+		Watchlist: watchlist,
+		Enqueuer:  NewEnqueuer(&EnqueuerDeps{Spotify: f.spotify, FS: fs, Queue: f.queue, Library: providers.NewLibraryProvider(musicHome), Claims: claims, Jobs: jobs}),
+		Requests:  f.requests,
+		Notifier:  f.notifier,
+		Format:    constants.AudioFormatOpus,
+	})
+	t.Cleanup(func() {
+		f.watcher.Shutdown(context.Background())
+		f.requests.Shutdown(context.Background())
+	})
+	return f
+}
+
+// release adds an album with its tracks to the artist's releases.
+func (f *watcherFixture) release(id spotify.ID, group constants.AlbumGroup, trackIDs ...spotify.ID) {
+	album := f.spotify.addAlbum(id, string(group), trackIDs...)
+	f.spotify.mu.Lock()
+	defer f.spotify.mu.Unlock()
+	f.spotify.artistAlbums["artist"] = append(f.spotify.artistAlbums["artist"], album)
+}
+
+// check checks the artist and waits for every new release to be queued.
+func (f *watcherFixture) check(t *testing.T) models.WatchCheckResponse {
+	t.Helper()
+	response, err := f.watcher.Check(quietContext(), "artist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.waitReleases(t, response)
+	return response
+}
+
+// waitReleases waits for the releases of a check to be queued, recorded and
+// notified.
+func (f *watcherFixture) waitReleases(t *testing.T, response models.WatchCheckResponse) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.watcher.mu.Lock()
+		pending := len(f.watcher.pending)
+		f.watcher.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d releases still being queued", pending)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, release := range response.Releases {
+		waitQueued(t, f.requests, release.RequestID)
+	}
+}
+
+func (f *watcherFixture) known(t *testing.T) []string {
+	t.Helper()
+	watched, found := f.watchlist.Get("artist")
+	if !found {
+		t.Fatal("artist is not watched")
+	}
+	return watched.KnownReleases
+}
+
+// recordingNotifier is a ports.ReleaseNotifier that records the releases it
+// is told about.
+type recordingNotifier struct {
+	mu       sync.Mutex
+	releases []models.Release
+}
+
+func (n *recordingNotifier) NotifyRelease(release models.Release) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.releases = append(n.releases, release)
+}
+
+func (n *recordingNotifier) albumIDs() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ids := make([]string, 0, len(n.releases))
+	for _, release := range n.releases {
+		ids = append(ids, release.AlbumID)
+	}
+	return ids
+}
+
+func TestWatchRecordsReleasesAlreadyOut(t *testing.T) {
+	f := newWatcherFixture(t, 0)
+	f.release("old", constants.AlbumGroupAlbum, "t1")
+
+	response, err := f.watcher.Watch(quietContext(), "artist", nil, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Backfill != nil || response.Artist.Name != "Artist" || !slices.Equal(response.Artist.KnownReleases, []string{"old"}) {
+		t.Fatalf("Watch() = %+v, want the old release known and no backfill", response)
+	}
+	if _, err := f.watcher.Watch(quietContext(), "artist", nil, "", false); err != ports.ErrArtistAlreadyWatched {
+		t.Errorf("second Watch() = %v, want ErrArtistAlreadyWatched", err)
+	}
+
+	f.release("new", constants.AlbumGroupSingle, "t2", "t3")
+	check := f.check(t)
+	if len(check.Releases) != 1 || check.Releases[0].AlbumID != "new" || check.Releases[0].RequestID == "" {
+		t.Fatalf("Check() = %+v, want only the new release", check)
+	}
+	if got := f.queue.trackIDs(); !slices.Equal(got, []string{"t2", "t3"}) {
+		t.Errorf("queued tracks = %v, want those of the new release", got)
+	}
+	if got := f.known(t); !slices.Equal(got, []string{"old", "new"}) {
+		t.Errorf("known releases = %v, want old and new", got)
+	}
+	f.notifier.mu.Lock()
+	notified := f.notifier.releases
+	f.notifier.mu.Unlock()
+	if len(notified) != 1 || notified[0].RequestID != check.Releases[0].RequestID || notified[0].Jobs != 2 {
+		t.Errorf("notified releases = %+v, want the new release with 2 jobs", notified)
+	}
+
+	if again := f.check(t); len(again.Releases) != 0 {
+		t.Errorf("second Check() = %+v, want nothing new", again)
+	}
+	if got := f.queue.trackIDs(); len(got) != 2 {
+		t.Errorf("queued tracks after the second check = %v, want no more", got)
+	}
+}
+
+func TestWatchBackfillQueuesEveryReleaseUnderItsOwnRequest(t *testing.T) {
+	f := newWatcherFixture(t, 0)
+	f.release("a1", constants.AlbumGroupAlbum, "t1")
+	f.release("a2", constants.AlbumGroupAlbum, "t2")
+
+	response, err := f.watcher.Watch(quietContext(), "artist", nil, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Backfill == nil || len(response.Backfill.Releases) != 2 {
+		t.Fatalf("Watch() backfill = %+v, want both releases", response.Backfill)
+	}
+	if response.Backfill.Releases[0].RequestID == response.Backfill.Releases[1].RequestID {
+		t.Error("releases share a request ID")
+	}
+	f.waitReleases(t, *response.Backfill)
+
+	if got := f.queue.trackIDs(); len(got) != 2 {
+		t.Errorf("queued tracks = %v, want both releases", got)
+	}
+	known := f.known(t)
+	slices.Sort(known)
+	if !slices.Equal(known, []string{"a1", "a2"}) {
+		t.Errorf("known releases = %v, want both releases", known)
+	}
+}
+
+func TestCheckIgnoresReleasesOutsideTheAlbumGroups(t *testing.T) {
+	f := newWatcherFixture(t, 0)
+	if _, err := f.watcher.Watch(quietContext(), "artist", []constants.AlbumGroup{constants.AlbumGroupAlbum}, "", false); err != nil {
+		t.Fatal(err)
+	}
+	f.release("single", constants.AlbumGroupSingle, "t1")
+	f.release("feature", constants.AlbumGroupAppearsOn, "t2")
+	f.release("album", constants.AlbumGroupAlbum, "t3")
+
+	check := f.check(t)
+	if len(check.Releases) != 1 || check.Releases[0].AlbumID != "album" {
+		t.Fatalf("Check() = %+v, want only the album", check)
+	}
+	if got := f.queue.trackIDs(); !slices.Equal(got, []string{"t3"}) {
+		t.Errorf("queued tracks = %v, want only the album's", got)
+	}
+	known := f.known(t)
+	slices.Sort(known)
+	if !slices.Equal(known, []string{"album", "feature", "single"}) {
+		t.Errorf("known releases = %v, want the ignored releases recorded too", known)
+	}
+
+	// Widening the groups later does not pull the ignored releases in.
+	groups := []constants.AlbumGroup{constants.AlbumGroupAlbum, constants.AlbumGroupSingle}
+	if _, err := f.watcher.Update("artist", models.WatchUpdateRequest{AlbumGroups: &groups}); err != nil {
+		t.Fatal(err)
+	}
+	if again := f.check(t); len(again.Releases) != 0 {
+		t.Errorf("Check() after widening = %+v, want nothing new", again)
+	}
+}
+
+func TestCheckRetriesOnlyTheTracksOfAPartlyQueuedRelease(t *testing.T) {
+	f := newWatcherFixture(t, 0)
+	if _, err := f.watcher.Watch(quietContext(), "artist", nil, "", false); err != nil {
+		t.Fatal(err)
+	}
+	f.release("album", constants.AlbumGroupAlbum, "t1", "t2")
+	f.spotify.mu.Lock()
+	missing := f.spotify.tracks["t2"]
+	delete(f.spotify.tracks, "t2")
+	f.spotify.mu.Unlock()
+
+	f.check(t)
+	if got := f.queue.trackIDs(); !slices.Equal(got, []string{"t1"}) {
+		t.Fatalf("queued tracks = %v, want t1", got)
+	}
+	watched, _ := f.watchlist.Get("artist")
+	if slices.Contains(watched.KnownReleases, "album") || watched.LastError == "" {
+		t.Errorf("artist = %+v, want the release left unknown with an error", watched)
+	}
+	if got := f.notifier.albumIDs(); len(got) != 0 {
+		t.Errorf("notified releases = %v, want none for a partly queued release", got)
+	}
+
+	// t1 is still waiting to be downloaded when the release is retried.
+	f.queue.mu.Lock()
+	first := f.queue.jobs[0]
+	f.queue.mu.Unlock()
+	if _, err := f.jobs.Create(first); err != nil {
+		t.Fatal(err)
+	}
+	f.spotify.mu.Lock()
+	f.spotify.tracks["t2"] = missing
+	f.spotify.mu.Unlock()
+
+	f.check(t)
+	if got := f.queue.trackIDs(); !slices.Equal(got, []string{"t1", "t2"}) {
+		t.Errorf("queued tracks = %v, want only t2 queued again", got)
+	}
+	watched, _ = f.watchlist.Get("artist")
+	if !slices.Contains(watched.KnownReleases, "album") || watched.LastError != "" {
+		t.Errorf("artist = %+v, want the release known and no error", watched)
+	}
+	if got := f.notifier.albumIDs(); !slices.Equal(got, []string{"album"}) {
+		t.Errorf("notified releases = %v, want the album once", got)
+	}
+}
+
+func TestWatcherChecksOnSchedule(t *testing.T) {
+	f := newWatcherFixture(t, 10*time.Millisecond)
+	if _, err := f.watcher.Watch(quietContext(), "artist", nil, "", false); err != nil {
+		t.Fatal(err)
+	}
+	f.release("new", constants.AlbumGroupAlbum, "t1")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Contains(f.known(t), "new") {
+		if time.Now().After(deadline) {
+			t.Fatal("scheduled check did not queue the new release")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := f.queue.trackIDs(); !slices.Equal(got, []string{"t1"}) {
+		t.Errorf("queued tracks = %v, want the new release once", got)
+	}
+	if got := f.notifier.albumIDs(); !slices.Equal(got, []string{"new"}) {
+		t.Errorf("notified releases = %v, want the new release", got)
+	}
+}
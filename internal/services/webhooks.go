@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/logger"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+)
+
+// DefaultWebhookRetryPolicy governs redelivery of a webhook to a target that
+// is down or answers with an error.
+var DefaultWebhookRetryPolicy = RetryPolicy{
+	Attempts:   5,
+	Backoff:    2 * time.Second,
+	MaxBackoff: time.Minute,
+}
+
+// completedRetention is how long a reported request is remembered, which
+// only needs to outlast the terminal events of its other jobs.
+const completedRetention = time.Hour
+
+// WebhookNotifier posts job and request outcomes to webhook targets. It
+// follows every job state and request event on the event bus: finished and
+// failed jobs are reported as they happen, and a request once it is fully
+// queued and every one of its jobs has reached a terminal state. New releases of watched artists are reported
+// when the Watcher queues them.
+type WebhookNotifier struct {
+	targets []string
+	retry   RetryPolicy
+
+	log      ports.Logger
+	webhooks ports.WebhookProvider
+	jobStore ports.JobStoreProvider
+	requests *RequestTracker
+
+	events      <-chan models.JobEvent
+	unsubscribe func()
+	// completed holds when requests were reported, so a request is reported
+	// again only after one of its jobs is requeued and finishes once more.
+	completed map[string]time.Time
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	loop       sync.WaitGroup
+	deliveries sync.WaitGroup
+}
+
+type WebhookDeps struct {
+	Log      ports.Logger
+	Webhooks ports.WebhookProvider
+	Jobs     ports.JobStoreProvider
+	Events   ports.EventBus
+	// Requests tells whether a request is still being queued.
+	Requests *RequestTracker
+}
+
+func NewWebhookNotifier(targets []string, retry RetryPolicy, deps *WebhookDeps) *WebhookNotifier {
+	if retry.Attempts <= 0 {
+		retry.Attempts = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	events, unsubscribe := deps.Events.SubscribeStates()
+	n := &WebhookNotifier{
+		targets:     targets,
+		retry:       retry,
+		log:         deps.Log.With("component", "WebhookNotifier"),
+		webhooks:    deps.Webhooks,
+		jobStore:    deps.Jobs,
+		requests:    deps.Requests,
+		events:      events,
+		unsubscribe: unsubscribe,
+		completed:   make(map[string]time.Time),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	n.loop.Add(1)
+	go n.run()
+	return n
+}
+
+func (n *WebhookNotifier) run() {
+	defer n.loop.Done()
+	for event := range n.events {
+		n.handle(event)
+	}
+}
+
+func (n *WebhookNotifier) handle(event models.JobEvent) {
+	if event.Type == constants.JobEventTypeRequest {
+		n.reportRequest(event.RequestID)
+		return
+	}
+	if !event.State.Terminal() {
+		delete(n.completed, event.RequestID)
+		return
+	}
+
+	var jobEvent constants.WebhookEvent
+	switch event.State {
+	case constants.JobStateDone:
+		jobEvent = constants.WebhookEventJobDone
+	case constants.JobStateFailed:
+		jobEvent = constants.WebhookEventJobFailed
+	}
+	if jobEvent != "" {
+		if status, found := n.jobStore.Get(event.JobID); found {
+			n.dispatch(models.WebhookPayload{Event: jobEvent, Time: event.Time, Job: &status})
+		}
+	}
+
+	n.reportRequest(event.RequestID)
+}
+
+// reportRequest reports a request as completed if it is fully queued and
+// all of its jobs have finished. Requests without jobs, whose tracks were
+// all skipped, are not reported.
+func (n *WebhookNotifier) reportRequest(requestID string) {
+	n.pruneCompleted()
+	if _, reported := n.completed[requestID]; reported {
+		return
+	}
+	// Its request event follows once queueing is done.
+	if n.requests.Queueing(requestID) {
+		return
+	}
+	summary := models.RequestSummary{RequestID: requestID}
+	for _, status := range n.jobStore.ListByRequest(requestID) {
+		switch status.State {
+		case constants.JobStateDone:
+			summary.Done++
+		case constants.JobStateFailed:
+			summary.Failed++
+		case constants.JobStateCancelled:
+			summary.Cancelled++
+		default:
+			return
+		}
+		summary.Total++
+	}
+	if summary.Total == 0 {
+		return
+	}
+	n.completed[requestID] = time.Now()
+	n.dispatch(models.WebhookPayload{
+		Event:   constants.WebhookEventRequestCompleted,
+		Time:    time.Now(),
+		Request: &summary,
+	})
+}
+
+func (n *WebhookNotifier) pruneCompleted() {
+	cutoff := time.Now().Add(-completedRetention)
+	for requestID, reportedAt := range n.completed {
+		if reportedAt.Before(cutoff) {
+			delete(n.completed, requestID)
+		}
+	}
+}
+
+// NotifyRelease reports a new release of a watched artist.
+func (n *WebhookNotifier) NotifyRelease(release models.Release) {
+	n.dispatch(models.WebhookPayload{
+		Event:   constants.WebhookEventArtistRelease,
+		Time:    time.Now(),
+		Release: &release,
+	})
+}
+
+func (n *WebhookNotifier) dispatch(payload models.WebhookPayload) {
+	for _, target := range n.targets {
+		n.deliveries.Add(1)
+		go n.deliver(target, payload)
+	}
+}
+
+func (n *WebhookNotifier) deliver(target string, payload models.WebhookPayload) {
+	defer n.deliveries.Done()
+	log := n.log.With("target", target, "event", payload.Event)
+	ctx := logger.Into(n.ctx, log)
+
+	for attempt := 1; ; attempt++ {
+		err := n.webhooks.Send(ctx, target, payload)
+		if err == nil {
+			log.Info("delivered webhook")
+			return
+		}
+		if attempt >= n.retry.Attempts {
+			log.Error("giving up on webhook delivery", "attempts", attempt, "err", err)
+			return
+		}
+
+		delay := n.retry.delay(attempt)
+		log.Warn("webhook delivery failed, retrying", "attempt", attempt, "retry_in", delay, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-n.ctx.Done():
+			log.Warn("webhook delivery abandoned for shutdown", "attempt", attempt)
+			return
+		}
+	}
+}
+
+// Shutdown stops following events once those already published are handled
+// and waits for pending deliveries, which are abandoned once ctx is done.
+func (n *WebhookNotifier) Shutdown(ctx context.Context) error {
+	n.unsubscribe()
+	n.loop.Wait()
+
+	delivered := make(chan struct{})
+	go func() {
+		n.deliveries.Wait()
+		close(delivered)
+	}()
+
+	select {
+	case <-delivered:
+		n.cancel()
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		<-delivered
+		return ctx.Err()
+	}
+}
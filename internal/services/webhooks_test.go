@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"audio-scraper/internal/constants"
+	"audio-scraper/internal/models"
+	"audio-scraper/internal/ports"
+	"audio-scraper/internal/providers"
+)
+
+const testWebhookSecret = "s3cret"
+
+// webhookReceiver records deliveries, answering each with the next status
+// of statuses and 200 once they run out.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	statuses   []int
+	attempts   int
+	deliveries []models.WebhookPayload
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	r := &webhookReceiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+		mac.Write([]byte(req.Header.Get("X-Audio-Scraper-Timestamp") + "." + string(body)))
+		if req.Header.Get("X-Audio-Scraper-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("delivery with a bad signature: %s", body)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.attempts++
+		if len(r.statuses) > 0 {
+			status := r.statuses[0]
+			r.statuses = r.statuses[1:]
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		var payload models.WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("decode delivery: %v", err)
+		}
+		r.deliveries = append(r.deliveries, payload)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) counts() (attempts int, events map[constants.WebhookEvent]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events = make(map[constants.WebhookEvent]int)
+	for _, d := range r.deliveries {
+		events[d.Event]++
+	}
+	return r.attempts, events
+}
+
+type webhookFixture struct {
+	notifier *WebhookNotifier
+	jobs     ports.JobStoreProvider
+	events   *EventBus
+	requests *RequestTracker
+}
+
+func newWebhookFixture(t *testing.T, target string, retry RetryPolicy) *webhookFixture {
+	jobs, err := providers.NewJobStoreProvider(quietLogger(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jobs.Close() })
+	events := NewEventBus(quietLogger())
+	requests := NewRequestTracker(events)
+	notifier := NewWebhookNotifier([]string{target}, retry, &WebhookDeps{
+		Log:      quietLogger(),
+		Webhooks: providers.NewWebhookProvider(testWebhookSecret),
+		Jobs:     jobs,
+		Events:   events,
+		Requests: requests,
+	})
+	return &webhookFixture{notifier: notifier, jobs: jobs, events: events, requests: requests}
+}
+
+// finish creates a job of request in the store and moves it to state. The
+// transition is published by publish, so tests can store many first.
+func (f *webhookFixture) finish(t *testing.T, requestID string, jobID string, state constants.JobState) models.JobEvent {
+	t.Helper()
+	if _, err := f.jobs.Create(models.DownloadJob{ID: jobID, RequestID: requestID}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := f.jobs.SetState(jobID, state, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.JobEvent{Type: constants.JobEventTypeState, JobID: jobID, RequestID: requestID, State: state, Time: status.UpdatedAt}
+}
+
+func (f *webhookFixture) publish(events ...models.JobEvent) {
+	for _, event := range events {
+		f.events.Publish(event)
+	}
+}
+
+func (f *webhookFixture) shutdown(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.requests.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := f.notifier.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+var fastRetry = RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestWebhooksReportJobsAndRequests(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	f := newWebhookFixture(t, receiver.URL, fastRetry)
+	f.requests.Go(quietContext(), "req", func(ctx context.Context, record func(QueueResult)) {
+		// The first job finishes, and is reported, while the rest of the
+		// request is still being queued.
+		f.publish(f.finish(t, "req", "a", constants.JobStateDone))
+		for {
+			if _, events := receiver.counts(); events[constants.WebhookEventJobDone] == 1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		f.publish(f.finish(t, "req", "b", constants.JobStateFailed))
+		f.publish(f.finish(t, "req", "c", constants.JobStateCancelled))
+	})
+	f.shutdown(t)
+
+	_, events := receiver.counts()
+	want := map[constants.WebhookEvent]int{
+		constants.WebhookEventJobDone:          1,
+		constants.WebhookEventJobFailed:        1,
+		constants.WebhookEventRequestCompleted: 1,
+	}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for _, d := range receiver.deliveries {
+		if d.Event == constants.WebhookEventRequestCompleted && *d.Request != (models.RequestSummary{RequestID: "req", Total: 3, Done: 1, Failed: 1, Cancelled: 1}) {
+			t.Errorf("summary = %+v", *d.Request)
+		}
+	}
+}
+
+func TestWebhooksDeliverEveryEventOfABurst(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	f := newWebhookFixture(t, receiver.URL, fastRetry)
+	const jobs = subscriberBuffer * 4
+	var burst []models.JobEvent
+	for i := 0; i < jobs; i++ {
+		burst = append(burst, f.finish(t, "burst", fmt.Sprintf("job-%d", i), constants.JobStateDone))
+	}
+	f.publish(burst...)
+	f.shutdown(t)
+
+	_, events := receiver.counts()
+	if events[constants.WebhookEventJobDone] != jobs || events[constants.WebhookEventRequestCompleted] != 1 {
+		t.Fatalf("events = %v, want %d job.done and one request.completed", events, jobs)
+	}
+}
+
+func TestWebhooksRetryServerErrors(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusServiceUnavailable, http.StatusInternalServerError)
+	f := newWebhookFixture(t, receiver.URL, fastRetry)
+	f.notifier.NotifyRelease(models.Release{AlbumID: "album"})
+	f.shutdown(t)
+
+	attempts, events := receiver.counts()
+	if attempts != 3 || events[constants.WebhookEventArtistRelease] != 1 {
+		t.Fatalf("attempts = %d, events = %v, want a delivery on the third attempt", attempts, events)
+	}
+}
+
+func TestWebhooksGiveUpAfterLastAttempt(t *testing.T) {
+	receiver := newWebhookReceiver(t, 500, 500, 500, 500, 500)
+	f := newWebhookFixture(t, receiver.URL, fastRetry)
+	f.notifier.NotifyRelease(models.Release{AlbumID: "album"})
+	f.shutdown(t)
+
+	attempts, events := receiver.counts()
+	if attempts != fastRetry.Attempts || len(events) != 0 {
+		t.Fatalf("attempts = %d, events = %v, want %d failed attempts", attempts, events, fastRetry.Attempts)
+	}
+}
+
+func TestWebhooksShutdownAbandonsRetries(t *testing.T) {
+	receiver := newWebhookReceiver(t, 500, 500, 500)
+	f := newWebhookFixture(t, receiver.URL, RetryPolicy{Attempts: 3, Backoff: time.Hour, MaxBackoff: time.Hour})
+	f.notifier.NotifyRelease(models.Release{AlbumID: "album"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := f.notifier.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if attempts, _ := receiver.counts(); attempts != 1 {
+		t.Fatalf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestEventBusStateSubscriptionNeverDrops(t *testing.T) {
+	bus := NewEventBus(quietLogger())
+	states, unsubscribe := bus.SubscribeStates()
+	all, unsubscribeAll := bus.Subscribe()
+	defer unsubscribeAll()
+
+	const events = subscriberBuffer * 3
+	for i := 0; i < events; i++ {
+		bus.Publish(models.JobEvent{Type: constants.JobEventTypeProgress, JobID: "progress"})
+		bus.Publish(models.JobEvent{Type: constants.JobEventTypeState, JobID: fmt.Sprint(i)})
+	}
+	unsubscribe()
+
+	received := 0
+	for event := range states {
+		if event.Type != constants.JobEventTypeState || event.JobID != fmt.Sprint(received) {
+			t.Fatalf("event %d = %+v, want state events in order", received, event)
+		}
+		received++
+	}
+	if received != events {
+		t.Fatalf("received %d state events, want %d", received, events)
+	}
+	if len(all) != subscriberBuffer {
+		t.Fatalf("plain subscriber holds %d events, want its buffer of %d", len(all), subscriberBuffer)
+	}
+}